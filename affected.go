@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// changedFiles lists the files changed since ref: committed changes, local
+// modifications and untracked files, relative to the current directory
+func changedFiles(ref string) ([]string, error) {
+	diff, err := exec.Command("git", "diff", "--name-only", "--relative", ref, "--").Output()
+	if err != nil {
+		return nil, fmt.Errorf("git diff %s: %w", ref, commandError(err))
+	}
+	untracked, err := exec.Command("git", "ls-files", "--others", "--exclude-standard").Output()
+	if err != nil {
+		return nil, fmt.Errorf("git ls-files: %w", commandError(err))
+	}
+
+	var files []string
+	for _, line := range strings.Split(string(diff)+string(untracked), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			files = append(files, filepath.FromSlash(line))
+		}
+	}
+	return files, nil
+}
+
+// commandError includes the stderr of a failed command in its error
+func commandError(err error) error {
+	if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+		return fmt.Errorf("%s", strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return err
+}
+
+// goPackageInfo is the part of go list's output needed for impact analysis
+type goPackageInfo struct {
+	Dir         string
+	ImportPath  string
+	Imports     []string
+	TestImports []string
+}
+
+// listPackageGraph returns the import graph of all packages in the module
+func listPackageGraph() ([]goPackageInfo, error) {
+	args := []string{"list", "-e", "-f", "{{.Dir}}\t{{.ImportPath}}\t{{join .Imports \",\"}}\t{{join .TestImports \",\"}},{{join .XTestImports \",\"}}"}
+	if buildTags != "" {
+		args = append(args, "-tags="+buildTags)
+	}
+	args = append(args, "./...")
+	out, err := goCommand(args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list: %w", commandError(err))
+	}
+
+	var graph []goPackageInfo
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 4 {
+			continue
+		}
+		graph = append(graph, goPackageInfo{
+			Dir:         fields[0],
+			ImportPath:  fields[1],
+			Imports:     splitList(fields[2]),
+			TestImports: splitList(fields[3]),
+		})
+	}
+	return graph, nil
+}
+
+// affectedPackages narrows packages down to those whose tests can observe
+// the changed files: packages containing a changed file, packages importing
+// those (transitively), and packages whose tests import any of them.
+// Changes to go.mod or go.sum affect everything. Selection is per package;
+// there is no per-test coverage attribution to narrow it down to tests.
+func affectedPackages(packages, changed []string) ([]string, error) {
+	var files []string
+	for _, file := range changed {
+		switch filepath.Base(file) {
+		case "go.mod", "go.sum", "go.work", "go.work.sum":
+			return packages, nil
+		}
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, abs)
+	}
+
+	graph, err := listPackageGraph()
+	if err != nil {
+		return nil, err
+	}
+	affectedDirs := affectedPackageDirs(graph, files)
+
+	var result []string
+	for _, pkg := range packages {
+		if abs, err := filepath.Abs(pkg); err == nil && affectedDirs[abs] {
+			result = append(result, pkg)
+		}
+	}
+	return result, nil
+}
+
+// affectedPackageDirs returns the directories of the packages in graph
+// affected by the changed files, given as absolute paths. A file belongs to
+// the nearest package at or above its directory, so a change below a
+// package (e.g. testdata or embedded files) affects it, but a change in a
+// nested package doesn't affect the packages above it.
+func affectedPackageDirs(graph []goPackageInfo, files []string) map[string]bool {
+	packageDirs := make(map[string]bool)
+	for _, pkg := range graph {
+		packageDirs[pkg.Dir] = true
+	}
+	changedDirs := make(map[string]bool)
+	for _, file := range files {
+		for dir := packageDirOf(file); ; dir = filepath.Dir(dir) {
+			if packageDirs[dir] {
+				changedDirs[dir] = true
+				break
+			}
+			if parent := filepath.Dir(dir); parent == dir {
+				break
+			}
+		}
+	}
+
+	importers := make(map[string][]string)
+	var queue []string
+	affected := make(map[string]bool)
+	for _, pkg := range graph {
+		for _, imp := range pkg.Imports {
+			importers[imp] = append(importers[imp], pkg.ImportPath)
+		}
+		if changedDirs[pkg.Dir] {
+			affected[pkg.ImportPath] = true
+			queue = append(queue, pkg.ImportPath)
+		}
+	}
+	for len(queue) > 0 {
+		imp := queue[0]
+		queue = queue[1:]
+		for _, importer := range importers[imp] {
+			if !affected[importer] {
+				affected[importer] = true
+				queue = append(queue, importer)
+			}
+		}
+	}
+
+	// Test imports do not propagate, since tests are not imported themselves
+	affectedDirs := make(map[string]bool)
+	for _, pkg := range graph {
+		hit := affected[pkg.ImportPath]
+		for _, imp := range pkg.TestImports {
+			hit = hit || affected[imp]
+		}
+		if hit {
+			affectedDirs[pkg.Dir] = true
+		}
+	}
+	return affectedDirs
+}
+
+// affectedModules keeps the nested modules containing a changed file
+func affectedModules(modules, changed []string) []string {
+	var result []string
+	for _, module := range modules {
+		prefix := filepath.Clean(module) + string(filepath.Separator)
+		for _, file := range changed {
+			if strings.HasPrefix(filepath.Clean(file), prefix) {
+				result = append(result, module)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// packageDirOf returns the directory of the package a file belongs to.
+// Files under testdata belong to the package enclosing the outermost
+// testdata directory, since the go command ignores everything below it.
+func packageDirOf(file string) string {
+	dir := filepath.Dir(file)
+	for d := dir; ; {
+		if filepath.Base(d) == "testdata" {
+			dir = filepath.Dir(d)
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return dir
+		}
+		d = parent
+	}
+}
+
+// changedPackages is the lighter-weight selection behind --since: packages
+// with a changed file in their own directory or its testdata, plus every
+// package that depends on one of them according to go list's transitive
+// Deps
+func changedPackages(packages, changed []string) ([]string, error) {
+	changedDirs := make(map[string]bool)
+	for _, file := range changed {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return nil, err
+		}
+		changedDirs[packageDirOf(abs)] = true
+	}
+
+	args := []string{"list", "-e", "-f", "{{.Dir}}\t{{.ImportPath}}\t{{join .Deps \",\"}}"}
+	if buildTags != "" {
+		args = append(args, "-tags="+buildTags)
+	}
+	args = append(args, "./...")
+	out, err := goCommand(args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list: %w", commandError(err))
+	}
+
+	type pkgDeps struct {
+		dir  string
+		deps []string
+	}
+	var listed []pkgDeps
+	direct := make(map[string]bool)
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			continue
+		}
+		listed = append(listed, pkgDeps{fields[0], splitList(fields[2])})
+		if changedDirs[fields[0]] {
+			direct[fields[1]] = true
+		}
+	}
+
+	selectedDirs := make(map[string]bool)
+	for _, pkg := range listed {
+		hit := changedDirs[pkg.dir]
+		for _, dep := range pkg.deps {
+			hit = hit || direct[dep]
+		}
+		if hit {
+			selectedDirs[pkg.dir] = true
+		}
+	}
+
+	var result []string
+	for _, pkg := range packages {
+		if abs, err := filepath.Abs(pkg); err == nil && selectedDirs[abs] {
+			result = append(result, pkg)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPackageDirOf(t *testing.T) {
+	tests := []struct {
+		file, want string
+	}{
+		{"/m/pkg/a.go", "/m/pkg"},
+		{"/m/pkg/testdata/in.txt", "/m/pkg"},
+		{"/m/pkg/testdata/golden/out.txt", "/m/pkg"},
+		{"/m/pkg/testdata/sub/testdata/x", "/m/pkg"},
+		{"/m/testdatax/a.go", "/m/testdatax"},
+		{"/m/a.go", "/m"},
+	}
+	for _, tt := range tests {
+		if got := packageDirOf(filepath.FromSlash(tt.file)); got != filepath.FromSlash(tt.want) {
+			t.Errorf("packageDirOf(%q) = %q, want %q", tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestAffectedPackageDirs(t *testing.T) {
+	dir := func(p string) string { return filepath.FromSlash(p) }
+	graph := []goPackageInfo{
+		{Dir: dir("/m"), ImportPath: "m"},
+		{Dir: dir("/m/a"), ImportPath: "m/a"},
+		{Dir: dir("/m/a/b"), ImportPath: "m/a/b"},
+		{Dir: dir("/m/c"), ImportPath: "m/c", Imports: []string{"m/a"}},
+		{Dir: dir("/m/d"), ImportPath: "m/d", Imports: []string{"m/c"}},
+		{Dir: dir("/m/e"), ImportPath: "m/e", TestImports: []string{"m/d"}},
+		{Dir: dir("/m/f"), ImportPath: "m/f", Imports: []string{"m"}},
+	}
+	tests := []struct {
+		name  string
+		files []string
+		want  []string
+	}{
+		// Neither the root package nor m/f, which imports it, is affected
+		{"nested package", []string{"/m/a/x.go"}, []string{"/m/a", "/m/c", "/m/d", "/m/e"}},
+		{"deepest package", []string{"/m/a/b/x.go"}, []string{"/m/a/b"}},
+		{"testdata", []string{"/m/c/testdata/in.txt"}, []string{"/m/c", "/m/d", "/m/e"}},
+		{"subdirectory without a package", []string{"/m/a/assets/logo.png"}, []string{"/m/a", "/m/c", "/m/d", "/m/e"}},
+		{"root package", []string{"/m/x.go"}, []string{"/m", "/m/f"}},
+		{"test imports don't propagate", []string{"/m/e/x.go"}, []string{"/m/e"}},
+		{"outside the module", []string{"/other/x.go"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var files []string
+			for _, f := range tt.files {
+				files = append(files, dir(f))
+			}
+			want := make(map[string]bool)
+			for _, d := range tt.want {
+				want[dir(d)] = true
+			}
+			if got := affectedPackageDirs(graph, files); !reflect.DeepEqual(got, want) {
+				t.Errorf("affectedPackageDirs(%q) = %v, want %v", tt.files, got, want)
+			}
+		})
+	}
+}
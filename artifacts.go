@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// newRunID returns a short ID for a run: its start time, so IDs sort in
+// run order, and a random suffix telling apart runs started in the same
+// second
+func newRunID(started time.Time) string {
+	suffix := make([]byte, 2)
+	rand.Read(suffix)
+	return started.Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+}
+
+// saveArtifacts copies the coverage profile and reports of a run into its
+// own directory under --artifacts, together with the test output and the
+// run summary. The summary is updated to point at the copies, so the run
+// history references files that later runs don't overwrite.
+func saveArtifacts(summary *runSummary, output string, reports ...string) error {
+	dir := filepath.Join(artifactsDir, summary.RunID)
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	summary.ArtifactDir = dir
+
+	copied := make(map[string]string)
+	for _, src := range append([]string{summary.CoverProfile, summary.CoverHTML}, reports...) {
+		if _, done := copied[src]; done {
+			continue
+		}
+		dst := filepath.Join(dir, filepath.Base(src))
+		if err := copyFile(src, dst); err != nil {
+			return err
+		}
+		copied[src] = dst
+	}
+	summary.CoverProfile = copied[summary.CoverProfile]
+	summary.CoverHTML = copied[summary.CoverHTML]
+
+	if err := os.WriteFile(filepath.Join(dir, "test.log"), []byte(output), 0644); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "summary.json"), append(data, '\n'), 0644)
+}
+
+// copyFile copies the file at src to dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Hoofffman/gotest/pkg/coverprofile"
+)
+
+// badgeFileName is the total coverage badge in the --badge directory
+const badgeFileName = "coverage.svg"
+
+// writeBadges writes the total coverage badge to dir and, with perPackage,
+// one badge per package named after its sanitized path
+func writeBadges(ctx context.Context, coverProfile, dir string, perPackage bool) error {
+	profile, err := coverprofile.ParseFile(ctx, coverProfile)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, badgeFileName), []byte(badgeSVG("coverage", profile.Total().Percent())), 0644); err != nil {
+		return err
+	}
+	written := 1
+	if perPackage {
+		for _, stats := range profile.Packages() {
+			path := filepath.Join(dir, badgeName(stats.Package))
+			if err := os.WriteFile(path, []byte(badgeSVG("coverage", stats.Percent())), 0644); err != nil {
+				return err
+			}
+			written++
+		}
+	}
+	fmt.Printf("Wrote %d coverage badge(s) to %s\n", written, dir)
+	return nil
+}
+
+// badgeName turns a package path into a file name: everything but letters,
+// digits, dots and dashes becomes "_", so example.com/app/api is
+// example.com_app_api.svg
+func badgeName(pkg string) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, strings.TrimPrefix(pkg, "./"))
+	return strings.Trim(name, "_.") + ".svg"
+}
+
+// badgeColor grades a coverage percentage like common coverage services
+func badgeColor(pct float64) string {
+	switch {
+	case pct >= 90:
+		return "#4c1"
+	case pct >= 80:
+		return "#97ca00"
+	case pct >= 60:
+		return "#dfb317"
+	case pct >= 40:
+		return "#fe7d37"
+	}
+	return "#e05d44"
+}
+
+// badgeSVG renders a flat badge in the usual two-part "label | value" style.
+// Widths are estimated from the text length, which is close enough for the
+// short texts of a badge.
+func badgeSVG(label string, pct float64) string {
+	value := fmt.Sprintf("%.1f%%", pct)
+	lw := 10 + 6*len(label)
+	vw := 10 + 7*len(value)
+	w := lw + vw
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%s: %s">
+<linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>
+<clipPath id="r"><rect width="%d" height="20" rx="3" fill="#fff"/></clipPath>
+<g clip-path="url(#r)"><rect width="%d" height="20" fill="#555"/><rect x="%d" width="%d" height="20" fill="%s"/><rect width="%d" height="20" fill="url(#s)"/></g>
+<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text><text x="%d" y="14">%s</text>
+<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text><text x="%d" y="14">%s</text>
+</g>
+</svg>
+`, w, label, value, w, lw, lw, vw, badgeColor(pct), w,
+		lw/2, label, lw/2, label,
+		lw+vw/2, value, lw+vw/2, value)
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// benchResult is a single benchmark measurement
+type benchResult struct {
+	Package     string
+	Name        string
+	Iterations  int
+	NsPerOp     float64
+	BytesPerOp  float64
+	AllocsPerOp float64
+	HasMem      bool
+	// Runs is the number of measurements averaged into this result
+	Runs int
+}
+
+// runBench runs all benchmarks of the packages without running tests,
+// prints them as a table and saves the raw results as a baseline that
+// benchstat and "gotest bench --compare" can read
+func runBench(packages, userArgs []string) error {
+	if len(packages) == 0 {
+		return nil
+	}
+
+	file := benchSave
+	if file == "" {
+		file = "/tmp/bench.txt"
+	}
+
+	// The regression gate falls back to the previously saved results
+	baselineFile := benchCompare
+	if baselineFile == "" && benchThreshold > 0 {
+		baselineFile = file
+	}
+
+	// Read the baseline first, since it may be the file being overwritten
+	var baseline []benchResult
+	if baselineFile != "" {
+		var err error
+		baseline, err = loadBenchFile(baselineFile)
+		switch {
+		case err != nil && benchCompare == "" && errors.Is(err, fs.ErrNotExist):
+			// The first run of the gate sets up the baseline
+			fmt.Printf("No baseline at %s yet; these results become it\n", baselineFile)
+			baselineFile = ""
+		case err != nil:
+			return fmt.Errorf("reading baseline: %w", err)
+		}
+	}
+
+	args := []string{"test", "-run", "^$"}
+	if !hasArg(userArgs, "bench") {
+		args = append(args, "-bench", ".")
+	}
+	args = append(args, "-benchmem")
+	args = append(args, userArgs...)
+	args = append(args, packages...)
+
+	if verbose {
+		fmt.Printf("Running: go %s\n\n", strings.Join(args, " "))
+	}
+
+	var output bytes.Buffer
+	cmd := goTestCommand(args...)
+	if verbose {
+		cmd.Stdout = io.MultiWriter(os.Stdout, &output)
+		cmd.Stderr = io.MultiWriter(os.Stderr, &output)
+	} else {
+		cmd.Stdout = &output
+		cmd.Stderr = &output
+	}
+	benchErr := cmd.Run()
+
+	if benchErr != nil && !verbose {
+		fmt.Println("\n--- BENCHMARK ERRORS ---")
+		printTestErrors(output.String())
+		fmt.Println("------------------------")
+	}
+
+	results := parseBenchOutput(output.String())
+	printBenchTable(results)
+
+	var regressions []benchComparison
+	if baselineFile != "" {
+		comparisons := compareBench(baseline, results)
+		printBenchComparison(baselineFile, comparisons)
+		if benchThreshold > 0 {
+			regressions = benchRegressions(comparisons, benchThreshold)
+			printBenchRegressions(regressions, benchThreshold)
+		}
+	}
+
+	// Never let a failing run replace the baseline it failed against
+	if len(regressions) > 0 && file == baselineFile {
+		fmt.Printf("\nBaseline %s left unchanged\n", file)
+	} else {
+		if err := os.WriteFile(file, []byte(benchBaseline(output.String())), 0644); err != nil {
+			return fmt.Errorf("saving benchmark results: %w", err)
+		}
+		fmt.Printf("\nBenchmark results saved to %s\n", file)
+	}
+
+	if benchErr != nil {
+		return withExitCode(exitTestsFailed, fmt.Errorf("benchmarks failed"))
+	}
+	if len(regressions) > 0 {
+		return withExitCode(exitTestsFailed, fmt.Errorf("%d benchmark(s) regressed by more than %g%%", len(regressions), benchThreshold))
+	}
+	return nil
+}
+
+// hasArg reports whether a go test flag is among args
+func hasArg(args []string, name string) bool {
+	for _, arg := range args {
+		if isFlag(arg, "-"+name, "--"+name, "-test."+name) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseBenchOutput extracts benchmark results from go test output. The
+// package of each result comes from the preceding "pkg:" line.
+func parseBenchOutput(output string) []benchResult {
+	var results []benchResult
+	pkg := ""
+	for _, line := range strings.Split(output, "\n") {
+		if p, ok := strings.CutPrefix(line, "pkg: "); ok {
+			pkg = strings.TrimSpace(p)
+			continue
+		}
+		if res, ok := parseBenchLine(line); ok {
+			res.Package = pkg
+			results = append(results, res)
+		}
+	}
+	return results
+}
+
+// parseBenchLine parses a line such as
+// "BenchmarkFoo-8  1000  1234 ns/op  56 B/op  2 allocs/op"
+func parseBenchLine(line string) (benchResult, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+		return benchResult{}, false
+	}
+	iterations, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return benchResult{}, false
+	}
+
+	res := benchResult{Name: fields[0], Iterations: iterations}
+	found := false
+	for i := 2; i+1 < len(fields); i += 2 {
+		value, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			continue
+		}
+		switch fields[i+1] {
+		case "ns/op":
+			res.NsPerOp = value
+			found = true
+		case "B/op":
+			res.BytesPerOp = value
+			res.HasMem = true
+		case "allocs/op":
+			res.AllocsPerOp = value
+			res.HasMem = true
+		}
+	}
+	return res, found
+}
+
+// aggregateBench averages repeated runs (-count) of the same benchmark,
+// keeping the order in which benchmarks first appeared
+func aggregateBench(results []benchResult) []benchResult {
+	var order []string
+	sums := make(map[string]*benchResult)
+	for _, res := range results {
+		key := res.Package + "." + res.Name
+		sum, ok := sums[key]
+		if !ok {
+			sum = &benchResult{Package: res.Package, Name: res.Name, HasMem: res.HasMem}
+			sums[key] = sum
+			order = append(order, key)
+		}
+		sum.Runs++
+		sum.Iterations += res.Iterations
+		sum.NsPerOp += res.NsPerOp
+		sum.BytesPerOp += res.BytesPerOp
+		sum.AllocsPerOp += res.AllocsPerOp
+	}
+
+	aggregated := make([]benchResult, 0, len(order))
+	for _, key := range order {
+		sum := sums[key]
+		n := float64(sum.Runs)
+		sum.NsPerOp /= n
+		sum.BytesPerOp /= n
+		sum.AllocsPerOp /= n
+		aggregated = append(aggregated, *sum)
+	}
+	return aggregated
+}
+
+// printBenchTable prints benchmark results averaged over repeated runs,
+// slowest first
+func printBenchTable(results []benchResult) {
+	fmt.Println()
+	fmt.Println(strings.Repeat("=", 100))
+	fmt.Println("BENCHMARKS")
+	fmt.Println(strings.Repeat("=", 100))
+
+	if len(results) == 0 {
+		fmt.Println("No benchmarks found")
+		fmt.Println(strings.Repeat("=", 100))
+		return
+	}
+
+	sorted := aggregateBench(results)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].NsPerOp > sorted[j].NsPerOp
+	})
+
+	fmt.Printf("%-52s %5s %14s %12s %12s\n", "BENCHMARK", "RUNS", "NS/OP", "B/OP", "ALLOCS/OP")
+	fmt.Println(strings.Repeat("-", 100))
+	for _, res := range sorted {
+		name := res.Package + "." + res.Name
+		if len(name) > 52 {
+			name = "..." + name[len(name)-49:]
+		}
+		bytesPerOp, allocsPerOp := "-", "-"
+		if res.HasMem {
+			bytesPerOp = strconv.FormatFloat(res.BytesPerOp, 'f', 0, 64)
+			allocsPerOp = strconv.FormatFloat(res.AllocsPerOp, 'f', 0, 64)
+		}
+		fmt.Printf("%-52s %5d %14s %12s %12s\n", name, res.Runs, formatNs(res.NsPerOp), bytesPerOp, allocsPerOp)
+	}
+	fmt.Println(strings.Repeat("=", 100))
+}
+
+// formatNs formats a ns/op value with a precision suited to its size
+func formatNs(ns float64) string {
+	if ns < 10 {
+		return strconv.FormatFloat(ns, 'f', 2, 64)
+	}
+	return strconv.FormatFloat(ns, 'f', 0, 64)
+}
+
+// benchBaseline keeps the lines of go test output that make up a benchmark
+// results file in the format understood by benchstat
+func benchBaseline(output string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "goos:") || strings.HasPrefix(line, "goarch:") ||
+			strings.HasPrefix(line, "pkg:") || strings.HasPrefix(line, "cpu:") {
+			b.WriteString(line + "\n")
+			continue
+		}
+		if _, ok := parseBenchLine(line); ok {
+			b.WriteString(line + "\n")
+		}
+	}
+	return b.String()
+}
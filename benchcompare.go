@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+)
+
+// benchAlpha is the significance level for benchmark comparisons
+const benchAlpha = 0.05
+
+// benchComparison compares one benchmark between a baseline and the current run
+type benchComparison struct {
+	Name        string
+	OldNs       float64
+	NewNs       float64
+	Delta       float64 // relative change of the median ns/op, in percent
+	P           float64
+	Samples     int // smallest number of samples on either side
+	Significant bool
+	OldAllocs   float64
+	NewAllocs   float64
+}
+
+// loadBenchFile reads benchmark results saved by "gotest bench"
+func loadBenchFile(path string) ([]benchResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseBenchOutput(string(data)), nil
+}
+
+// compareBench compares the ns/op samples of benchmarks present in both
+// runs. Like benchstat, medians are compared and a change only counts as
+// significant if a Mann-Whitney U test rejects equal distributions at
+// benchAlpha.
+func compareBench(baseline, current []benchResult) []benchComparison {
+	oldSamples, order := groupBench(baseline)
+	newSamples, _ := groupBench(current)
+
+	var comparisons []benchComparison
+	for _, key := range order {
+		olds, news := oldSamples[key], newSamples[key]
+		if len(news) == 0 {
+			continue
+		}
+
+		oldNs, newNs := benchValues(olds, nsPerOp), benchValues(news, nsPerOp)
+		c := benchComparison{
+			Name:      key,
+			OldNs:     median(oldNs),
+			NewNs:     median(newNs),
+			P:         mannWhitneyU(oldNs, newNs),
+			Samples:   min(len(oldNs), len(newNs)),
+			OldAllocs: median(benchValues(olds, allocsPerOp)),
+			NewAllocs: median(benchValues(news, allocsPerOp)),
+		}
+		if c.OldNs > 0 {
+			c.Delta = (c.NewNs - c.OldNs) / c.OldNs * 100
+		}
+		c.Significant = c.P < benchAlpha
+		comparisons = append(comparisons, c)
+	}
+	return comparisons
+}
+
+func nsPerOp(r benchResult) float64     { return r.NsPerOp }
+func allocsPerOp(r benchResult) float64 { return r.AllocsPerOp }
+
+// groupBench groups results by package-qualified benchmark name
+func groupBench(results []benchResult) (map[string][]benchResult, []string) {
+	groups := make(map[string][]benchResult)
+	var order []string
+	for _, res := range results {
+		key := res.Package + "." + res.Name
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], res)
+	}
+	return groups, order
+}
+
+func benchValues(results []benchResult, value func(benchResult) float64) []float64 {
+	values := make([]float64, len(results))
+	for i, r := range results {
+		values[i] = value(r)
+	}
+	return values
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// mannWhitneyU returns the two-sided p-value of the Mann-Whitney U test for
+// samples a and b. Small samples without ties use the exact distribution of
+// U; otherwise the normal approximation with tie correction is used.
+func mannWhitneyU(a, b []float64) float64 {
+	n1, n2 := len(a), len(b)
+	if n1 == 0 || n2 == 0 {
+		return 1
+	}
+
+	// Rank the pooled samples, averaging the ranks of ties
+	type sample struct {
+		value float64
+		fromA bool
+	}
+	pooled := make([]sample, 0, n1+n2)
+	for _, v := range a {
+		pooled = append(pooled, sample{v, true})
+	}
+	for _, v := range b {
+		pooled = append(pooled, sample{v, false})
+	}
+	sort.Slice(pooled, func(i, j int) bool { return pooled[i].value < pooled[j].value })
+
+	var rankSumA, tieCorrection float64
+	ties := false
+	for i := 0; i < len(pooled); {
+		j := i
+		for j < len(pooled) && pooled[j].value == pooled[i].value {
+			j++
+		}
+		rank := float64(i+j+1) / 2 // average of ranks i+1..j
+		for k := i; k < j; k++ {
+			if pooled[k].fromA {
+				rankSumA += rank
+			}
+		}
+		if t := float64(j - i); t > 1 {
+			ties = true
+			tieCorrection += t*t*t - t
+		}
+		i = j
+	}
+
+	u := rankSumA - float64(n1*(n1+1))/2
+	uMin := math.Min(u, float64(n1*n2)-u)
+
+	if !ties && n1*n2 <= 400 {
+		// P(U <= uMin) from the exact distribution, doubled for two sides
+		dist := uDistribution(n1, n2)
+		var total, tail float64
+		for k, c := range dist {
+			total += c
+			if float64(k) <= uMin {
+				tail += c
+			}
+		}
+		return math.Min(1, 2*tail/total)
+	}
+
+	n := float64(n1 + n2)
+	mean := float64(n1*n2) / 2
+	variance := float64(n1*n2) / 12 * ((n + 1) - tieCorrection/(n*(n-1)))
+	if variance <= 0 {
+		return 1
+	}
+	// Continuity correction
+	z := (math.Abs(u-mean) - 0.5) / math.Sqrt(variance)
+	if z < 0 {
+		z = 0
+	}
+	return math.Min(1, math.Erfc(z/math.Sqrt2))
+}
+
+// uDistribution returns the number of orderings of n1 and n2 samples
+// yielding each value of U, computed with the standard recurrence
+func uDistribution(n1, n2 int) []float64 {
+	memo := make(map[[2]int][]float64)
+	var f func(m, n int) []float64
+	f = func(m, n int) []float64 {
+		if m == 0 || n == 0 {
+			return []float64{1}
+		}
+		key := [2]int{m, n}
+		if d, ok := memo[key]; ok {
+			return d
+		}
+		d := make([]float64, m*n+1)
+		// The largest element belongs to either sample
+		for u, c := range f(m-1, n) {
+			d[u+n] += c
+		}
+		for u, c := range f(m, n-1) {
+			d[u] += c
+		}
+		memo[key] = d
+		return d
+	}
+	return f(n1, n2)
+}
+
+// printBenchComparison prints the comparison against the baseline
+func printBenchComparison(baseline string, comparisons []benchComparison) {
+	fmt.Println()
+	fmt.Println(strings.Repeat("=", 100))
+	fmt.Printf("COMPARISON WITH %s\n", baseline)
+	fmt.Println(strings.Repeat("=", 100))
+
+	if len(comparisons) == 0 {
+		fmt.Println("No benchmarks in common with the baseline")
+		fmt.Println(strings.Repeat("=", 100))
+		return
+	}
+
+	fmt.Printf("%-44s %12s %12s %9s %8s\n", "BENCHMARK", "OLD NS/OP", "NEW NS/OP", "DELTA", "P")
+	fmt.Println(strings.Repeat("-", 100))
+
+	var regressions, improvements, fewSamples int
+	for _, c := range comparisons {
+		name := c.Name
+		if len(name) > 44 {
+			name = "..." + name[len(name)-41:]
+		}
+
+		delta := "~"
+		note := ""
+		if c.Significant {
+			delta = fmt.Sprintf("%+.2f%%", c.Delta)
+			if c.Delta > 0 {
+				note = "REGRESSION"
+				regressions++
+			} else if c.Delta < 0 {
+				note = "improvement"
+				improvements++
+			}
+		}
+		if c.OldAllocs != c.NewAllocs {
+			note = strings.TrimSpace(note + fmt.Sprintf(" allocs/op %.0f -> %.0f", c.OldAllocs, c.NewAllocs))
+		}
+		if c.Samples < 4 {
+			fewSamples++
+		}
+
+		line := fmt.Sprintf("%-44s %12s %12s %9s %8.3f %s", name, formatNs(c.OldNs), formatNs(c.NewNs), delta, c.P, note)
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+	fmt.Println(strings.Repeat("-", 100))
+	fmt.Printf("%d regression(s), %d improvement(s), %d unchanged (p >= %.2f shown as ~)\n",
+		regressions, improvements, len(comparisons)-regressions-improvements, benchAlpha)
+	if fewSamples > 0 {
+		fmt.Printf("Note: %d benchmark(s) have fewer than 4 samples on one side; use -count 4 or more to detect changes\n", fewSamples)
+	}
+	fmt.Println(strings.Repeat("=", 100))
+}
+
+// benchRegressions returns the benchmarks that got slower by more than
+// threshold percent. With enough samples the slowdown must also be
+// significant; with fewer than 4 samples no test can reach significance,
+// so the delta alone decides.
+func benchRegressions(comparisons []benchComparison, threshold float64) []benchComparison {
+	var regressions []benchComparison
+	for _, c := range comparisons {
+		if c.Delta <= threshold {
+			continue
+		}
+		if c.Significant || c.Samples < 4 {
+			regressions = append(regressions, c)
+		}
+	}
+	return regressions
+}
+
+// printBenchRegressions reports the outcome of the --bench-threshold gate
+func printBenchRegressions(regressions []benchComparison, threshold float64) {
+	if len(regressions) == 0 {
+		fmt.Printf("\nNo benchmark regressed by more than %g%%\n", threshold)
+		return
+	}
+	fmt.Printf("\n--- BENCHMARK REGRESSIONS (> %g%%) ---\n", threshold)
+	for _, c := range regressions {
+		fmt.Printf("%s: %s -> %s ns/op (%+.2f%%)\n", c.Name, formatNs(c.OldNs), formatNs(c.NewNs), c.Delta)
+	}
+	fmt.Println("-------------------------------------")
+}
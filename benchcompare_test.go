@@ -0,0 +1,91 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestMedian(t *testing.T) {
+	tests := []struct {
+		in   []float64
+		want float64
+	}{
+		{nil, 0},
+		{[]float64{5}, 5},
+		{[]float64{3, 1, 2}, 2},
+		{[]float64{4, 1, 3, 2}, 2.5},
+	}
+	for _, tt := range tests {
+		if got := median(tt.in); got != tt.want {
+			t.Errorf("median(%v) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestUDistribution(t *testing.T) {
+	// The 6 orderings of two samples of two give U = 0, 1, 2, 2, 3, 4
+	if got, want := uDistribution(2, 2), []float64{1, 1, 2, 1, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("uDistribution(2, 2) = %v, want %v", got, want)
+	}
+	var total float64
+	for _, c := range uDistribution(5, 4) {
+		total += c
+	}
+	if total != 126 { // 9 choose 4
+		t.Errorf("uDistribution(5, 4) sums to %v, want 126", total)
+	}
+}
+
+func TestMannWhitneyU(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float64
+		want float64
+	}{
+		{"empty", nil, []float64{1, 2}, 1},
+		// Exact: only 1 of the 20 orderings is this extreme on each side
+		{"separated, 3 each", []float64{1, 2, 3}, []float64{4, 5, 6}, 0.1},
+		{"separated, 5 each", []float64{1, 2, 3, 4, 5}, []float64{6, 7, 8, 9, 10}, 2.0 / 252},
+		{"swapped sides", []float64{6, 7, 8, 9, 10}, []float64{1, 2, 3, 4, 5}, 2.0 / 252},
+		{"interleaved", []float64{1, 4, 5, 8}, []float64{2, 3, 6, 7}, 1},
+		{"all tied", []float64{3, 3, 3}, []float64{3, 3, 3}, 1},
+		// Normal approximation with tie correction: U = 0, mean 12.5,
+		// variance 25/12 * (11 - 24/90)
+		{"ties", []float64{1, 1, 2, 2, 3}, []float64{4, 4, 5, 5, 6}, math.Erfc((12.5 - 0.5) / math.Sqrt(25.0/12*(11-24.0/90)) / math.Sqrt2)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mannWhitneyU(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("mannWhitneyU = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareBench(t *testing.T) {
+	sample := func(name string, ns ...float64) []benchResult {
+		var results []benchResult
+		for _, v := range ns {
+			results = append(results, benchResult{Package: "p", Name: name, NsPerOp: v})
+		}
+		return results
+	}
+	baseline := append(sample("BenchmarkA", 100, 101, 99, 100, 102), sample("BenchmarkGone", 1)...)
+	current := append(sample("BenchmarkA", 150, 151, 149, 150, 152), sample("BenchmarkNew", 1)...)
+
+	got := compareBench(baseline, current)
+	if len(got) != 1 || got[0].Name != "p.BenchmarkA" {
+		t.Fatalf("compareBench = %+v, want only p.BenchmarkA", got)
+	}
+	c := got[0]
+	if c.OldNs != 100 || c.NewNs != 150 || c.Delta != 50 || c.Samples != 5 || !c.Significant {
+		t.Errorf("compareBench = %+v, want 100 -> 150 ns/op (+50%%), 5 samples, significant", c)
+	}
+	if regressions := benchRegressions(got, 10); len(regressions) != 1 {
+		t.Errorf("benchRegressions(10%%) = %v, want the one comparison", regressions)
+	}
+	if regressions := benchRegressions(got, 60); len(regressions) != 0 {
+		t.Errorf("benchRegressions(60%%) = %v, want none", regressions)
+	}
+}
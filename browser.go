@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// openReport opens a report file in the browser. Where there is no
+// browser to open, as in an SSH session, it says where the report is and
+// how to view it from another machine instead.
+func openReport(path string) error {
+	if reason := browserUnavailable(); reason != "" {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			abs = path
+		}
+		fmt.Printf("Report: %s\n", abs)
+		fmt.Printf("Not opening a browser (%s). To view the report, serve it:\n", reason)
+		fmt.Printf("  python3 -m http.server --bind 127.0.0.1 --directory %s 8000\n", filepath.Dir(abs))
+		fmt.Printf("then forward the port (ssh -L 8000:localhost:8000 <host>) and open http://localhost:8000/%s\n", filepath.Base(abs))
+		return nil
+	}
+	fmt.Printf("Opening %s in browser...\n", path)
+	return openBrowser(path)
+}
+
+// browserUnavailable returns why no browser can be opened, or "" if one
+// can: over SSH without X11 forwarding the browser would start on the
+// remote machine, if at all, and without a display xdg-open fails or
+// starts a text mode browser in the terminal
+func browserUnavailable() string {
+	if runtime.GOOS == "windows" || isWSL() {
+		return ""
+	}
+	display := os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != ""
+	remote := os.Getenv("SSH_CONNECTION") != "" || os.Getenv("SSH_TTY") != ""
+	switch {
+	case remote && !display:
+		return "SSH session without a display"
+	case runtime.GOOS == "darwin":
+		return ""
+	case !display:
+		return "no display"
+	}
+	if _, err := exec.LookPath("xdg-open"); err != nil {
+		return "xdg-open not found"
+	}
+	return ""
+}
+
+// isWSL reports whether gotest runs in the Windows Subsystem for Linux,
+// where the browser is a Windows program
+func isWSL() bool {
+	if runtime.GOOS != "linux" {
+		return false
+	}
+	if os.Getenv("WSL_DISTRO_NAME") != "" {
+		return true
+	}
+	release, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	return err == nil && strings.Contains(strings.ToLower(string(release)), "microsoft")
+}
+
+// openBrowser opens the specified URL in the default browser
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+
+	switch {
+	case isWSL():
+		// wslview (from wslu) opens Linux paths and URLs in the Windows
+		// browser; explorer.exe needs Windows paths
+		if wslview, err := exec.LookPath("wslview"); err == nil {
+			cmd = exec.Command(wslview, url)
+			break
+		}
+		if !strings.Contains(url, "://") {
+			if out, err := exec.Command("wslpath", "-w", url).Output(); err == nil {
+				url = strings.TrimSpace(string(out))
+			}
+		}
+		cmd = exec.Command("explorer.exe", url)
+	case runtime.GOOS == "darwin":
+		cmd = exec.Command("open", url)
+	case runtime.GOOS == "windows":
+		cmd = exec.Command("cmd", "/c", "start", url)
+	case runtime.GOOS == "linux":
+		cmd = exec.Command("xdg-open", url)
+	default:
+		return fmt.Errorf("unsupported platform: %s", runtime.GOOS)
+	}
+
+	return cmd.Start()
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Hoofffman/gotest/pkg/runner"
+)
+
+// buildError is an error of the compiler or another build step, reported by
+// go test under a "# package" header. Findings of the vet checks go test
+// runs before testing come under an additional "# [package]" header.
+type buildError struct {
+	pkg      string
+	location string // file:line[:column], empty if the error has none
+	message  string
+	vet      bool
+}
+
+var buildErrorLocation = regexp.MustCompile(`^(\S+\.go:\d+(?::\d+)?): (.*)$`)
+
+// splitBuildErrors takes the build errors out of go test output, returning
+// them and the rest of the output without the result lines of the packages
+// that failed to build. go test reports an error in a non-test
+// file for the package and again for its test binary; it is returned once.
+func splitBuildErrors(output string) ([]buildError, string) {
+	var errs []buildError
+	var rest []string
+	seen := make(map[buildError]bool)
+	pkg := ""
+	inBlock, vet := false, false
+
+	for _, line := range strings.Split(output, "\n") {
+		if header, ok := strings.CutPrefix(line, "# "); ok {
+			// "# example.com/pkg [example.com/pkg.test]", then "# [example.com/pkg]" for vet
+			fields := strings.Fields(header)
+			if len(fields) > 0 && strings.HasPrefix(fields[0], "[") {
+				vet = true
+			} else if len(fields) > 0 {
+				pkg, vet = fields[0], false
+			}
+			inBlock = true
+			continue
+		}
+		if inBlock && isBuildErrorLine(line) {
+			if strings.HasPrefix(line, "\t") && len(errs) > 0 {
+				// Continuation, e.g. the have/want lines of a type mismatch
+				errs[len(errs)-1].message += "\n" + line
+				continue
+			}
+			e := buildError{pkg: pkg, message: line, vet: vet}
+			if m := buildErrorLocation.FindStringSubmatch(line); m != nil {
+				e.location, e.message = m[1], m[2]
+			}
+			if !seen[e] {
+				seen[e] = true
+				errs = append(errs, e)
+			}
+			continue
+		}
+		inBlock = false
+		if strings.HasPrefix(line, "FAIL") && (strings.HasSuffix(line, " [build failed]") || strings.HasSuffix(line, " [setup failed]")) {
+			// The package is listed with its errors
+			continue
+		}
+		rest = append(rest, line)
+	}
+	return errs, strings.Join(rest, "\n")
+}
+
+// isBuildErrorLine reports whether a line within a "# package" block is
+// still compiler output rather than test output or a package result
+func isBuildErrorLine(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || trimmed == "FAIL" || trimmed == "PASS" {
+		return false
+	}
+	for _, prefix := range []string{"ok ", "FAIL\t", "FAIL ", "? ", "=== ", "--- "} {
+		if strings.HasPrefix(trimmed, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// printBuildErrors shows the compiler errors in a BUILD ERRORS section and
+// the vet findings that stopped packages from being tested in a VET FINDINGS
+// section, grouped by package with their file:line locations. It also names
+// the packages that failed to build only because a package they import did
+// not.
+func printBuildErrors(errs []buildError, result *runner.Result) {
+	var compileErrs, vetErrs []buildError
+	failing := make(map[string]bool)
+	for _, e := range errs {
+		failing[e.pkg] = true
+		if e.vet {
+			vetErrs = append(vetErrs, e)
+		} else {
+			compileErrs = append(compileErrs, e)
+		}
+	}
+	var broken []string
+	for _, res := range result.Failed() {
+		if res.Status != runner.StatusBuildFailed {
+			continue
+		}
+		pkg := res.ImportPath
+		if pkg == "" {
+			pkg = res.Package
+		}
+		if !failing[pkg] {
+			broken = append(broken, localPath(pkg))
+		}
+	}
+
+	if len(compileErrs) > 0 || len(broken) > 0 {
+		fmt.Println("\n--- BUILD ERRORS ---")
+		printErrorsByPackage(compileErrs)
+		switch {
+		case len(broken) == 0:
+		case len(compileErrs) > 0:
+			fmt.Printf("Not built because of the errors above: %s\n", strings.Join(broken, ", "))
+		default:
+			fmt.Printf("Failed to build: %s\n", strings.Join(broken, ", "))
+		}
+		fmt.Println("--------------------")
+	}
+
+	if len(vetErrs) > 0 {
+		fmt.Println("\n--- VET FINDINGS ---")
+		printErrorsByPackage(vetErrs)
+		fmt.Println("go test runs these vet checks before testing; fix them or pass -vet=off")
+		fmt.Println("--------------------")
+	}
+}
+
+func printErrorsByPackage(errs []buildError) {
+	pkg := ""
+	for i, e := range errs {
+		if i == 0 || e.pkg != pkg {
+			pkg = e.pkg
+			fmt.Printf("%s:\n", localPath(pkg))
+		}
+		if e.location == "" {
+			fmt.Printf("  %s\n", e.message)
+		} else {
+			fmt.Printf("  %s: %s\n", e.location, e.message)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// findCgoPackages lists the package directories below the current directory
+// that contain cgo files when cgo is enabled
+func findCgoPackages() ([]string, error) {
+	args := []string{"list", "-e", "-f", "{{if .CgoFiles}}{{.Dir}}{{end}}"}
+	if buildTags != "" {
+		args = append(args, "-tags="+buildTags)
+	}
+	args = append(args, "./...")
+
+	cmd := goCommand(args...)
+	cmd.Env = append(cmd.Env, "CGO_ENABLED=1")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	var packages []string
+	for _, dir := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if dir == "" {
+			continue
+		}
+		rel, err := filepath.Rel(cwd, dir)
+		if err != nil {
+			return nil, err
+		}
+		if !shouldIgnore(rel) {
+			packages = append(packages, "./"+filepath.ToSlash(rel))
+		}
+	}
+	return packages, nil
+}
+
+// reportCgoPackages prints the packages that use cgo when testing with
+// CGO_ENABLED=0: packages only made of cgo files are not tested at all,
+// others are tested without their cgo files.
+func reportCgoPackages(tested []string) {
+	cgoPackages, err := findCgoPackages()
+	if err != nil {
+		warnf("could not detect cgo packages: %v", err)
+		return
+	}
+	if len(cgoPackages) == 0 {
+		return
+	}
+
+	testedSet := make(map[string]bool)
+	for _, pkg := range tested {
+		testedSet[pkg] = true
+	}
+
+	fmt.Printf("\nCGO PACKAGES (CGO_ENABLED=0):\n")
+	for _, pkg := range cgoPackages {
+		if testedSet[pkg] {
+			fmt.Printf("  %-50s tested without cgo files\n", pkg)
+		} else {
+			fmt.Printf("  %-50s skipped (requires cgo)\n", pkg)
+		}
+	}
+	fmt.Println()
+}
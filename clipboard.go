@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/Hoofffman/gotest/pkg/runner"
+)
+
+// copySummary puts the Markdown summary of the run on the clipboard
+// (--copy)
+var copySummary bool
+
+// markdownSummary describes a run in Markdown for a pull request or chat:
+// the result and coverage, the failed tests and a table of the packages.
+// It sticks to ASCII, which every clipboard tool passes on unchanged.
+func markdownSummary(s runSummary) string {
+	var b strings.Builder
+	result := "PASS"
+	if !s.Passed {
+		result = "FAIL"
+	}
+	var failed []string
+	var failedPackages int
+	for _, pkg := range s.Packages {
+		if pkg.Status == string(runner.StatusFailed) || pkg.Status == string(runner.StatusBuildFailed) {
+			failedPackages++
+		}
+		for _, f := range pkg.Failures {
+			failed = append(failed, fmt.Sprintf("- `%s` in `%s`", f.Test, pkg.Package))
+		}
+	}
+
+	fmt.Fprintf(&b, "## gotest: %s, %.1f%% coverage\n\n", result, s.Coverage.Percent)
+	b.WriteString("| | |\n|---|---|\n")
+	fmt.Fprintf(&b, "| Result | %s |\n", result)
+	fmt.Fprintf(&b, "| Coverage | %.1f%% (%d/%d statements) |\n", s.Coverage.Percent, s.Coverage.Covered, s.Coverage.Statements)
+	fmt.Fprintf(&b, "| Packages | %d (%d failed) |\n", len(s.Packages), failedPackages)
+	fmt.Fprintf(&b, "| Duration | %s |\n", seconds(s.DurationSeconds).Round(time.Millisecond))
+
+	if len(failed) > 0 {
+		fmt.Fprintf(&b, "\n### Failed tests (%d)\n\n%s\n", len(failed), strings.Join(failed, "\n"))
+	}
+
+	if len(s.Packages) > 0 {
+		b.WriteString("\n### Packages\n\n| Package | Status | Coverage | Duration |\n|---|---|---:|---:|\n")
+		for _, pkg := range s.Packages {
+			coverage := "-"
+			if pkg.Coverage != nil {
+				coverage = fmt.Sprintf("%.1f%%", pkg.Coverage.Percent)
+			}
+			status := pkg.Status
+			if pkg.Cached {
+				status += " (cached)"
+			}
+			fmt.Fprintf(&b, "| `%s` | %s | %s | %s |\n", pkg.Package, status, coverage, seconds(pkg.DurationSeconds).Round(time.Millisecond))
+		}
+	}
+	return b.String()
+}
+
+// copyToClipboard puts text on the system clipboard with the platform's
+// tool: pbcopy, clip.exe (also under WSL), or wl-copy, xclip or xsel.
+// Without any, as in an SSH session, a terminal that supports OSC 52 is
+// asked to set its clipboard instead. It returns what took the text.
+func copyToClipboard(text string) (string, error) {
+	var candidates [][]string
+	switch {
+	case runtime.GOOS == "darwin":
+		candidates = [][]string{{"pbcopy"}}
+	case runtime.GOOS == "windows" || isWSL():
+		candidates = [][]string{{"clip.exe"}}
+	case os.Getenv("WAYLAND_DISPLAY") != "":
+		candidates = [][]string{{"wl-copy"}}
+	case os.Getenv("DISPLAY") != "":
+		candidates = [][]string{{"xclip", "-selection", "clipboard"}, {"xsel", "--clipboard", "--input"}}
+	}
+	for _, c := range candidates {
+		path, err := exec.LookPath(c[0])
+		if err != nil {
+			continue
+		}
+		cmd := exec.Command(path, c[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return "", fmt.Errorf("%s: %v %s", c[0], err, strings.TrimSpace(string(out)))
+		}
+		return c[0], nil
+	}
+
+	if !isTerminal(os.Stderr) {
+		return "", fmt.Errorf("no clipboard tool found (pbcopy, clip.exe, wl-copy, xclip or xsel)")
+	}
+	fmt.Fprintf(os.Stderr, "\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(text)))
+	return "the terminal (OSC 52)", nil
+}
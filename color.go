@@ -0,0 +1,22 @@
+package main
+
+import "os"
+
+const (
+	colorRed   = "31"
+	colorGreen = "32"
+)
+
+// useColor reports whether output may contain ANSI colors: only on a
+// terminal, and never with NO_COLOR set (https://no-color.org)
+func useColor() bool {
+	return !plainOutput && os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb" && isTerminal(os.Stdout)
+}
+
+// colorize wraps s in an ANSI color if colors are enabled
+func colorize(s, color string) string {
+	if !useColor() {
+		return s
+	}
+	return "\033[" + color + "m" + s + "\033[0m"
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// runComparison is the difference between two recorded runs
+type runComparison struct {
+	Base, Head    *historyRun
+	Coverage      []coverageChange
+	NewlyFailing  []string // "package TestName"
+	NewlyPassing  []string
+	Durations     []durationChange
+	TotalDuration durationChange
+}
+
+// coverageChange is the coverage of one package in both runs; a package
+// missing from a run has a nil value there
+type coverageChange struct {
+	Package    string
+	Base, Head *float64
+}
+
+// durationChange is the duration of one package in both runs
+type durationChange struct {
+	Package    string
+	Base, Head time.Duration
+}
+
+func (d durationChange) delta() time.Duration { return d.Head - d.Base }
+
+// minDurationChange hides packages whose duration barely changed
+const minDurationChange = 100 * time.Millisecond
+
+// runCompare implements "gotest compare [--markdown] <run-id> <run-id>":
+// it diffs two runs of the history. Without run IDs it lists the recorded
+// runs instead.
+func runCompare(args []string) error {
+	var ids []string
+	markdown := false
+	for _, arg := range args {
+		switch {
+		case arg == "--markdown" || arg == "-markdown":
+			markdown = true
+		case strings.HasPrefix(arg, "-"):
+			return fmt.Errorf("unknown flag %s\nusage: gotest compare [--markdown] <run-id> <run-id>", arg)
+		default:
+			ids = append(ids, arg)
+		}
+	}
+
+	runs, err := loadHistory()
+	if err != nil {
+		return fmt.Errorf("reading run history: %w", err)
+	}
+	if len(ids) == 0 {
+		printRecordedRuns(runs)
+		return nil
+	}
+	if len(ids) != 2 {
+		return fmt.Errorf("usage: gotest compare [--markdown] <run-id> <run-id>")
+	}
+
+	base, err := findRun(runs, ids[0])
+	if err != nil {
+		return withExitCode(exitToolError, err)
+	}
+	head, err := findRun(runs, ids[1])
+	if err != nil {
+		return withExitCode(exitToolError, err)
+	}
+
+	c := compareRuns(base, head)
+	if markdown {
+		printComparisonMarkdown(c)
+	} else {
+		printComparison(c)
+	}
+	return nil
+}
+
+// findRun returns the run with the given ID, or the only run whose ID
+// starts with it
+func findRun(runs []historyRun, id string) (*historyRun, error) {
+	var found *historyRun
+	for i := range runs {
+		switch {
+		case runs[i].RunID == "":
+		case runs[i].RunID == id:
+			return &runs[i], nil
+		case strings.HasPrefix(runs[i].RunID, id):
+			if found != nil {
+				return nil, fmt.Errorf("run ID %q is ambiguous", id)
+			}
+			found = &runs[i]
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no run %q in the history (run \"gotest compare\" to list them)", id)
+	}
+	return found, nil
+}
+
+// printRecordedRuns lists the runs of the history that have an ID, newest
+// first
+func printRecordedRuns(runs []historyRun) {
+	fmt.Printf("%-22s %-8s %10s %12s\n", "RUN", "RESULT", "COVERAGE", "DURATION")
+	fmt.Println(strings.Repeat("-", 55))
+	listed := 0
+	for i := len(runs) - 1; i >= 0; i-- {
+		run := runs[i]
+		if run.RunID == "" {
+			continue
+		}
+		fmt.Printf("%-22s %-8s %9.1f%% %12s\n", run.RunID, runResult(&run), run.Coverage.Percent, seconds(run.DurationSeconds).Round(time.Millisecond))
+		listed++
+	}
+	if listed == 0 {
+		fmt.Println("No runs recorded")
+	}
+}
+
+func runResult(run *historyRun) string {
+	if run.Passed {
+		return "PASS"
+	}
+	return "FAIL"
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// compareRuns diffs the per-package coverage, test outcomes and package
+// durations of two runs
+func compareRuns(base, head *historyRun) *runComparison {
+	c := &runComparison{
+		Base:          base,
+		Head:          head,
+		TotalDuration: durationChange{Base: seconds(base.DurationSeconds), Head: seconds(head.DurationSeconds)},
+	}
+
+	for _, pkg := range sortedKeys(mergeMaps(base.PackageCoverage, head.PackageCoverage)) {
+		change := coverageChange{Package: pkg}
+		if pct, ok := base.PackageCoverage[pkg]; ok {
+			change.Base = &pct
+		}
+		if pct, ok := head.PackageCoverage[pkg]; ok {
+			change.Head = &pct
+		}
+		if change.Base == nil || change.Head == nil || math.Abs(*change.Head-*change.Base) >= 0.05 {
+			c.Coverage = append(c.Coverage, change)
+		}
+	}
+
+	baseFailed, _ := testOutcomes(base)
+	headFailed, headPassed := testOutcomes(head)
+	for _, test := range sortedKeys(headFailed) {
+		if !baseFailed[test] {
+			c.NewlyFailing = append(c.NewlyFailing, test)
+		}
+	}
+	for _, test := range sortedKeys(baseFailed) {
+		pkg, _, _ := strings.Cut(test, " ")
+		if !headFailed[test] && (headPassed[test] || headPassed[pkg]) {
+			c.NewlyPassing = append(c.NewlyPassing, test)
+		}
+	}
+
+	baseDurations := make(map[string]time.Duration)
+	for _, pkg := range base.Packages {
+		baseDurations[pkg.Package] = seconds(pkg.DurationSeconds)
+	}
+	for _, pkg := range head.Packages {
+		prev, ok := baseDurations[pkg.Package]
+		change := durationChange{Package: pkg.Package, Base: prev, Head: seconds(pkg.DurationSeconds)}
+		if ok && !pkg.Cached && absDuration(change.delta()) >= minDurationChange {
+			c.Durations = append(c.Durations, change)
+		}
+	}
+	sort.SliceStable(c.Durations, func(i, j int) bool {
+		return absDuration(c.Durations[i].delta()) > absDuration(c.Durations[j].delta())
+	})
+	return c
+}
+
+// testOutcomes returns the failed tests of a run, as "package TestName",
+// and the passed tests and passed packages
+func testOutcomes(run *historyRun) (failed, passed map[string]bool) {
+	failed, passed = make(map[string]bool), make(map[string]bool)
+	for _, pkg := range run.Packages {
+		if pkg.Status == "passed" {
+			passed[pkg.Package] = true
+		}
+		for _, f := range pkg.Failures {
+			failed[pkg.Package+" "+f.Test] = true
+		}
+		for _, t := range pkg.Tests {
+			if t.Status == "pass" {
+				passed[pkg.Package+" "+t.Name] = true
+			}
+		}
+	}
+	return failed, passed
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// formatPct formats an optional coverage value
+func formatPct(pct *float64) string {
+	if pct == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", *pct)
+}
+
+// formatCoverageDelta describes the change of a package's coverage
+func formatCoverageDelta(change coverageChange) string {
+	switch {
+	case change.Base == nil:
+		return "new"
+	case change.Head == nil:
+		return "removed"
+	}
+	return fmt.Sprintf("%+.1f%%", *change.Head-*change.Base)
+}
+
+func formatDurationDelta(d time.Duration) string {
+	sign := "+"
+	if d < 0 {
+		sign = "-"
+	}
+	return sign + absDuration(d).Round(time.Millisecond).String()
+}
+
+// printComparison prints a comparison as tables
+func printComparison(c *runComparison) {
+	fmt.Println(strings.Repeat("=", 60))
+	fmt.Println("RUN COMPARISON")
+	fmt.Println(strings.Repeat("=", 60))
+	for _, side := range []struct {
+		label string
+		run   *historyRun
+	}{{"Base", c.Base}, {"Head", c.Head}} {
+		fmt.Printf("%s: %s  %s  %.1f%%  %s\n", side.label, side.run.RunID, runResult(side.run), side.run.Coverage.Percent, seconds(side.run.DurationSeconds).Round(time.Millisecond))
+	}
+
+	pkgCol := len("PACKAGE")
+	for _, change := range c.Coverage {
+		pkgCol = max(pkgCol, len(change.Package))
+	}
+	pkgCol = max(min(pkgCol, terminalWidth()-30), 20)
+
+	fmt.Printf("\n%-*s %9s %9s %9s\n", pkgCol, "PACKAGE", "BASE", "HEAD", "DELTA")
+	fmt.Println(strings.Repeat("-", pkgCol+30))
+	if len(c.Coverage) == 0 {
+		fmt.Println("No coverage changes")
+	}
+	for _, change := range c.Coverage {
+		fmt.Printf("%-*s %9s %9s %9s\n", pkgCol, middleEllipsis(change.Package, pkgCol), formatPct(change.Base), formatPct(change.Head), formatCoverageDelta(change))
+	}
+	fmt.Println(strings.Repeat("-", pkgCol+30))
+	fmt.Printf("%-*s %8.1f%% %8.1f%% %+8.1f%%\n", pkgCol, "TOTAL", c.Base.Coverage.Percent, c.Head.Coverage.Percent, c.Head.Coverage.Percent-c.Base.Coverage.Percent)
+
+	if len(c.NewlyFailing) > 0 {
+		fmt.Printf("\n--- NEWLY FAILING (%d) ---\n", len(c.NewlyFailing))
+		for _, test := range c.NewlyFailing {
+			fmt.Println("  " + test)
+		}
+	}
+	if len(c.NewlyPassing) > 0 {
+		fmt.Printf("\n--- NEWLY PASSING (%d) ---\n", len(c.NewlyPassing))
+		for _, test := range c.NewlyPassing {
+			fmt.Println("  " + test)
+		}
+	}
+
+	fmt.Printf("\n--- DURATION (%s) ---\n", formatDurationDelta(c.TotalDuration.delta()))
+	if len(c.Durations) == 0 {
+		fmt.Printf("No package changed by %s or more\n", minDurationChange)
+	}
+	for _, d := range c.Durations {
+		fmt.Printf("%-*s %9s %9s %9s\n", pkgCol, middleEllipsis(d.Package, pkgCol), d.Base.Round(time.Millisecond), d.Head.Round(time.Millisecond), formatDurationDelta(d.delta()))
+	}
+	fmt.Println(strings.Repeat("=", 60))
+}
+
+// printComparisonMarkdown prints a comparison as Markdown, e.g. for a pull
+// request comment
+func printComparisonMarkdown(c *runComparison) {
+	fmt.Printf("## Run comparison: `%s` → `%s`\n\n", c.Base.RunID, c.Head.RunID)
+	fmt.Println("| | Base | Head |")
+	fmt.Println("|---|---|---|")
+	fmt.Printf("| Result | %s | %s |\n", runResult(c.Base), runResult(c.Head))
+	fmt.Printf("| Coverage | %.1f%% | %.1f%% |\n", c.Base.Coverage.Percent, c.Head.Coverage.Percent)
+	fmt.Printf("| Duration | %s | %s |\n", seconds(c.Base.DurationSeconds).Round(time.Millisecond), seconds(c.Head.DurationSeconds).Round(time.Millisecond))
+
+	fmt.Println("\n### Coverage")
+	if len(c.Coverage) == 0 {
+		fmt.Println("\nNo coverage changes.")
+	} else {
+		fmt.Println("\n| Package | Base | Head | Delta |")
+		fmt.Println("|---|---:|---:|---:|")
+		for _, change := range c.Coverage {
+			fmt.Printf("| `%s` | %s | %s | %s |\n", change.Package, formatPct(change.Base), formatPct(change.Head), formatCoverageDelta(change))
+		}
+	}
+
+	for _, section := range []struct {
+		title string
+		tests []string
+	}{{"Newly failing", c.NewlyFailing}, {"Newly passing", c.NewlyPassing}} {
+		if len(section.tests) == 0 {
+			continue
+		}
+		fmt.Printf("\n### %s (%d)\n\n", section.title, len(section.tests))
+		for _, test := range section.tests {
+			pkg, name, _ := strings.Cut(test, " ")
+			fmt.Printf("- `%s` in `%s`\n", name, pkg)
+		}
+	}
+
+	if len(c.Durations) > 0 {
+		fmt.Println("\n### Duration")
+		fmt.Println("\n| Package | Base | Head | Delta |")
+		fmt.Println("|---|---:|---:|---:|")
+		for _, d := range c.Durations {
+			fmt.Printf("| `%s` | %s | %s | %s |\n", d.Package, d.Base.Round(time.Millisecond), d.Head.Round(time.Millisecond), formatDurationDelta(d.delta()))
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// runCompileCheck builds the packages and compiles and links their test
+// binaries without running them, as a fast "does everything still compile"
+// gate. Test binaries are built with go test -c, one package at a time as
+// test binaries are named after their package, which need not be unique.
+func runCompileCheck(packages []string) error {
+	if len(packages) == 0 {
+		return nil
+	}
+
+	var tagArgs []string
+	if buildTags != "" {
+		tagArgs = append(tagArgs, "-tags="+buildTags)
+	}
+	tmpDir, err := os.MkdirTemp("", "gotest-compile-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	type step struct {
+		args   []string
+		output bytes.Buffer
+		err    error
+	}
+	steps := []*step{{args: append(append([]string{"build"}, tagArgs...), packages...)}}
+	for i, pkg := range packages {
+		out := filepath.Join(tmpDir, fmt.Sprintf("%d.test", i))
+		steps = append(steps, &step{args: append(append([]string{"test", "-c", "-o", out}, tagArgs...), pkg)})
+	}
+
+	// The go command parallelizes within a build, not across test binaries
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	var wg sync.WaitGroup
+	for _, st := range steps {
+		if verbose {
+			fmt.Printf("Running: go %s\n", strings.Join(st.args, " "))
+		}
+		wg.Add(1)
+		go func(st *step) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			cmd := goCommand(st.args...)
+			cmd.Stdout = &st.output
+			cmd.Stderr = &st.output
+			st.err = cmd.Run()
+		}(st)
+	}
+	wg.Wait()
+
+	var failed bool
+	// Errors in non-test files are reported by both go build and go test;
+	// only show them once
+	printed := make(map[string]bool)
+	for i, st := range steps {
+		if st.err == nil {
+			continue
+		}
+		failed = true
+		var lines []string
+		for _, line := range strings.Split(strings.TrimRight(st.output.String(), "\n"), "\n") {
+			if strings.HasPrefix(line, "?") || line == "FAIL" || printed[line] {
+				continue
+			}
+			printed[line] = true
+			lines = append(lines, line)
+		}
+		if len(lines) > 0 {
+			if i == 0 {
+				fmt.Printf("\n--- COMPILE ERRORS (go build) ---\n")
+			} else {
+				fmt.Printf("\n--- COMPILE ERRORS (go test %s) ---\n", packages[i-1])
+			}
+			fmt.Println(strings.Join(lines, "\n"))
+			fmt.Println("-------------------")
+		}
+	}
+
+	if failed {
+		fmt.Fprintf(os.Stderr, "\nCompilation failed\n")
+		return fmt.Errorf("compile check failed")
+	}
+
+	fmt.Println("Everything compiles")
+	return nil
+}
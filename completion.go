@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Hoofffman/gotest/pkg/discover"
+)
+
+// subcommands are completed as the first argument
+var subcommands = []string{"bench", "build", "compare", "completion", "config", "crosscheck", "export", "flaky", "gaps", "history", "install-hook", "list", "matrix", "merge", "report", "scaffold", "self-update", "serve", "suite", "version"}
+
+// completionScripts hold the shell glue; all of them ask the hidden
+// "gotest __complete <words...>" command for candidates, the last word being
+// the one under the cursor. Without candidates, shells fall back to files.
+var completionScripts = map[string]string{
+	"bash": `# bash completion for gotest
+_gotest() {
+	local IFS=$'\n'
+	COMPREPLY=($(gotest __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+}
+complete -o default -F _gotest gotest
+`,
+	"zsh": `#compdef gotest
+_gotest() {
+	local -a candidates
+	candidates=("${(@f)$(gotest __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+	if [[ -n ${candidates[1]} ]]; then
+		compadd -Q -- $candidates
+	else
+		_files
+	fi
+}
+compdef _gotest gotest
+`,
+	"fish": `# fish completion for gotest
+function __gotest_complete
+	set -l tokens (commandline -opc) (commandline -ct)
+	gotest __complete $tokens[2..-1] 2>/dev/null
+end
+complete -c gotest -a '(__gotest_complete)'
+`,
+	"powershell": `# PowerShell completion for gotest
+Register-ArgumentCompleter -Native -CommandName gotest -ScriptBlock {
+	param($wordToComplete, $commandAst, $cursorPosition)
+	$words = @($commandAst.CommandElements | Select-Object -Skip 1 | ForEach-Object { $_.ToString() })
+	if ($wordToComplete -eq '') { $words += '' }
+	& gotest __complete @words 2>$null | ForEach-Object {
+		[System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+	}
+}
+`,
+}
+
+// runCompletion implements "gotest completion bash|zsh|fish|powershell"
+func runCompletion(args []string) error {
+	if len(args) != 1 || completionScripts[args[0]] == "" {
+		return fmt.Errorf("usage: gotest completion bash|zsh|fish|powershell")
+	}
+	fmt.Print(completionScripts[args[0]])
+	return nil
+}
+
+// runComplete prints the completion candidates for the word under the
+// cursor, which is the last of words
+func runComplete(ctx context.Context, words []string) {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	cur := words[len(words)-1]
+	prev := words[:len(words)-1]
+
+	for _, c := range completeWord(ctx, prev, cur) {
+		if strings.HasPrefix(c, cur) {
+			fmt.Println(c)
+		}
+	}
+}
+
+// completeWord returns the candidates for cur, before filtering by prefix
+func completeWord(ctx context.Context, prev []string, cur string) []string {
+	if len(prev) > 0 {
+		switch prev[0] {
+		case "completion":
+			if len(prev) == 1 {
+				return []string{"bash", "zsh", "fish", "powershell"}
+			}
+			return nil
+		case "install-hook":
+			if len(prev) == 1 && !strings.HasPrefix(cur, "-") {
+				return []string{"pre-commit", "pre-push"}
+			}
+		case "version", "self-update", "merge":
+			return nil
+		}
+	}
+
+	if len(prev) > 0 {
+		last := prev[len(prev)-1]
+		if values, ok := completeFlagValue(ctx, last, prev); ok {
+			return values
+		}
+	}
+
+	if strings.HasPrefix(cur, "-") {
+		return completionFlags()
+	}
+
+	candidates := completePackages(ctx)
+	if len(prev) == 0 {
+		candidates = append(subcommands, candidates...)
+	}
+	return candidates
+}
+
+// completeFlagValue returns the candidates for the value of flag, and
+// whether flag takes a value at all. Values without candidates (files,
+// numbers, refs) return nil, leaving completion to the shell.
+func completeFlagValue(ctx context.Context, flag string, prev []string) ([]string, bool) {
+	switch flag {
+	case "-i", "--ignore", "-ignore", "--only", "-only":
+		return completePackages(ctx), true
+	case "-run", "--run", "-skip", "--skip", "-test.run":
+		return completeTests(ctx, prev, ""), true
+	case "-bench", "--bench":
+		return completeTests(ctx, prev, "Benchmark"), true
+	case "-fuzz", "--fuzz":
+		return completeTests(ctx, prev, "Fuzz"), true
+	case "--profile", "-profile":
+		return configProfiles(), true
+	case "--pprof", "-pprof":
+		var kinds []string
+		for kind := range pprofFlags {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		return kinds, true
+	case "--cgo", "-cgo":
+		return []string{"on", "off"}, true
+	case "--race-covermode", "-race-covermode":
+		return []string{"atomic", "set"}, true
+	case "--fmt-tool", "-fmt-tool":
+		return []string{"gofmt", "gofumpt"}, true
+	case "-covermode", "--covermode":
+		return []string{"set", "count", "atomic"}, true
+	}
+
+	for _, f := range usageFlags() {
+		if f.name == flag {
+			return nil, f.value
+		}
+	}
+	return nil, takesValue(flag)
+}
+
+type usageFlag struct {
+	name  string
+	value bool
+}
+
+// usageFlags returns gotest's flags as listed in the Options section of the
+// usage text
+func usageFlags() []usageFlag {
+	var flags []usageFlag
+	_, options, _ := strings.Cut(usage, "\nOptions:\n")
+	options, _, _ = strings.Cut(options, "\n\n")
+	for _, line := range strings.Split(options, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "-") {
+			continue
+		}
+		spec, _, _ := strings.Cut(line, "  ")
+		// The value is only shown once: "-C, --chdir <dir>"
+		_, arg, _ := strings.Cut(spec, " <")
+		for _, name := range strings.Split(spec, ", ") {
+			name, _, _ = strings.Cut(name, " ")
+			if base, _, ok := strings.Cut(name, "["); ok {
+				// --in-docker[=image] only takes its value with "="
+				flags = append(flags, usageFlag{name: base})
+				continue
+			}
+			flags = append(flags, usageFlag{name: name, value: arg != ""})
+		}
+	}
+	return flags
+}
+
+// completionFlags returns gotest's own flags followed by go test's
+func completionFlags() []string {
+	var flags []string
+	for _, f := range usageFlags() {
+		flags = append(flags, f.name)
+	}
+	var goFlags []string
+	for name, spec := range goTestFlags {
+		if spec.conflict == "" {
+			goFlags = append(goFlags, "-"+name)
+		}
+	}
+	sort.Strings(goFlags)
+	return append(flags, goFlags...)
+}
+
+// completePackages returns the discovered package directories, each also as
+// a "/..." pattern if it has subpackages
+func completePackages(ctx context.Context) []string {
+	if err := loadCompletionIgnoreRules(); err != nil {
+		return nil
+	}
+	packages, err := findGoPackages(ctx, ".")
+	if err != nil {
+		return nil
+	}
+	var candidates []string
+	seen := make(map[string]bool)
+	for _, pkg := range packages {
+		candidates = append(candidates, pkg)
+		rel, ok := strings.CutPrefix(pkg, "./")
+		if !ok {
+			continue
+		}
+		for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+			if !seen[dir] {
+				seen[dir] = true
+				candidates = append(candidates, "./"+dir+"/...")
+			}
+		}
+	}
+	candidates = append(candidates, "./...")
+	sort.Strings(candidates)
+	return candidates
+}
+
+func loadCompletionIgnoreRules() error {
+	rules, err := discover.LoadIgnoreFile(discover.IgnoreFileName)
+	ignoreRules = rules
+	return err
+}
+
+// completeTests returns the test, benchmark, fuzz and example names with
+// the given prefix of the packages named on the command line, or of all
+// packages
+func completeTests(ctx context.Context, prev []string, prefix string) []string {
+	tests, err := listTests(ctx)
+	if err != nil {
+		return nil
+	}
+
+	var patterns []string
+	for i := 0; i < len(prev); i++ {
+		if strings.HasPrefix(prev[i], "-") {
+			if takesValue(prev[i]) && i+1 < len(prev) {
+				i++
+			}
+			continue
+		}
+		if strings.HasPrefix(prev[i], ".") {
+			patterns = append(patterns, prev[i])
+		}
+	}
+
+	seen := make(map[string]bool)
+	var names []string
+	for _, t := range tests {
+		if !strings.HasPrefix(t.name, prefix) || len(patterns) > 0 && !matchesAnyPattern(t.pkg, patterns) {
+			continue
+		}
+		if !seen[t.name] {
+			seen[t.name] = true
+			names = append(names, t.name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func matchesAnyPattern(pkg string, patterns []string) bool {
+	for _, p := range patterns {
+		if base, ok := strings.CutSuffix(p, "/..."); ok {
+			if pkg == base || strings.HasPrefix(pkg, base+"/") || base == "." {
+				return true
+			}
+		} else if filepath.Clean(p) == filepath.Clean(pkg) {
+			return true
+		}
+	}
+	return false
+}
+
+type listedTest struct {
+	pkg  string
+	name string
+}
+
+// listTests returns the tests of all packages, from "go test -list". The
+// result is cached per directory until a test file changes, since listing
+// compiles every test binary.
+func listTests(ctx context.Context) ([]listedTest, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(cwd))
+	cache := filepath.Join(cacheDir, "gotest", "tests-"+hex.EncodeToString(sum[:8])+".txt")
+
+	if info, err := os.Stat(cache); err == nil && !testFilesChangedSince(info.ModTime()) {
+		if tests, err := readTestCache(cache); err == nil {
+			return tests, nil
+		}
+	}
+
+	if err := loadCompletionIgnoreRules(); err != nil {
+		return nil, err
+	}
+	packages, err := findGoPackages(ctx, ".")
+	if err != nil {
+		return nil, err
+	}
+	var tests []listedTest
+	var lines []string
+	for _, pkg := range packages {
+		// One package at a time maps names to packages; go test -list
+		// prints only "ok" lines with the import path
+		out, _ := goCommandContext(ctx, append([]string{"test", "-list", "."}, pkg)...).Output()
+		for _, name := range strings.Split(string(out), "\n") {
+			if name == "" || strings.ContainsAny(name, " \t") {
+				continue
+			}
+			tests = append(tests, listedTest{pkg: pkg, name: name})
+			lines = append(lines, pkg+"\t"+name)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cache), 0755); err == nil {
+		os.WriteFile(cache, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+	}
+	return tests, nil
+}
+
+func readTestCache(path string) ([]listedTest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var tests []listedTest
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if pkg, name, ok := strings.Cut(scanner.Text(), "\t"); ok {
+			tests = append(tests, listedTest{pkg: pkg, name: name})
+		}
+	}
+	return tests, scanner.Err()
+}
+
+// testFilesChangedSince reports whether a _test.go file below the current
+// directory was modified after t
+func testFilesChangedSince(t time.Time) bool {
+	changed := false
+	filepath.WalkDir(".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || changed {
+			return filepath.SkipDir
+		}
+		if d.IsDir() {
+			if path != "." && (strings.HasPrefix(d.Name(), ".") || d.Name() == "vendor" || d.Name() == "testdata") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(path, "_test.go") {
+			if info, err := d.Info(); err == nil && info.ModTime().After(t) {
+				changed = true
+			}
+		}
+		return nil
+	})
+	return changed
+}
+
+// configProfiles returns the profile names of the config file
+func configProfiles() []string {
+	cfg, err := loadConfig(configFileName, false)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for name := range cfg.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
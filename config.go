@@ -0,0 +1,448 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// configFileName is the config file read from the current directory
+const configFileName = ".gotest.yaml"
+
+// config holds the settings read from the config file. Profiles override
+// the top-level settings and are selected with --profile.
+type config struct {
+	Env      map[string]string
+	GoEnv    map[string]string
+	GoFlags  string
+	VetFirst *bool
+	VetFail  *bool
+	Lint     *bool
+	FmtCheck *bool
+	FmtFail  *bool
+	FmtTool  string
+	Generate *bool
+	Plugins  []string
+	// NewSince and NewMin are the coverage policy for new packages
+	NewSince string
+	NewMin   string
+	// HistoryKeep and HistoryKeepRuns are the history retention
+	HistoryKeep     string
+	HistoryKeepRuns string
+	// TagVariants maps build tag variant names to their tags
+	TagVariants map[string]string
+	Profiles    map[string]*config
+	// Suites are run with "gotest suite"
+	Suites map[string]*suiteConfig
+}
+
+// loadConfig reads the config file at path. A missing file is only an error
+// when it was named explicitly.
+func loadConfig(path string, explicit bool) (*config, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return &config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := parseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	return decodeConfig(doc, "")
+}
+
+// decodeConfig converts a parsed YAML document into a config
+func decodeConfig(doc any, prefix string) (*config, error) {
+	fields, err := yamlMap(doc, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &config{}
+	for key, value := range fields {
+		name := prefix + key
+		switch key {
+		case "env":
+			if cfg.Env, err = yamlStringMap(value, name); err != nil {
+				return nil, err
+			}
+		case "goenv":
+			if cfg.GoEnv, err = yamlStringMap(value, name); err != nil {
+				return nil, err
+			}
+		case "goflags":
+			if cfg.GoFlags, err = yamlString(value, name); err != nil {
+				return nil, err
+			}
+		case "vet_first":
+			if cfg.VetFirst, err = yamlBool(value, name); err != nil {
+				return nil, err
+			}
+		case "vet_fail_fast":
+			if cfg.VetFail, err = yamlBool(value, name); err != nil {
+				return nil, err
+			}
+		case "lint":
+			if cfg.Lint, err = yamlBool(value, name); err != nil {
+				return nil, err
+			}
+		case "fmt_check":
+			if cfg.FmtCheck, err = yamlBool(value, name); err != nil {
+				return nil, err
+			}
+		case "fmt_fail":
+			if cfg.FmtFail, err = yamlBool(value, name); err != nil {
+				return nil, err
+			}
+		case "fmt_tool":
+			if cfg.FmtTool, err = yamlString(value, name); err != nil {
+				return nil, err
+			}
+		case "generate":
+			if cfg.Generate, err = yamlBool(value, name); err != nil {
+				return nil, err
+			}
+		case "plugins":
+			if cfg.Plugins, err = yamlStringList(value, name); err != nil {
+				return nil, err
+			}
+		case "new_packages":
+			policy, err := yamlStringMap(value, name)
+			if err != nil {
+				return nil, err
+			}
+			for k, v := range policy {
+				switch k {
+				case "since":
+					cfg.NewSince = v
+				case "min_coverage":
+					cfg.NewMin = v
+				default:
+					return nil, fmt.Errorf("unknown setting %q", name+"."+k)
+				}
+			}
+		case "history":
+			policy, err := yamlStringMap(value, name)
+			if err != nil {
+				return nil, err
+			}
+			for k, v := range policy {
+				switch k {
+				case "keep":
+					if _, err := parseRetention(v); err != nil {
+						return nil, fmt.Errorf("%s.%s: %w", name, k, err)
+					}
+					cfg.HistoryKeep = v
+				case "keep_runs":
+					if _, err := parseKeepRuns(v); err != nil {
+						return nil, fmt.Errorf("%s.%s: %w", name, k, err)
+					}
+					cfg.HistoryKeepRuns = v
+				default:
+					return nil, fmt.Errorf("unknown setting %q", name+"."+k)
+				}
+			}
+		case "tag_variants":
+			if cfg.TagVariants, err = yamlStringMap(value, name); err != nil {
+				return nil, err
+			}
+		case "suites":
+			if prefix != "" {
+				return nil, fmt.Errorf("%s: suites can only be defined at the top level", name)
+			}
+			suites, err := yamlMap(value, name)
+			if err != nil {
+				return nil, err
+			}
+			cfg.Suites = make(map[string]*suiteConfig)
+			for suite, body := range suites {
+				if cfg.Suites[suite], err = decodeSuite(body, name+"."+suite); err != nil {
+					return nil, err
+				}
+			}
+		case "profiles":
+			if prefix != "" {
+				return nil, fmt.Errorf("%s: profiles can't be nested", name)
+			}
+			profiles, err := yamlMap(value, name)
+			if err != nil {
+				return nil, err
+			}
+			cfg.Profiles = make(map[string]*config)
+			for profile, body := range profiles {
+				if cfg.Profiles[profile], err = decodeConfig(body, name+"."+profile+"."); err != nil {
+					return nil, err
+				}
+			}
+		default:
+			return nil, fmt.Errorf("unknown setting %q", name)
+		}
+	}
+	return cfg, nil
+}
+
+// profile returns the config with the named profile applied on top
+func (c *config) profile(name string) (*config, error) {
+	if name == "" {
+		return c, nil
+	}
+	p, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q", name)
+	}
+
+	merged := &config{
+		Env:     mergeMaps(c.Env, p.Env),
+		GoEnv:   mergeMaps(c.GoEnv, p.GoEnv),
+		GoFlags: c.GoFlags,
+
+		TagVariants: mergeMaps(c.TagVariants, p.TagVariants),
+	}
+	if p.GoFlags != "" {
+		merged.GoFlags = p.GoFlags
+	}
+	merged.VetFirst = mergeBool(c.VetFirst, p.VetFirst)
+	merged.VetFail = mergeBool(c.VetFail, p.VetFail)
+	merged.Lint = mergeBool(c.Lint, p.Lint)
+	merged.FmtCheck = mergeBool(c.FmtCheck, p.FmtCheck)
+	merged.FmtFail = mergeBool(c.FmtFail, p.FmtFail)
+	merged.Generate = mergeBool(c.Generate, p.Generate)
+	merged.Plugins = append(append([]string(nil), c.Plugins...), p.Plugins...)
+	merged.FmtTool = c.FmtTool
+	if p.FmtTool != "" {
+		merged.FmtTool = p.FmtTool
+	}
+	merged.NewSince, merged.NewMin = c.NewSince, c.NewMin
+	if p.NewSince != "" {
+		merged.NewSince = p.NewSince
+	}
+	if p.NewMin != "" {
+		merged.NewMin = p.NewMin
+	}
+	merged.HistoryKeep, merged.HistoryKeepRuns = c.HistoryKeep, c.HistoryKeepRuns
+	if p.HistoryKeep != "" {
+		merged.HistoryKeep = p.HistoryKeep
+	}
+	if p.HistoryKeepRuns != "" {
+		merged.HistoryKeepRuns = p.HistoryKeepRuns
+	}
+	return merged, nil
+}
+
+// mergeMaps returns a copy of base with the entries of override applied
+func mergeMaps[V any](base, override map[string]V) map[string]V {
+	merged := make(map[string]V)
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		merged[k] = v
+	}
+	return merged
+}
+
+// yamlMap asserts that a YAML value is a mapping
+func yamlMap(value any, name string) (map[string]any, error) {
+	if value == nil {
+		return map[string]any{}, nil
+	}
+	m, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: expected a mapping", strings.TrimSuffix(name, "."))
+	}
+	return m, nil
+}
+
+// mergeBool returns override if it was set, otherwise base
+func mergeBool(base, override *bool) *bool {
+	if override != nil {
+		return override
+	}
+	return base
+}
+
+// yamlBool asserts that a YAML value is a boolean
+func yamlBool(value any, name string) (*bool, error) {
+	s, _ := value.(string)
+	var b bool
+	switch strings.ToLower(s) {
+	case "true", "yes", "on":
+		b = true
+	case "false", "no", "off":
+		b = false
+	default:
+		return nil, fmt.Errorf("%s: expected true or false", name)
+	}
+	return &b, nil
+}
+
+// yamlString asserts that a YAML value is a scalar
+func yamlString(value any, name string) (string, error) {
+	if value == nil {
+		return "", nil
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("%s: expected a string", name)
+	}
+	return s, nil
+}
+
+// yamlStringList asserts that a YAML value is a sequence of scalars; a
+// single scalar is a list of one
+func yamlStringList(value any, name string) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []any:
+		var out []string
+		for i, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s[%d]: expected a string", name, i)
+			}
+			out = append(out, s)
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("%s: expected a list of strings", name)
+}
+
+// yamlStringMap asserts that a YAML value is a mapping of scalars
+func yamlStringMap(value any, name string) (map[string]string, error) {
+	m, err := yamlMap(value, name)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]string)
+	for k, v := range m {
+		s, ok := v.(string)
+		if !ok && v != nil {
+			return nil, fmt.Errorf("%s.%s: expected a string", name, k)
+		}
+		out[k] = s
+	}
+	return out, nil
+}
+
+// applyConfig loads the config file and selected profile and merges their
+// settings with the command-line flags, which take precedence
+func applyConfig() error {
+	path := configFile
+	if path == "" {
+		path = configFileName
+	}
+	cfg, err := loadConfig(path, configFile != "")
+	if err != nil {
+		return fmt.Errorf("reading config %s: %w", path, err)
+	}
+	if cfg, err = cfg.profile(profileName); err != nil {
+		return fmt.Errorf("config %s: %w", path, err)
+	}
+	if profileName != "" {
+		debugf("using config %s, profile %s", path, profileName)
+	}
+
+	for k, v := range cfg.Env {
+		testEnv[k] = v
+	}
+	for k, v := range envFlags {
+		testEnv[k] = v
+	}
+
+	for k, v := range cfg.GoEnv {
+		goEnv[k] = v
+	}
+	if cfg.GoFlags != "" {
+		goEnv["GOFLAGS"] = cfg.GoFlags
+	}
+	for k, v := range goEnvFlags {
+		goEnv[k] = v
+	}
+	if goFlags != "" {
+		goEnv["GOFLAGS"] = goFlags
+	}
+
+	// Boolean settings can only be switched on by flags
+	if cfg.VetFirst != nil && *cfg.VetFirst {
+		vetFirst = true
+	}
+	if cfg.VetFail != nil && *cfg.VetFail {
+		vetFailFast = true
+	}
+	if cfg.Lint != nil && *cfg.Lint {
+		lint = true
+	}
+	if cfg.FmtCheck != nil && *cfg.FmtCheck {
+		fmtCheck = true
+	}
+	if cfg.FmtFail != nil && *cfg.FmtFail {
+		fmtCheck = true
+		fmtFail = true
+	}
+	if cfg.Generate != nil && *cfg.Generate {
+		generate = true
+	}
+	plugins = cfg.Plugins
+	tagVariants = cfg.TagVariants
+	if newSince == "" {
+		newSince = cfg.NewSince
+	}
+	// An explicit 0 turns the policy's coverage requirement off
+	if !newPackageMinSet {
+		newPackageMin = defaultNewPackageMin
+		if cfg.NewMin != "" {
+			n, err := parsePercent(cfg.NewMin)
+			if err != nil {
+				return fmt.Errorf("config %s: new_packages.min_coverage: %w", path, err)
+			}
+			newPackageMin = n
+		}
+	}
+	// Both were validated when the config was read
+	historyKeep, historyKeepRuns = 0, 0
+	if cfg.HistoryKeep != "" {
+		historyKeep, _ = parseRetention(cfg.HistoryKeep)
+	}
+	if cfg.HistoryKeepRuns != "" {
+		historyKeepRuns, _ = parseKeepRuns(cfg.HistoryKeepRuns)
+	}
+	if fmtTool == "" {
+		fmtTool = cfg.FmtTool
+	}
+	if fmtTool == "" {
+		fmtTool = "gofmt"
+	}
+	return nil
+}
+
+// testEnv holds the extra environment for go test processes
+var testEnv = make(map[string]string)
+
+// plugins are the reporter executables from the config file
+var plugins []string
+
+// parsePercent parses a percentage such as "80" or "80%"
+func parsePercent(value string) (float64, error) {
+	n, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "%"), 64)
+	if err != nil || n < 0 || n > 100 {
+		return 0, fmt.Errorf("invalid percentage %q", value)
+	}
+	return n, nil
+}
+
+// parseEnvAssignment parses a KEY=VALUE pair
+func parseEnvAssignment(value string) (string, string, error) {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return "", "", fmt.Errorf("invalid environment assignment %q (expected KEY=VALUE)", value)
+	}
+	return key, val, nil
+}
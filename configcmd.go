@@ -0,0 +1,297 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// starterConfig is written by "gotest config init"
+const starterConfig = `# gotest configuration; see https://github.com/Hoofffman/gotest#configuration
+# Command-line flags take precedence over these settings.
+
+# Environment for the go test processes (${VAR} is expanded)
+# env:
+#   LOG_LEVEL: debug
+
+# Environment and GOFLAGS for every go command gotest runs
+# goenv:
+#   CGO_ENABLED: "0"
+# goflags: -mod=vendor
+
+# Run go vet before the tests, and stop if it fails
+# vet_first: true
+# vet_fail_fast: true
+
+# Run golangci-lint before the tests
+# lint: true
+
+# Report unformatted files, and fail the run because of them
+# fmt_check: true
+# fmt_fail: true
+# fmt_tool: gofumpt
+
+# Run go generate before the tests, and fail if it changes tracked files
+# generate: true
+
+# Executables that receive a JSON summary of every run on stdin
+# plugins:
+#   - ./scripts/upload-coverage
+
+# Packages added after this date or git ref must reach min_coverage
+# new_packages:
+#   since: 2024-01-01
+#   min_coverage: 80%
+
+# Run history retention: runs older than keep, and all but the last
+# keep_runs runs, are pruned after every run, with their artifacts
+# history:
+#   keep: 90d
+#   keep_runs: 500
+
+# Build tag variants, each tested in turn with its coverage merged
+# tag_variants:
+#   default: ""
+#   integration: integration
+#   windows-stubs: windows,stubs
+
+# Test suites, run with "gotest suite <name>" or "gotest suite --all"
+# suites:
+#   integration:
+#     packages: [./internal/store/...]
+#     tags: integration
+#     env:
+#       DATABASE_URL: postgres://localhost/app_test
+#     timeout: 5m
+#     before: [docker compose up -d]
+#     wait_for:
+#       - tcp: localhost:5432
+#       - http: http://localhost:8080/healthz
+#     wait_timeout: 90s
+#     after: [docker compose down]
+
+# Settings applied on top of the ones above with --profile <name>
+# profiles:
+#   ci:
+#     vet_fail_fast: true
+#     fmt_fail: true
+`
+
+// runConfig implements "gotest config show|init"
+func runConfig(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: gotest config show [options] | gotest config init [--force]")
+	}
+	switch args[0] {
+	case "show":
+		return runConfigShow(args[1:])
+	case "init":
+		return runConfigInit(args[1:])
+	}
+	return fmt.Errorf("unknown config command %q (expected show or init)", args[0])
+}
+
+// runConfigInit writes a commented starter config file
+func runConfigInit(args []string) error {
+	force := false
+	for _, arg := range args {
+		if arg != "--force" && arg != "-force" {
+			return fmt.Errorf("usage: gotest config init [--force]")
+		}
+		force = true
+	}
+	if _, err := os.Stat(configFileName); err == nil && !force {
+		return fmt.Errorf("%s already exists (use --force to overwrite it)", configFileName)
+	}
+	if err := os.WriteFile(configFileName, []byte(starterConfig), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s\n", configFileName)
+	return nil
+}
+
+// configLine is one line of "gotest config show" and where its value came from
+type configLine struct {
+	text   string
+	origin string
+}
+
+// runConfigShow prints the effective settings after merging the config
+// file, the selected profile, the environment and the command-line flags,
+// as YAML annotated with the origin of each value
+func runConfigShow(args []string) error {
+	parseFlags(args)
+	if chdir != "" {
+		if err := os.Chdir(chdir); err != nil {
+			return withExitCode(exitToolError, fmt.Errorf("changing directory: %w", err))
+		}
+	}
+
+	path := configFile
+	if path == "" {
+		path = configFileName
+	}
+	base, err := loadConfig(path, configFile != "")
+	if err != nil {
+		return fmt.Errorf("reading config %s: %w", path, err)
+	}
+	prof := &config{}
+	if profileName != "" {
+		p, ok := base.Profiles[profileName]
+		if !ok {
+			return fmt.Errorf("config %s: unknown profile %q", path, profileName)
+		}
+		prof = p
+	}
+
+	// Flags are parsed before the config is applied, so remember which
+	// settings they made
+	flagEnv, flagGoEnv := mergeMaps(nil, envFlags), mergeMaps(nil, goEnvFlags)
+	flagGoFlags, flagSince, flagFmtTool := goFlags, newSince, fmtTool
+	flagBools := map[string]bool{"vet_first": vetFirst, "vet_fail_fast": vetFailFast, "lint": lint, "fmt_check": fmtCheck, "fmt_fail": fmtFail, "generate": generate}
+	if err := applyConfig(); err != nil {
+		return err
+	}
+
+	fileOrigin := path
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		fileOrigin = "(no config file)"
+	}
+	profileOrigin := fmt.Sprintf("%s, profile %s", path, profileName)
+	origin := func(flag, inProfile, inFile bool) string {
+		switch {
+		case flag:
+			return "command line"
+		case inProfile:
+			return profileOrigin
+		case inFile:
+			return fileOrigin
+		}
+		return "default"
+	}
+
+	var lines []configLine
+	add := func(text, from string) { lines = append(lines, configLine{text, from}) }
+
+	addMap := func(key string, values, flags, profile, file map[string]string) {
+		if len(values) == 0 {
+			add(key+":", "default")
+			return
+		}
+		add(key+":", "")
+		for _, k := range sortedKeys(values) {
+			_, inFlag := flags[k]
+			_, inProfile := profile[k]
+			_, inFile := file[k]
+			add("  "+k+": "+yamlQuote(values[k]), origin(inFlag, inProfile, inFile))
+		}
+	}
+	addMap("env", testEnv, flagEnv, prof.Env, base.Env)
+	goEnvValues := mergeMaps(nil, goEnv)
+	delete(goEnvValues, "GOFLAGS")
+	addMap("goenv", goEnvValues, flagGoEnv, prof.GoEnv, base.GoEnv)
+
+	switch {
+	case goEnv["GOFLAGS"] != "":
+		add("goflags: "+yamlQuote(goEnv["GOFLAGS"]), origin(flagGoFlags != "" || flagGoEnv["GOFLAGS"] != "", prof.GoFlags != "" || prof.GoEnv["GOFLAGS"] != "", true))
+	case os.Getenv("GOFLAGS") != "":
+		add("goflags: "+yamlQuote(os.Getenv("GOFLAGS")), "environment ($GOFLAGS)")
+	default:
+		add(`goflags: ""`, "default")
+	}
+
+	bools := []struct {
+		key         string
+		value       bool
+		profile     *bool
+		file        *bool
+		impliedFrom string
+	}{
+		{"vet_first", vetFirst, prof.VetFirst, base.VetFirst, "vet_fail_fast"},
+		{"vet_fail_fast", vetFailFast, prof.VetFail, base.VetFail, ""},
+		{"lint", lint, prof.Lint, base.Lint, ""},
+		{"fmt_check", fmtCheck, prof.FmtCheck, base.FmtCheck, "fmt_fail"},
+		{"fmt_fail", fmtFail, prof.FmtFail, base.FmtFail, ""},
+		{"generate", generate, prof.Generate, base.Generate, ""},
+	}
+	for _, b := range bools {
+		from := origin(flagBools[b.key], b.profile != nil, b.file != nil)
+		if b.value && from == "default" && b.impliedFrom != "" {
+			from = "implied by " + b.impliedFrom
+		}
+		add(b.key+": "+strconv.FormatBool(b.value), from)
+	}
+	add("fmt_tool: "+yamlQuote(fmtTool), origin(flagFmtTool != "", prof.FmtTool != "", base.FmtTool != ""))
+
+	if len(plugins) == 0 {
+		add("plugins: []", "default")
+	} else {
+		add("plugins:", "")
+		for i, p := range plugins {
+			from := fileOrigin
+			if i >= len(base.Plugins) {
+				from = profileOrigin
+			}
+			add("  - "+yamlQuote(p), from)
+		}
+	}
+
+	addMap("tag_variants", tagVariants, nil, prof.TagVariants, base.TagVariants)
+
+	add("new_packages:", "")
+	add("  since: "+yamlQuote(newSince), origin(flagSince != "", prof.NewSince != "", base.NewSince != ""))
+	add("  min_coverage: "+strconv.FormatFloat(newPackageMin, 'f', -1, 64)+"%", origin(newPackageMinSet, prof.NewMin != "", base.NewMin != ""))
+
+	add("history:", "")
+	add("  keep: "+yamlQuote(cfgOr(prof.HistoryKeep, base.HistoryKeep)), origin(false, prof.HistoryKeep != "", base.HistoryKeep != ""))
+	add("  keep_runs: "+yamlQuote(cfgOr(prof.HistoryKeepRuns, base.HistoryKeepRuns)), origin(false, prof.HistoryKeepRuns != "", base.HistoryKeepRuns != ""))
+
+	width := 0
+	for _, l := range lines {
+		width = max(width, len(l.text))
+	}
+	if profileName != "" {
+		fmt.Printf("# Effective configuration (%s, profile %s)\n", path, profileName)
+	} else {
+		fmt.Printf("# Effective configuration (%s)\n", path)
+	}
+	for _, l := range lines {
+		if l.origin == "" {
+			fmt.Println(l.text)
+			continue
+		}
+		fmt.Printf("%-*s  # %s\n", width, l.text, l.origin)
+	}
+	return nil
+}
+
+// yamlQuote quotes a scalar if the config parser would not read it back as
+// the same plain string
+func yamlQuote(s string) string {
+	if s == "" || s != strings.TrimSpace(s) || strings.ContainsAny(s, "#:\"'[]{}") || s == "~" || s == "null" || strings.HasPrefix(s, "- ") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// cfgOr returns the profile's value of a setting if it has one, otherwise
+// the file's
+func cfgOr(profile, file string) string {
+	if profile != "" {
+		return profile
+	}
+	return file
+}
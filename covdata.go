@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/Hoofffman/gotest/pkg/coverprofile"
+)
+
+// coverDirs are GOCOVERDIR directories written by binaries built with
+// -cover, such as the server of an integration test, whose coverage is
+// added to the run's profile (--coverdir)
+var coverDirs []string
+
+// byFunc lists the coverage of every function (--by-func)
+var byFunc bool
+
+// mergeCoverDirs adds the coverage data in dirs to the profile, converted
+// with go tool covdata textfmt. It returns the profiles of the tests and of
+// the binaries before merging.
+func mergeCoverDirs(ctx context.Context, dirs []string, coverProfile string) (tests, binaries *coverprofile.Profile, err error) {
+	tests, err = coverprofile.ParseFile(ctx, coverProfile)
+	if err != nil {
+		return nil, nil, err
+	}
+	tmp, err := os.CreateTemp("", "gotest-covdata-*.out")
+	if err != nil {
+		return nil, nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	cmd := goCommandContext(ctx, "tool", "covdata", "textfmt", "-i="+strings.Join(dirs, ","), "-o="+tmp.Name())
+	debugf("converting binary coverage: %s", strings.Join(cmd.Args, " "))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, nil, fmt.Errorf("go tool covdata: %v\n%s", err, out)
+	}
+	binaries, err = coverprofile.ParseFile(ctx, tmp.Name())
+	if err != nil {
+		return nil, nil, err
+	}
+	if binaries.Mode != tests.Mode {
+		warnf("the binaries were built with -covermode=%s, the tests ran with %s; merging in %s mode", binaries.Mode, tests.Mode, coverprofile.MergedMode(tests.Mode, binaries.Mode))
+	}
+	if err := coverprofile.Merge(tests, binaries).WriteFile(coverProfile); err != nil {
+		return nil, nil, err
+	}
+	return tests, binaries, nil
+}
+
+// funcCoverage is the statement coverage of one function
+type funcCoverage struct {
+	Name       string
+	File       string
+	Line       int
+	Statements int
+	Covered    int
+}
+
+func (f funcCoverage) Percent() float64 {
+	return coverprofile.PackageStats{Statements: f.Statements, Covered: f.Covered}.Percent()
+}
+
+// functionCoverage computes the coverage of every function in the files of
+// the profile, like go tool cover -func: a block belongs to the function
+// it starts in. Files that can't be found or parsed are left out.
+func functionCoverage(profile *coverprofile.Profile, dirs map[string]string) []funcCoverage {
+	byFile := make(map[string][]coverprofile.Block)
+	for _, b := range profile.Blocks {
+		byFile[b.File] = append(byFile[b.File], b)
+	}
+
+	var funcs []funcCoverage
+	fset := token.NewFileSet()
+	for _, name := range sortedKeys(byFile) {
+		file, err := parser.ParseFile(fset, sourcePath(name, dirs), nil, parser.SkipObjectResolution)
+		if err != nil {
+			continue
+		}
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+			start, end := fset.Position(fn.Pos()), fset.Position(fn.End())
+			f := funcCoverage{Name: funcName(fn), File: name, Line: start.Line}
+			for _, b := range byFile[name] {
+				if before(b.StartLine, b.StartCol, start) || !before(b.StartLine, b.StartCol, end) {
+					continue
+				}
+				f.Statements += b.NumStmt
+				if b.Count > 0 {
+					f.Covered += b.NumStmt
+				}
+			}
+			funcs = append(funcs, f)
+		}
+	}
+	return funcs
+}
+
+// before reports whether line and column come before pos
+func before(line, col int, pos token.Position) bool {
+	return line < pos.Line || line == pos.Line && col < pos.Column
+}
+
+// printFunctionCoverage lists the coverage of every function. With the
+// profile of instrumented binaries, the coverage by the tests and by the
+// binaries is shown next to the combined coverage.
+func printFunctionCoverage(ctx context.Context, coverProfile string, tests, binaries *coverprofile.Profile) error {
+	dirs, err := packageDirs(ctx)
+	if err != nil {
+		return err
+	}
+	total, err := coverprofile.ParseFile(ctx, coverProfile)
+	if err != nil {
+		return err
+	}
+	funcs := functionCoverage(total, dirs)
+	if len(funcs) == 0 {
+		return nil
+	}
+	sort.SliceStable(funcs, func(i, j int) bool { return localPath(funcs[i].File) < localPath(funcs[j].File) })
+
+	// Coverage by source position, for the tests and binaries columns
+	byPos := func(p *coverprofile.Profile) map[string]funcCoverage {
+		m := make(map[string]funcCoverage)
+		for _, f := range functionCoverage(p, dirs) {
+			m[fmt.Sprintf("%s:%d", f.File, f.Line)] = f
+		}
+		return m
+	}
+	var testFuncs, binaryFuncs map[string]funcCoverage
+	if binaries != nil {
+		testFuncs, binaryFuncs = byPos(tests), byPos(binaries)
+	}
+
+	positions := make([]string, len(funcs))
+	posCol, nameCol := len("FUNCTION"), 0
+	for i, f := range funcs {
+		positions[i] = fmt.Sprintf("%s:%d", localPath(f.File), f.Line)
+		posCol = max(posCol, len(positions[i]))
+		nameCol = max(nameCol, len(f.Name))
+	}
+	posCol = min(posCol, max(terminalWidth()-nameCol-30, 30))
+
+	fmt.Println()
+	fmt.Println(strings.Repeat("=", 60))
+	fmt.Println("FUNCTION COVERAGE")
+	fmt.Println(strings.Repeat("=", 60))
+	if binaries != nil {
+		fmt.Printf("%-*s  %-*s %8s %9s %8s\n", posCol, "FUNCTION", nameCol, "", "TESTS", "BINARIES", "TOTAL")
+	}
+	pct := func(f funcCoverage, ok bool) string {
+		if !ok || f.Statements == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.1f%%", f.Percent())
+	}
+	for i, f := range funcs {
+		pos := middleEllipsis(positions[i], posCol)
+		if binaries == nil {
+			fmt.Printf("%-*s  %-*s %8s\n", posCol, pos, nameCol, f.Name, pct(f, true))
+			continue
+		}
+		key := fmt.Sprintf("%s:%d", f.File, f.Line)
+		t, tok := testFuncs[key]
+		b, bok := binaryFuncs[key]
+		fmt.Printf("%-*s  %-*s %8s %9s %8s\n", posCol, pos, nameCol, f.Name, pct(t, tok), pct(b, bok), pct(f, true))
+	}
+	fmt.Println(strings.Repeat("=", 60))
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// defaultPlatforms are checked by crosscheck when --platforms isn't given
+var defaultPlatforms = []string{"linux/amd64", "darwin/arm64", "windows/amd64"}
+
+// platformResult holds the compile results for one GOOS/GOARCH pair
+type platformResult struct {
+	Platform string
+	BuildErr error
+	BuildLog string
+	VetErr   error
+	VetLog   string
+}
+
+// runCrossCheck compile-checks the packages for each platform. go build
+// covers the package sources and go vet type-checks the test files as well.
+func runCrossCheck(packages []string) error {
+	if len(packages) == 0 {
+		return nil
+	}
+
+	targets := platforms
+	if len(targets) == 0 {
+		targets = defaultPlatforms
+	}
+
+	var results []platformResult
+	for _, platform := range targets {
+		goos, goarch, ok := strings.Cut(platform, "/")
+		if !ok || goos == "" || goarch == "" {
+			return fmt.Errorf("invalid platform %q (expected GOOS/GOARCH)", platform)
+		}
+
+		res := platformResult{Platform: platform}
+		res.BuildLog, res.BuildErr = runForPlatform(goos, goarch, "build", packages)
+		res.VetLog, res.VetErr = runForPlatform(goos, goarch, "vet", packages)
+		results = append(results, res)
+	}
+
+	fmt.Println()
+	fmt.Printf("%-24s %-8s %s\n", "PLATFORM", "BUILD", "VET")
+	fmt.Println(strings.Repeat("-", 42))
+	var failed int
+	for _, res := range results {
+		if res.BuildErr != nil || res.VetErr != nil {
+			failed++
+		}
+		fmt.Printf("%-24s %-8s %s\n", res.Platform, status(res.BuildErr), status(res.VetErr))
+	}
+
+	for _, res := range results {
+		if res.BuildErr == nil && res.VetErr == nil {
+			continue
+		}
+		fmt.Printf("\n--- %s ---\n", res.Platform)
+		if res.BuildErr != nil {
+			fmt.Println(strings.TrimRight(res.BuildLog, "\n"))
+		}
+		// With a broken build, vet repeats the same compile errors
+		if res.VetErr != nil && res.BuildErr == nil {
+			fmt.Println(strings.TrimRight(res.VetLog, "\n"))
+		}
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "\n%d of %d platform(s) failed\n", failed, len(results))
+		return withExitCode(exitBuildFailed, fmt.Errorf("crosscheck failed"))
+	}
+
+	fmt.Printf("\nAll %d platform(s) compile\n", len(results))
+	return nil
+}
+
+// runForPlatform runs a go subcommand on the packages for GOOS/GOARCH
+func runForPlatform(goos, goarch, subcommand string, packages []string) (string, error) {
+	args := []string{subcommand}
+	if buildTags != "" {
+		args = append(args, "-tags="+buildTags)
+	}
+	args = append(args, packages...)
+
+	if verbose {
+		fmt.Printf("Running: GOOS=%s GOARCH=%s go %s\n", goos, goarch, strings.Join(args, " "))
+	}
+
+	var output bytes.Buffer
+	cmd := goCommand(args...)
+	cmd.Env = append(cmd.Env, "GOOS="+goos, "GOARCH="+goarch)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err := cmd.Run()
+	return output.String(), err
+}
+
+// status renders a step result for the matrix
+func status(err error) string {
+	if err != nil {
+		return "FAIL"
+	}
+	return "ok"
+}
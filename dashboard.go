@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// dashboardRuns is the number of most recent runs the dashboard shows
+const dashboardRuns = 100
+
+type dashboardRun struct {
+	ID       string
+	Started  time.Time
+	Passed   bool
+	Coverage float64
+	Duration time.Duration
+}
+
+type dashboardPackage struct {
+	Name     string
+	Coverage float64 // in the latest run that included it
+	Duration time.Duration
+	// Sparklines of the package's coverage and duration over the runs
+	CoverageTrend template.HTML
+	DurationTrend template.HTML
+}
+
+// dashboardTest is a row of the failure heatmap: one class per run
+type dashboardTest struct {
+	Name     string
+	Failures int
+	Cells    []string
+}
+
+type dashboardData struct {
+	Dir           string
+	Generated     time.Time
+	Runs          []dashboardRun
+	Failed        int
+	CoverageChart template.HTML
+	DurationChart template.HTML
+	Packages      []dashboardPackage
+	Tests         []dashboardTest
+}
+
+// runReport implements "gotest report --history [-o file] [--no-browser]":
+// a static HTML dashboard of the run history, with coverage and durations
+// over time and a heatmap of test failures. With --diff instead, it shows
+// the line coverage of two profiles side by side.
+func runReport(args []string) error {
+	const usageText = "usage: gotest report --history [-o file] [--no-browser]\n       gotest report --diff [--base-ref rev] [-o file] [--no-browser] <base-profile> <head-profile>"
+	out := ""
+	history, diff := false, false
+	var baseRef string
+	var profiles []string
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "--history" || arg == "-history":
+			history = true
+		case arg == "--diff" || arg == "-diff":
+			diff = true
+		case isFlag(arg, "--base-ref", "-base-ref"):
+			baseRef, _ = flagValue(args, &i, "--base-ref", "-base-ref")
+		case isFlag(arg, "-o", "--output", "-output"):
+			out, _ = flagValue(args, &i, "-o", "--output", "-output")
+		case arg == "--no-browser" || arg == "-no-browser":
+			noBrowser = true
+		case diff && !strings.HasPrefix(arg, "-"):
+			profiles = append(profiles, arg)
+		default:
+			return withExitCode(exitToolError, fmt.Errorf("unknown argument %s\n%s", arg, usageText))
+		}
+	}
+	if history == diff || (diff && len(profiles) != 2) {
+		return withExitCode(exitToolError, fmt.Errorf(usageText))
+	}
+	if diff {
+		if out == "" {
+			out = "/tmp/coverage-diff.html"
+		}
+		data, err := writeCoverageDiff(context.Background(), out, profiles[0], profiles[1], baseRef)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Coverage %.1f%% -> %.1f%%: %d line(s) gained coverage, %d lost it\n", data.Base.Percent(), data.Head.Percent(), data.Gained, data.Lost)
+		if noBrowser {
+			fmt.Printf("Coverage diff: %s\n", out)
+			return nil
+		}
+		return openReport(out)
+	}
+	if out == "" {
+		out = "/tmp/history.html"
+	}
+
+	runs, err := loadHistory()
+	if err != nil {
+		return fmt.Errorf("reading run history: %w", err)
+	}
+	if len(runs) == 0 {
+		return withExitCode(exitToolError, fmt.Errorf("no runs recorded"))
+	}
+	runs = recentRuns(runs, dashboardRuns)
+
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	if err := dashboardTemplate.Execute(file, buildDashboard(runs)); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if noBrowser {
+		fmt.Printf("History dashboard: %s\n", out)
+		return nil
+	}
+	return openReport(out)
+}
+
+// buildDashboard collects the charts and tables of the dashboard
+func buildDashboard(runs []historyRun) dashboardData {
+	data := dashboardData{Dir: runs[len(runs)-1].Dir, Generated: time.Now()}
+	coverage := make([]float64, len(runs))
+	durations := make([]float64, len(runs))
+	for i, run := range runs {
+		data.Runs = append(data.Runs, dashboardRun{
+			ID:       run.RunID,
+			Started:  run.Started,
+			Passed:   run.Passed,
+			Coverage: run.Coverage.Percent,
+			Duration: seconds(run.DurationSeconds).Round(time.Millisecond),
+		})
+		if !run.Passed {
+			data.Failed++
+		}
+		coverage[i] = run.Coverage.Percent
+		durations[i] = run.DurationSeconds
+	}
+	data.CoverageChart = lineChart(coverage, 100, 720, 160, "%.0f%%")
+	data.DurationChart = lineChart(durations, maxValue(durations), 720, 160, "%.0fs")
+
+	// Per package: coverage from the coverage table, durations from the
+	// package results; NaN where a run didn't include the package
+	pkgCoverage := make(map[string][]float64)
+	pkgDurations := make(map[string][]float64)
+	series := func(m map[string][]float64, pkg string) []float64 {
+		if _, ok := m[pkg]; !ok {
+			values := make([]float64, len(runs))
+			for i := range values {
+				values[i] = math.NaN()
+			}
+			m[pkg] = values
+		}
+		return m[pkg]
+	}
+	for i, run := range runs {
+		for pkg, pct := range run.PackageCoverage {
+			series(pkgCoverage, pkg)[i] = pct
+		}
+		for _, pkg := range run.Packages {
+			if !pkg.Cached {
+				series(pkgDurations, pkg.Package)[i] = pkg.DurationSeconds
+			}
+		}
+	}
+	for _, pkg := range sortedKeys(pkgCoverage) {
+		p := dashboardPackage{Name: pkg, Coverage: lastValue(pkgCoverage[pkg])}
+		p.CoverageTrend = sparkline(pkgCoverage[pkg], 100)
+		if d, ok := pkgDurations[pkg]; ok {
+			p.Duration = seconds(lastValue(d)).Round(time.Millisecond)
+			p.DurationTrend = sparkline(d, maxValue(d))
+		}
+		data.Packages = append(data.Packages, p)
+	}
+
+	// Heatmap of every test that failed at least once
+	outcomes := make([]map[string]testOutcome, len(runs))
+	passedPkgs := make([]map[string]bool, len(runs))
+	failures := make(map[string]int)
+	for i := range runs {
+		outcomes[i], passedPkgs[i] = runTestOutcomes(&runs[i])
+		for test, outcome := range outcomes[i] {
+			if outcome == outcomeFailed {
+				failures[test]++
+			}
+		}
+	}
+	for _, test := range sortedKeys(failures) {
+		pkg, _, _ := strings.Cut(test, " ")
+		row := dashboardTest{Name: test, Failures: failures[test]}
+		for i := range runs {
+			switch {
+			case outcomes[i][test] == outcomeFailed:
+				row.Cells = append(row.Cells, "fail")
+			case outcomes[i][test] == outcomePassed || passedPkgs[i][pkg]:
+				row.Cells = append(row.Cells, "pass")
+			default:
+				row.Cells = append(row.Cells, "none")
+			}
+		}
+		data.Tests = append(data.Tests, row)
+	}
+	return data
+}
+
+// lineChart draws values over the runs as an SVG line chart from 0 to top,
+// labeling the axis with format
+func lineChart(values []float64, top float64, width, height int, format string) template.HTML {
+	const pad = 40
+	if top <= 0 {
+		top = 1
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg class="chart" width="%d" height="%d" viewBox="0 0 %d %d">`, width, height, width, height)
+	for _, frac := range []float64{0, 0.5, 1} {
+		y := float64(height-pad/2) - frac*float64(height-pad)
+		fmt.Fprintf(&b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" class="grid"/>`, pad, y, width, y)
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" class="axis">%s</text>`, pad-4, y+4, template.HTMLEscapeString(fmt.Sprintf(format, frac*top)))
+	}
+	fmt.Fprintf(&b, `<polyline points="%s"/>`, chartPoints(values, top, pad, float64(pad/2), float64(width-pad), float64(height-pad)))
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+// sparkline draws values as a small SVG line from 0 to top
+func sparkline(values []float64, top float64) template.HTML {
+	if top <= 0 {
+		top = 1
+	}
+	return template.HTML(fmt.Sprintf(`<svg class="spark" width="120" height="24" viewBox="0 0 120 24"><polyline points="%s"/></svg>`,
+		chartPoints(values, top, 0, 2, 120, 20)))
+}
+
+// chartPoints converts values to polyline points in a box; missing (NaN)
+// values are left out
+func chartPoints(values []float64, top float64, left, topY, width, height float64) string {
+	var points []string
+	step := width
+	if len(values) > 1 {
+		step = width / float64(len(values)-1)
+	}
+	for i, v := range values {
+		if math.IsNaN(v) {
+			continue
+		}
+		x := left + float64(i)*step
+		y := topY + height - min(v/top, 1)*height
+		points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+	}
+	return strings.Join(points, " ")
+}
+
+func maxValue(values []float64) float64 {
+	top := 0.0
+	for _, v := range values {
+		if !math.IsNaN(v) {
+			top = max(top, v)
+		}
+	}
+	return top
+}
+
+// lastValue returns the last value that isn't missing
+func lastValue(values []float64) float64 {
+	for i := len(values) - 1; i >= 0; i-- {
+		if !math.IsNaN(values[i]) {
+			return values[i]
+		}
+	}
+	return 0
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"pct": func(p float64) string { return fmt.Sprintf("%.1f%%", p) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>gotest history</title>
+<style>
+body { margin: 0 auto; max-width: 1100px; padding: 16px 24px; font: 14px -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; color: #222; }
+table { border-collapse: collapse; margin-bottom: 24px; }
+th, td { text-align: left; padding: 4px 12px 4px 0; border-bottom: 1px solid #eee; white-space: nowrap; }
+td.num { text-align: right; }
+.passed { color: #22863a; } .failed { color: #cb2431; font-weight: bold; }
+svg polyline { fill: none; stroke: #0366d6; stroke-width: 1.5; }
+svg .grid { stroke: #eee; } svg .axis { font-size: 11px; fill: #666; text-anchor: end; }
+.heatmap td { padding: 0; border: 0; }
+.heatmap td.name { padding-right: 12px; font-family: monospace; font-size: 12px; }
+.heatmap span { display: inline-block; width: 8px; height: 14px; margin-right: 1px; }
+.fail { background: #cb2431; } .pass { background: #85e89d; } .none { background: #eee; }
+</style>
+</head>
+<body>
+<h1>Test history</h1>
+<p>{{.Dir}} &middot; {{len .Runs}} run(s), {{.Failed}} failed &middot; generated {{.Generated.Format "2006-01-02 15:04:05"}}</p>
+
+<h2>Total coverage</h2>
+{{.CoverageChart}}
+<h2>Duration</h2>
+{{.DurationChart}}
+
+<h2>Test failures</h2>
+{{if .Tests}}<p>Each column is a run, oldest first: red failed, green passed, gray not run or not reported (go test reports passed tests only with -v).</p>
+<table class="heatmap">
+{{range .Tests}}<tr><td class="name" title="{{.Failures}} failure(s)">{{.Name}}</td><td>{{range .Cells}}<span class="{{.}}"></span>{{end}}</td></tr>
+{{end}}</table>{{else}}<p class="passed">No test failed in these runs.</p>{{end}}
+
+<h2>Packages</h2>
+<table>
+<tr><th>Package</th><th>Coverage</th><th>Trend</th><th>Duration</th><th>Trend</th></tr>
+{{range .Packages}}<tr><td>{{.Name}}</td><td class="num">{{pct .Coverage}}</td><td>{{.CoverageTrend}}</td><td class="num">{{if .DurationTrend}}{{.Duration}}{{else}}-{{end}}</td><td>{{.DurationTrend}}</td></tr>
+{{end}}</table>
+
+<h2>Runs</h2>
+<table>
+<tr><th>Run</th><th>Started</th><th>Result</th><th>Coverage</th><th>Duration</th></tr>
+{{range .Runs}}<tr><td>{{.ID}}</td><td>{{.Started.Format "2006-01-02 15:04"}}</td><td class="{{if .Passed}}passed{{else}}failed{{end}}">{{if .Passed}}passed{{else}}failed{{end}}</td><td class="num">{{pct .Coverage}}</td><td class="num">{{.Duration}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Hoofffman/gotest/pkg/coverprofile"
+)
+
+// deadCode lists the functions no main package reaches, with their
+// coverage (--deadcode)
+var deadCode bool
+
+// deadcodePackage is a package in the output of deadcode -json
+type deadcodePackage struct {
+	Path  string
+	Funcs []struct {
+		Name     string
+		Position struct {
+			File string
+			Line int
+		}
+		Marker bool
+	}
+}
+
+// findDeadCode runs deadcode (golang.org/x/tools/cmd/deadcode) on the
+// packages. Its call graph starts at the main packages; without any, the
+// test binaries are the roots instead, which the second result reports.
+func findDeadCode(ctx context.Context, packages []string) ([]deadcodePackage, bool, error) {
+	tool, err := exec.LookPath("deadcode")
+	if err != nil {
+		return nil, false, fmt.Errorf("deadcode not found in PATH (go install golang.org/x/tools/cmd/deadcode@latest)")
+	}
+	run := func(test bool) ([]byte, string, error) {
+		args := []string{"-json"}
+		if test {
+			args = append(args, "-test")
+		}
+		if buildTags != "" {
+			args = append(args, "-tags="+buildTags)
+		}
+		cmd := exec.CommandContext(ctx, tool, append(args, packages...)...)
+		cmd.Env = withEnv(os.Environ(), goEnv)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		debugf("running %s", strings.Join(cmd.Args, " "))
+		err := cmd.Run()
+		return stdout.Bytes(), strings.TrimSpace(stderr.String()), err
+	}
+
+	test := false
+	out, stderr, err := run(false)
+	if err != nil && strings.Contains(stderr, "no main packages") {
+		test = true
+		out, stderr, err = run(true)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("deadcode: %v\n%s", err, stderr)
+	}
+	var found []deadcodePackage
+	if len(bytes.TrimSpace(out)) > 0 {
+		if err := json.Unmarshal(out, &found); err != nil {
+			return nil, false, fmt.Errorf("reading deadcode output: %w", err)
+		}
+	}
+	return found, test, nil
+}
+
+// printDeadCode lists the unreachable functions with their coverage.
+// Those the tests don't cover either are deletion candidates and come
+// first; covered ones are only kept alive by tests.
+func printDeadCode(ctx context.Context, coverProfile string, packages []string) error {
+	found, fromTests, err := findDeadCode(ctx, packages)
+	if err != nil {
+		return err
+	}
+	profile, err := coverprofile.ParseFile(ctx, coverProfile)
+	if err != nil {
+		return err
+	}
+	dirs, err := packageDirs(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Coverage by absolute file name and line of the declaration
+	coverage := make(map[string]funcCoverage)
+	for _, f := range functionCoverage(profile, dirs) {
+		if abs, err := filepath.Abs(sourcePath(f.File, dirs)); err == nil {
+			coverage[fmt.Sprintf("%s:%d", abs, f.Line)] = f
+		}
+	}
+
+	// Marker methods are never called on purpose
+	var funcs []funcCoverage
+	for _, pkg := range found {
+		for _, fn := range pkg.Funcs {
+			if fn.Marker {
+				continue
+			}
+			abs, _ := filepath.Abs(fn.Position.File)
+			f := coverage[fmt.Sprintf("%s:%d", abs, fn.Position.Line)]
+			f.Name, f.File, f.Line = fn.Name, fn.Position.File, fn.Position.Line
+			funcs = append(funcs, f)
+		}
+	}
+
+	fmt.Println()
+	fmt.Println(strings.Repeat("=", 60))
+	if fromTests {
+		fmt.Println("DEAD CODE (no main package; unreachable from the tests)")
+	} else {
+		fmt.Println("DEAD CODE (unreachable from the main packages)")
+	}
+	fmt.Println(strings.Repeat("=", 60))
+	if len(funcs) == 0 {
+		fmt.Println("No unreachable functions")
+		fmt.Println(strings.Repeat("=", 60))
+		return nil
+	}
+	sort.SliceStable(funcs, func(i, j int) bool {
+		return funcs[i].Covered == 0 && funcs[j].Covered > 0
+	})
+
+	positions := make([]string, len(funcs))
+	posCol, nameCol := len("POSITION"), len("FUNCTION")
+	candidates := 0
+	for i, f := range funcs {
+		positions[i] = fmt.Sprintf("%s:%d", filepath.ToSlash(f.File), f.Line)
+		posCol = max(posCol, len(positions[i]))
+		nameCol = max(nameCol, len(f.Name))
+		if f.Covered == 0 {
+			candidates++
+		}
+	}
+	posCol = min(posCol, max(terminalWidth()-nameCol-35, 30))
+
+	fmt.Printf("%-*s  %-*s %8s\n", posCol, "POSITION", nameCol, "FUNCTION", "COVERAGE")
+	for i, f := range funcs {
+		pct, note := "-", "deletion candidate"
+		if f.Statements > 0 {
+			pct = fmt.Sprintf("%.1f%%", f.Percent())
+		}
+		switch {
+		case f.Covered > 0 && fromTests:
+			note = ""
+		case f.Covered > 0:
+			note = "only reached by tests"
+		}
+		fmt.Printf("%-*s  %-*s %8s  %s\n", posCol, middleEllipsis(positions[i], posCol), nameCol, f.Name, pct, note)
+	}
+	fmt.Println(strings.Repeat("=", 60))
+	fmt.Printf("%d unreachable function(s), %d never covered either\n", len(funcs), candidates)
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// runInDocker runs gotest with the given arguments inside a golang
+// container, with the current directory mounted as the working directory,
+// and copies the coverage artifacts back to the host afterwards. The host
+// environment and config are not applied here: gotest in the container
+// reads the config file of the mounted directory, and --env and --goenv
+// reach it with the other arguments.
+func runInDocker(args []string) error {
+	docker, err := exec.LookPath("docker")
+	if err != nil {
+		return fmt.Errorf("docker not found in PATH")
+	}
+
+	image := dockerImage
+	if image == "" {
+		image = "golang:latest"
+		if out, err := goCommand("env", "GOVERSION").Output(); err == nil {
+			if version := strings.TrimPrefix(strings.TrimSpace(string(out)), "go"); version != "" {
+				image = "golang:" + version
+			}
+		}
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	if chdir != "" {
+		if cwd, err = filepath.Abs(chdir); err != nil {
+			return err
+		}
+	}
+
+	// Artifacts are written to the container's /tmp, which is a host directory
+	outDir, err := os.MkdirTemp("", "gotest-docker-")
+	if err != nil {
+		return fmt.Errorf("creating artifact directory: %w", err)
+	}
+	defer os.RemoveAll(outDir)
+
+	dockerArgs := []string{"run", "--rm",
+		"-v", cwd + ":/src", "-w", "/src",
+		"-v", outDir + ":/tmp",
+	}
+
+	// A Linux gotest binary of the right architecture can be mounted as is;
+	// otherwise it is built inside the container
+	var command []string
+	if self, err := os.Executable(); err == nil && runtime.GOOS == "linux" {
+		dockerArgs = append(dockerArgs, "-v", self+":/usr/local/bin/gotest:ro")
+		command = []string{"gotest"}
+	} else {
+		command = []string{"go", "run", "github.com/Hoofffman/gotest@latest"}
+	}
+
+	dockerArgs = append(dockerArgs, image)
+	dockerArgs = append(dockerArgs, command...)
+	dockerArgs = append(dockerArgs, dockerChildArgs(args)...)
+	dockerArgs = append(dockerArgs, "--no-browser")
+
+	if verbose {
+		fmt.Printf("Running: docker %s\n\n", strings.Join(dockerArgs, " "))
+	} else {
+		fmt.Printf("Running in %s...\n", image)
+	}
+
+	cmd := exec.Command(docker, dockerArgs...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	runErr := cmd.Run()
+
+	// Copy the artifacts back to where a local run would have put them
+	var copied []string
+	for _, name := range []string{"cover.out", "cover.html"} {
+		data, err := os.ReadFile(filepath.Join(outDir, name))
+		if err != nil {
+			continue
+		}
+		dst := filepath.Join("/tmp", name)
+		if err := os.WriteFile(dst, data, 0644); err != nil {
+			return fmt.Errorf("copying %s: %w", name, err)
+		}
+		copied = append(copied, dst)
+	}
+	if verbose && len(copied) > 0 {
+		fmt.Printf("\nCopied artifacts: %s\n", strings.Join(copied, ", "))
+	}
+
+	if runErr != nil {
+		return childExitCode(fmt.Errorf("container run failed: %w", runErr))
+	}
+
+	coverHTML := filepath.Join("/tmp", "cover.html")
+	if noBrowser || len(copied) < 2 {
+		return nil
+	}
+	fmt.Println()
+	if err := openReport(coverHTML); err != nil {
+		return fmt.Errorf("opening browser: %w", err)
+	}
+	return nil
+}
+
+// dockerChildArgs returns the arguments for gotest in the container: all
+// but --in-docker itself and -C, whose directory is the one mounted.
+// Arguments after "--" belong to go test and are kept as they are.
+func dockerChildArgs(args []string) []string {
+	var childArgs []string
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "--":
+			return append(childArgs, args[i:]...)
+		case isFlag(arg, "--in-docker", "-in-docker"):
+		case isFlag(arg, "-C", "--chdir", "-chdir"):
+			flagValue(args, &i, "-C", "--chdir", "-chdir")
+		default:
+			childArgs = append(childArgs, arg)
+		}
+	}
+	return childArgs
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDockerChildArgs(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"--in-docker", "-d", "./..."}, []string{"-d", "./..."}},
+		{[]string{"--in-docker=golang:1.22", "-race"}, []string{"-race"}},
+		// The directory of -C is mounted, so it must not become a package pattern
+		{[]string{"--in-docker", "-C", "sub", "./..."}, []string{"./..."}},
+		{[]string{"--chdir=sub", "--in-docker", "-run", "TestA"}, []string{"-run", "TestA"}},
+		{[]string{"--in-docker", "--", "-C", "sub"}, []string{"--", "-C", "sub"}},
+	}
+	for _, tt := range tests {
+		if got := dockerChildArgs(tt.args); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("dockerChildArgs(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
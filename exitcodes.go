@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// Exit codes, so scripts can tell why a run failed. Anything not classified
+// otherwise is a tool error.
+const (
+	exitOK          = 0
+	exitTestsFailed = 1 // failing tests, or a failing vet, lint, format or benchmark gate
+	exitBuildFailed = 2 // packages or their tests don't compile
+	exitCoverage    = 3 // total coverage below --min-coverage
+	exitToolError   = 4 // gotest itself failed: bad flags or config, missing tools, I/O errors
+	exitTimeout     = 5 // the run exceeded --max-duration
+	exitInterrupted = 130
+)
+
+// exitError attaches an exit code to an error
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+// withExitCode classifies err with an exit code; a nil err stays nil
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{code: code, err: err}
+}
+
+// exitCode returns the exit code for an error returned by a command. In a
+// joined error the first classified error decides, so callers list the most
+// severe failure first.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var e *exitError
+	if errors.As(err, &e) {
+		return e.code
+	}
+	return exitToolError
+}
+
+// childExitCode passes on the exit code of a gotest child process, such as
+// one running in a container
+func childExitCode(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+		return withExitCode(exitErr.ExitCode(), err)
+	}
+	return err
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/Hoofffman/gotest/pkg/runner"
+)
+
+// failFirstOrder tests the packages that failed most recently first
+// (--fail-first-order)
+var failFirstOrder bool
+
+// orderFailuresFirst moves the packages that failed in the run history to
+// the front, the most recent failure first, so likely failures show up
+// early. The other packages keep their order. It returns the reordered
+// packages and how many of them failed before.
+func orderFailuresFirst(packages []string, runs []historyRun) ([]string, int) {
+	// Index of the last run each package failed in, by import path or, for
+	// packages without one, the form given to go test
+	lastFailure := make(map[string]int)
+	for i, run := range runs {
+		for _, pkg := range run.Packages {
+			if pkg.Status == string(runner.StatusFailed) || pkg.Status == string(runner.StatusBuildFailed) {
+				lastFailure[pkg.Package] = i
+			}
+		}
+	}
+	if len(lastFailure) == 0 {
+		return packages, 0
+	}
+
+	rank := make(map[string]int)
+	for _, pkg := range packages {
+		if i, ok := lastFailure[pkg]; ok {
+			rank[pkg] = i
+		}
+	}
+	for importPath, pkg := range packageImportPaths(packages) {
+		if i, ok := lastFailure[importPath]; ok {
+			rank[pkg] = max(rank[pkg], i)
+		}
+	}
+
+	ordered := append([]string(nil), packages...)
+	sort.SliceStable(ordered, func(a, b int) bool {
+		ra, failedA := rank[ordered[a]]
+		rb, failedB := rank[ordered[b]]
+		if failedA != failedB {
+			return failedA
+		}
+		return failedA && ra > rb
+	})
+	return ordered, len(rank)
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// flakinessWindow is the number of recent runs a flakiness score covers
+const flakinessWindow = 20
+
+// testOutcome is what a run tells about one test
+type testOutcome int
+
+const (
+	outcomeUnknown testOutcome = iota
+	outcomePassed
+	outcomeFailed
+)
+
+// runTestOutcomes returns the outcome of every top-level test a run
+// reports, keyed "package TestName". A test that failed in any repetition
+// failed. Passed tests are only reported with -v, so the second map holds
+// the packages that passed as a whole.
+func runTestOutcomes(run *historyRun) (map[string]testOutcome, map[string]bool) {
+	outcomes := make(map[string]testOutcome)
+	passedPkgs := make(map[string]bool)
+	for _, pkg := range run.Packages {
+		if pkg.Status == "passed" {
+			passedPkgs[pkg.Package] = true
+		}
+		for _, t := range pkg.Tests {
+			if strings.Contains(t.Name, "/") {
+				continue
+			}
+			key := pkg.Package + " " + t.Name
+			switch {
+			case t.Status == "fail":
+				outcomes[key] = outcomeFailed
+			case t.Status == "pass" && outcomes[key] != outcomeFailed:
+				outcomes[key] = outcomePassed
+			}
+		}
+		for _, f := range pkg.Failures {
+			if !strings.Contains(f.Test, "/") {
+				outcomes[pkg.Package+" "+f.Test] = outcomeFailed
+			}
+		}
+	}
+	return outcomes, passedPkgs
+}
+
+// testFlakiness is the flakiness of one test over a window of runs
+type testFlakiness struct {
+	Test     string // "package TestName"
+	Score    float64
+	Failures int
+	Observed int
+}
+
+// flakinessScores scores every test that failed in the given runs, oldest
+// first: the share of consecutive observations in which its outcome
+// flipped between pass and fail. A test that fails every time scores 0,
+// like one that always passes; one that alternates scores 1. Runs that
+// don't tell whether the test passed are skipped.
+func flakinessScores(runs []historyRun) []testFlakiness {
+	outcomes := make([]map[string]testOutcome, len(runs))
+	passedPkgs := make([]map[string]bool, len(runs))
+	failedTests := make(map[string]bool)
+	for i := range runs {
+		outcomes[i], passedPkgs[i] = runTestOutcomes(&runs[i])
+		for test, outcome := range outcomes[i] {
+			if outcome == outcomeFailed {
+				failedTests[test] = true
+			}
+		}
+	}
+
+	var scores []testFlakiness
+	for _, test := range sortedKeys(failedTests) {
+		pkg, _, _ := strings.Cut(test, " ")
+		f := testFlakiness{Test: test}
+		var flips int
+		prev := outcomeUnknown
+		for i := range runs {
+			outcome := outcomes[i][test]
+			if outcome == outcomeUnknown && passedPkgs[i][pkg] {
+				outcome = outcomePassed
+			}
+			if outcome == outcomeUnknown {
+				continue
+			}
+			f.Observed++
+			if outcome == outcomeFailed {
+				f.Failures++
+			}
+			if prev != outcomeUnknown && outcome != prev {
+				flips++
+			}
+			prev = outcome
+		}
+		if flips > 0 {
+			f.Score = float64(flips) / float64(f.Observed-1)
+			scores = append(scores, f)
+		}
+	}
+	sort.SliceStable(scores, func(i, j int) bool { return scores[i].Score > scores[j].Score })
+	return scores
+}
+
+// recentRuns returns the last n runs
+func recentRuns(runs []historyRun, n int) []historyRun {
+	return runs[max(len(runs)-n, 0):]
+}
+
+// flakinessMap converts scores to the form recorded in the history
+func flakinessMap(scores []testFlakiness) map[string]float64 {
+	if len(scores) == 0 {
+		return nil
+	}
+	m := make(map[string]float64)
+	for _, f := range scores {
+		m[f.Test] = f.Score
+	}
+	return m
+}
+
+// runFlaky implements "gotest flaky [--trend] [--window n]": it lists the
+// tests that flipped between passing and failing in the recent runs of the
+// history, or with --trend, how the suite's stability changed week by week
+func runFlaky(args []string) error {
+	trend := false
+	window := flakinessWindow
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "--trend" || arg == "-trend":
+			trend = true
+		case isFlag(arg, "--window", "-window"):
+			value, _ := flagValue(args, &i, "--window", "-window")
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 2 {
+				return withExitCode(exitToolError, fmt.Errorf("invalid --window value %q (expected 2 or more runs)", value))
+			}
+			window = n
+		default:
+			return withExitCode(exitToolError, fmt.Errorf("unknown argument %s\nusage: gotest flaky [--trend] [--window n]", arg))
+		}
+	}
+
+	runs, err := loadHistory()
+	if err != nil {
+		return fmt.Errorf("reading run history: %w", err)
+	}
+	if len(runs) < 2 {
+		fmt.Println("Not enough runs recorded to detect flaky tests")
+		return nil
+	}
+	if trend {
+		printFlakinessTrend(runs, window)
+		return nil
+	}
+
+	recent := recentRuns(runs, window)
+	scores := flakinessScores(recent)
+	fmt.Printf("\n--- FLAKY TESTS (last %d runs) ---\n", len(recent))
+	if len(scores) == 0 {
+		fmt.Println("No test flipped between passing and failing")
+	}
+	for _, f := range scores {
+		pkg, name, _ := strings.Cut(f.Test, " ")
+		fmt.Printf("%5.2f  %s %s: failed %d of %d observed runs\n", f.Score, localPath(pkg), name, f.Failures, f.Observed)
+	}
+	fmt.Println("------------------------------")
+	return nil
+}
+
+// weekStability summarizes the flakiness at the end of one week
+type weekStability struct {
+	Week       string // ISO week, e.g. 2024-W18
+	Runs       int
+	FailedRuns int
+	Flaky      int     // tests with a score above 0
+	MeanScore  float64 // over the flaky tests
+}
+
+// printFlakinessTrend scores the window of runs ending with the last run
+// of every week, and compares the weeks with each other
+func printFlakinessTrend(runs []historyRun, window int) {
+	var weeks []weekStability
+	for i, run := range runs {
+		year, week := run.Started.ISOWeek()
+		label := fmt.Sprintf("%d-W%02d", year, week)
+		if len(weeks) == 0 || weeks[len(weeks)-1].Week != label {
+			weeks = append(weeks, weekStability{Week: label})
+		}
+		w := &weeks[len(weeks)-1]
+		w.Runs++
+		if !run.Passed {
+			w.FailedRuns++
+		}
+		// The last run of the week decides its scores
+		if i+1 == len(runs) || !sameWeek(runs[i+1].Started, run.Started) {
+			scores := flakinessScores(recentRuns(runs[:i+1], window))
+			w.Flaky = len(scores)
+			for _, f := range scores {
+				w.MeanScore += f.Score / float64(len(scores))
+			}
+		}
+	}
+
+	fmt.Printf("\n--- FLAKINESS TREND (window of %d runs) ---\n", window)
+	fmt.Printf("%-10s %6s %8s %8s %8s  %s\n", "WEEK", "RUNS", "FAILED", "FLAKY", "SCORE", "CHANGE")
+	for i, w := range weeks {
+		change := ""
+		if i > 0 {
+			change = stabilityChange(weeks[i-1], w)
+		}
+		fmt.Printf("%-10s %6d %8d %8d %8.2f  %s\n", w.Week, w.Runs, w.FailedRuns, w.Flaky, w.MeanScore, change)
+	}
+	fmt.Println("------------------------------")
+	if len(weeks) > 1 {
+		fmt.Printf("Stability is %s since last week\n", stabilityChange(weeks[len(weeks)-2], weeks[len(weeks)-1]))
+	}
+}
+
+// stabilityChange compares two weeks by their number of flaky tests, then
+// by how flaky they are
+func stabilityChange(prev, cur weekStability) string {
+	switch {
+	case cur.Flaky < prev.Flaky, cur.Flaky == prev.Flaky && cur.MeanScore < prev.MeanScore-0.005:
+		return colorize("improving", colorGreen)
+	case cur.Flaky > prev.Flaky, cur.Flaky == prev.Flaky && cur.MeanScore > prev.MeanScore+0.005:
+		return colorize("degrading", colorRed)
+	}
+	return "unchanged"
+}
+
+func sameWeek(a, b time.Time) bool {
+	ay, aw := a.ISOWeek()
+	by, bw := b.ISOWeek()
+	return ay == by && aw == bw
+}
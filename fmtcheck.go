@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// checkFormatting runs the formatter in list mode over the Go files of the
+// packages and returns the files it would change. In detail mode the diffs
+// are printed as well.
+func checkFormatting(packages []string) ([]string, error) {
+	if fmtTool != "gofmt" && fmtTool != "gofumpt" {
+		return nil, fmt.Errorf("unsupported formatter %q (use gofmt or gofumpt)", fmtTool)
+	}
+	tool, err := exec.LookPath(fmtTool)
+	if err != nil {
+		return nil, fmt.Errorf("%s not found in PATH", fmtTool)
+	}
+
+	var files []string
+	for _, pkg := range packages {
+		matches, err := filepath.Glob(filepath.Join(pkg, "*.go"))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(tool, append([]string{"-l"}, files...)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("running %s: %v\n%s", fmtTool, err, stderr.String())
+	}
+
+	var unformatted []string
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			unformatted = append(unformatted, line)
+		}
+	}
+
+	if verbose && len(unformatted) > 0 {
+		diff := exec.Command(tool, append([]string{"-d"}, unformatted...)...)
+		diff.Stdout = os.Stdout
+		diff.Stderr = os.Stderr
+		diff.Run()
+	}
+
+	return unformatted, nil
+}
+
+// printUnformatted prints the result of the format check
+func printUnformatted(files []string) {
+	if len(files) == 0 {
+		fmt.Printf("\nFormatting: all files formatted with %s\n", fmtTool)
+		return
+	}
+
+	fmt.Printf("\nUNFORMATTED FILES (%d, run '%s -w' to fix):\n", len(files), fmtTool)
+	for _, file := range files {
+		fmt.Printf("  %s\n", file)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// fuzzCrash is a unique failure signature and the corpus entries hitting it
+type fuzzCrash struct {
+	Signature string
+	Message   string
+	Package   string
+	Inputs    []fuzzInput
+}
+
+// fuzzInput is one entry of a package's testdata/fuzz corpus
+type fuzzInput struct {
+	Target string // fuzz test name, e.g. FuzzParse
+	Name   string // corpus file name
+	Path   string
+}
+
+var (
+	digitsRe   = regexp.MustCompile(`[0-9]+`)
+	testLineRe = regexp.MustCompile(`^\s+(\S+\.go:\d+): (.*)$`)
+)
+
+// findFuzzInputs lists the corpus entries under pkg/testdata/fuzz. Besides
+// hand-written seeds this is where go test -fuzz writes failing inputs.
+func findFuzzInputs(pkg string) []fuzzInput {
+	var inputs []fuzzInput
+	files, _ := filepath.Glob(filepath.Join(pkg, "testdata", "fuzz", "*", "*"))
+	for _, file := range files {
+		if info, err := os.Stat(file); err != nil || info.IsDir() {
+			continue
+		}
+		inputs = append(inputs, fuzzInput{
+			Target: filepath.Base(filepath.Dir(file)),
+			Name:   filepath.Base(file),
+			Path:   file,
+		})
+	}
+	return inputs
+}
+
+// failedPackages returns the import paths go test reported as FAIL
+func failedPackages(output string) map[string]bool {
+	failed := make(map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "FAIL" {
+			failed[fields[1]] = true
+		}
+	}
+	return failed
+}
+
+// triageFuzzCrashes reruns every corpus entry of the failed packages on its
+// own, since a panic aborts the test binary after the first crashing input,
+// and groups the failing entries by failure signature.
+func triageFuzzCrashes(packages []string, output string) []*fuzzCrash {
+	failed := failedPackages(output)
+	if len(failed) == 0 {
+		return nil
+	}
+
+	var crashes []*fuzzCrash
+	bySignature := make(map[string]*fuzzCrash)
+	for importPath, pkg := range packageImportPaths(packages) {
+		if !failed[importPath] {
+			continue
+		}
+		for _, input := range findFuzzInputs(pkg) {
+			out, err := runFuzzInput(pkg, input)
+			if err == nil {
+				continue
+			}
+			signature, message := fuzzSignature(out)
+			key := importPath + "\x00" + signature
+			crash, ok := bySignature[key]
+			if !ok {
+				crash = &fuzzCrash{Signature: signature, Message: message, Package: pkg}
+				bySignature[key] = crash
+				crashes = append(crashes, crash)
+			}
+			crash.Inputs = append(crash.Inputs, input)
+		}
+	}
+
+	sort.SliceStable(crashes, func(i, j int) bool {
+		return len(crashes[i].Inputs) > len(crashes[j].Inputs)
+	})
+	return crashes
+}
+
+// runFuzzInput runs a single corpus entry, which go test exposes as the
+// subtest Target/Name
+func runFuzzInput(pkg string, input fuzzInput) (string, error) {
+	args := []string{"test", "-count=1", "-run", fuzzRunPattern(input)}
+	if buildTags != "" {
+		args = append(args, "-tags="+buildTags)
+	}
+	args = append(args, pkg)
+
+	var output bytes.Buffer
+	cmd := goTestCommand(args...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err := cmd.Run()
+	return output.String(), err
+}
+
+func fuzzRunPattern(input fuzzInput) string {
+	return "^" + regexp.QuoteMeta(input.Target) + "$/^" + regexp.QuoteMeta(input.Name) + "$"
+}
+
+// fuzzSignature derives a failure signature from the output of a single
+// failing input. Panics are identified by their message and the first
+// non-runtime frame, test failures by the location of the failing check.
+// Numbers are masked so that the same bug hit with different values
+// collapses into one signature.
+func fuzzSignature(output string) (signature, message string) {
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		if msg, ok := strings.CutPrefix(line, "panic: "); ok {
+			msg = strings.TrimSuffix(msg, " [recovered, repanicked]")
+			msg = strings.TrimSuffix(msg, " [recovered]")
+			frame := panicFrame(lines[i+1:])
+			return "panic: " + digitsRe.ReplaceAllString(msg, "N") + " at " + frame, "panic: " + msg + " at " + frame
+		}
+	}
+	for _, line := range lines {
+		if m := testLineRe.FindStringSubmatch(line); m != nil {
+			return m[1], m[1] + ": " + m[2]
+		}
+	}
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "--- FAIL") {
+			return strings.TrimSpace(line), strings.TrimSpace(line)
+		}
+	}
+	return "unknown failure", "unknown failure"
+}
+
+// panicFrame returns the first stack frame outside the runtime, testing and
+// reflect packages as "function (file:line)"
+func panicFrame(stack []string) string {
+	for i := 0; i+1 < len(stack); i++ {
+		fn := stack[i]
+		if fn == "" || strings.HasPrefix(fn, "\t") || strings.HasPrefix(fn, "goroutine ") {
+			continue
+		}
+		if strings.HasPrefix(fn, "panic(") || strings.HasPrefix(fn, "runtime.") ||
+			strings.HasPrefix(fn, "testing.") || strings.HasPrefix(fn, "reflect.") ||
+			strings.HasPrefix(fn, "created by ") {
+			continue
+		}
+		if idx := strings.LastIndex(fn, "("); idx > 0 {
+			fn = fn[:idx]
+		}
+		location := strings.TrimSpace(stack[i+1])
+		if idx := strings.LastIndex(location, " +0x"); idx > 0 {
+			location = location[:idx]
+		}
+		return fmt.Sprintf("%s (%s)", fn, filepath.Base(location))
+	}
+	return "unknown location"
+}
+
+// printFuzzCrashes prints the triage report with a reproduction command for
+// each unique crash
+func printFuzzCrashes(crashes []*fuzzCrash) {
+	if len(crashes) == 0 {
+		return
+	}
+	inputs := 0
+	for _, crash := range crashes {
+		inputs += len(crash.Inputs)
+	}
+
+	fmt.Printf("\n--- FUZZ CRASHES (%d unique, %d input(s)) ---\n", len(crashes), inputs)
+	for i, crash := range crashes {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("[%d] %s\n", i+1, crash.Message)
+		for _, input := range crash.Inputs {
+			fmt.Printf("    input: %s\n", input.Path)
+		}
+		fmt.Printf("    reproduce: go test -run='%s' %s\n", fuzzRunPattern(crash.Inputs[0]), crash.Package)
+	}
+	fmt.Println("-------------------------------------")
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Hoofffman/gotest/pkg/discover"
+)
+
+// gap is a package or file without tests, with the size of what is
+// untested
+type gap struct {
+	Package    string `json:"package"`
+	File       string `json:"file,omitempty"`
+	Files      int    `json:"files,omitempty"`
+	Exported   int    `json:"exported_functions"`
+	Statements int    `json:"statements"`
+	// TestFile is where tests of a file would go
+	TestFile string `json:"test_file,omitempty"`
+}
+
+// runGaps implements "gotest gaps [--json] [packages...]": the packages
+// without tests, and the files of tested packages that have no test file
+// of their own, largest first
+func runGaps(args []string) error {
+	const usageText = "usage: gotest gaps [--json] [packages...]"
+	var asJSON bool
+	var patterns []string
+	for _, arg := range args {
+		switch {
+		case arg == "--json" || arg == "-json":
+			asJSON = true
+		case strings.HasPrefix(arg, "-"):
+			return withExitCode(exitToolError, fmt.Errorf("unknown flag %s\n%s", arg, usageText))
+		default:
+			patterns = append(patterns, arg)
+		}
+	}
+
+	if err := loadCompletionIgnoreRules(); err != nil {
+		return err
+	}
+	found, err := discover.Packages(context.Background(), discoverOptions("."))
+	if err != nil {
+		return fmt.Errorf("discovering packages: %w", err)
+	}
+
+	var packages, files []gap
+	for _, pkg := range found {
+		if len(patterns) > 0 && !matchesAnyPattern(pkg.Path, patterns) {
+			continue
+		}
+		pkgGap, fileGaps := packageGaps(pkg)
+		if !pkg.HasTests {
+			if pkgGap.Statements > 0 {
+				packages = append(packages, pkgGap)
+			}
+			continue
+		}
+		files = append(files, fileGaps...)
+	}
+	bySize := func(gaps []gap) {
+		sort.SliceStable(gaps, func(i, j int) bool {
+			if gaps[i].Statements != gaps[j].Statements {
+				return gaps[i].Statements > gaps[j].Statements
+			}
+			return gaps[i].Exported > gaps[j].Exported
+		})
+	}
+	bySize(packages)
+	bySize(files)
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			Packages []gap `json:"packages"`
+			Files    []gap `json:"files"`
+		}{append([]gap{}, packages...), append([]gap{}, files...)})
+	}
+	printGaps(packages, files)
+	return nil
+}
+
+// packageGaps measures a package and each of its files with statements
+// that lacks a _test.go file of the same name. Files excluded by build
+// constraints and generated files are left out.
+func packageGaps(pkg discover.Package) (gap, []gap) {
+	pkgGap := gap{Package: pkg.Path}
+	var files []gap
+	names, _ := filepath.Glob(filepath.Join(pkg.Dir, "*.go"))
+	fset := token.NewFileSet()
+	for _, name := range names {
+		base := filepath.Base(name)
+		if strings.HasSuffix(base, "_test.go") {
+			continue
+		}
+		if ok, err := build.Default.MatchFile(pkg.Dir, base); err != nil || !ok {
+			continue
+		}
+		file, err := parser.ParseFile(fset, name, nil, parser.ParseComments|parser.SkipObjectResolution)
+		if err != nil || ast.IsGenerated(file) {
+			continue
+		}
+		g := gap{Package: pkg.Path, File: filepath.ToSlash(filepath.Join(pkg.Path, base))}
+		g.Exported, g.Statements = countExported(file), countStatements(file)
+		pkgGap.Files++
+		pkgGap.Exported += g.Exported
+		pkgGap.Statements += g.Statements
+
+		testFile := strings.TrimSuffix(base, ".go") + "_test.go"
+		if _, err := os.Stat(filepath.Join(pkg.Dir, testFile)); err != nil && g.Statements > 0 {
+			g.TestFile = filepath.ToSlash(filepath.Join(pkg.Path, testFile))
+			files = append(files, g)
+		}
+	}
+	return pkgGap, files
+}
+
+// countExported counts the exported functions of a file, and the exported
+// methods of its exported types
+func countExported(file *ast.File) int {
+	n := 0
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || !fn.Name.IsExported() {
+			continue
+		}
+		if fn.Recv != nil && len(fn.Recv.List) > 0 && !ast.IsExported(receiverName(fn.Recv.List[0].Type)) {
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+// receiverName returns the type name of a method receiver, such as T for
+// *T or T[K]
+func receiverName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return receiverName(t.X)
+	case *ast.IndexExpr:
+		return receiverName(t.X)
+	case *ast.IndexListExpr:
+		return receiverName(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return ""
+}
+
+// countStatements counts the statements of a file the way coverage
+// profiles do: blocks and case clauses hold statements but aren't any
+func countStatements(file *ast.File) int {
+	n := 0
+	ast.Inspect(file, func(node ast.Node) bool {
+		switch node.(type) {
+		case *ast.BlockStmt, *ast.EmptyStmt, *ast.CaseClause, *ast.CommClause, *ast.LabeledStmt:
+		case ast.Stmt:
+			n++
+		}
+		return true
+	})
+	return n
+}
+
+// printGaps prints the packages and files without tests as tables
+func printGaps(packages, files []gap) {
+	if len(packages) == 0 && len(files) == 0 {
+		fmt.Println("Every package and file has tests")
+		return
+	}
+	col := len("PACKAGE")
+	for _, g := range packages {
+		col = max(col, len(g.Package))
+	}
+	for _, g := range files {
+		col = max(col, len(g.File))
+	}
+	col = max(min(col, terminalWidth()-50), 20)
+
+	if len(packages) > 0 {
+		fmt.Println(strings.Repeat("=", 60))
+		fmt.Printf("PACKAGES WITHOUT TESTS (%d)\n", len(packages))
+		fmt.Println(strings.Repeat("=", 60))
+		fmt.Printf("%-*s %6s %9s %11s\n", col, "PACKAGE", "FILES", "EXPORTED", "STATEMENTS")
+		for _, g := range packages {
+			fmt.Printf("%-*s %6d %9d %11d\n", col, middleEllipsis(g.Package, col), g.Files, g.Exported, g.Statements)
+		}
+	}
+	if len(files) > 0 {
+		if len(packages) > 0 {
+			fmt.Println()
+		}
+		fmt.Println(strings.Repeat("=", 60))
+		fmt.Printf("FILES WITHOUT A TEST FILE (%d)\n", len(files))
+		fmt.Println(strings.Repeat("=", 60))
+		fmt.Printf("%-*s %6s %9s %11s  %s\n", col, "FILE", "", "EXPORTED", "STATEMENTS", "ADD")
+		for _, g := range files {
+			fmt.Printf("%-*s %6s %9d %11d  %s\n", col, middleEllipsis(g.File, col), "", g.Exported, g.Statements, filepath.Base(g.TestFile))
+		}
+	}
+	fmt.Println(strings.Repeat("=", 60))
+
+	statements := 0
+	for _, g := range append(packages, files...) {
+		statements += g.Statements
+	}
+	fmt.Printf("%d statement(s) without tests, largest gaps first\n", statements)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Hoofffman/gotest/pkg/coverprofile"
+)
+
+// runExport implements "gotest export --gcov [-o dir] [profile]": the
+// coverage profile converted for tools that don't read Go profiles
+func runExport(args []string) error {
+	const usageText = "usage: gotest export --gcov [-o dir] [profile]"
+	profile := "/tmp/cover.out"
+	out := "gcov"
+	var gcov, haveProfile bool
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "--gcov" || arg == "-gcov":
+			gcov = true
+		case isFlag(arg, "-o", "--output", "-output"):
+			out, _ = flagValue(args, &i, "-o", "--output", "-output")
+		case !strings.HasPrefix(arg, "-") && !haveProfile:
+			profile, haveProfile = arg, true
+		default:
+			return withExitCode(exitToolError, fmt.Errorf("unknown argument %s\n%s", arg, usageText))
+		}
+	}
+	if !gcov {
+		return withExitCode(exitToolError, fmt.Errorf(usageText))
+	}
+
+	ctx := context.Background()
+	p, err := coverprofile.ParseFile(ctx, profile)
+	if err != nil {
+		return fmt.Errorf("reading coverage profile: %w", err)
+	}
+	loadModulePaths(ctx)
+	n, err := writeGcov(ctx, p, out)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %d gcov file(s) to %s\n", n, out)
+	return nil
+}
+
+// writeGcov writes a gcov text report for every source file of the
+// profile to dir, named like gcov -p names them: the file's path with "#"
+// for "/", plus ".gcov". A line counts the executions of the most executed
+// block on it; lines without statements are marked "-". Files whose source
+// can't be found are left out. It returns the number of files written.
+func writeGcov(ctx context.Context, profile *coverprofile.Profile, dir string) (int, error) {
+	dirs, err := packageDirs(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, err
+	}
+
+	counts := make(map[string]map[int]int)
+	for _, b := range profile.Blocks {
+		if b.NumStmt == 0 {
+			continue
+		}
+		lines, ok := counts[b.File]
+		if !ok {
+			lines = make(map[int]int)
+			counts[b.File] = lines
+		}
+		for l := b.StartLine; l <= b.EndLine; l++ {
+			if prev, ok := lines[l]; !ok || b.Count > prev {
+				lines[l] = b.Count
+			}
+		}
+	}
+
+	written := 0
+	for _, name := range sortedKeys(counts) {
+		src := sourcePath(name, dirs)
+		dst := filepath.Join(dir, strings.ReplaceAll(localPath(name), "/", "#")+".gcov")
+		if err := writeGcovFile(src, dst, counts[name]); err != nil {
+			if os.IsNotExist(err) {
+				warnf("no source for %s, skipped", name)
+				continue
+			}
+			return written, err
+		}
+		written++
+	}
+	return written, nil
+}
+
+// writeGcovFile annotates the source file src with the line counts in the
+// gcov text format
+func writeGcovFile(src, dst string, counts map[int]int) error {
+	source, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	file, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	fmt.Fprintf(w, "%9s:%5d:Source:%s\n", "-", 0, src)
+
+	scanner := bufio.NewScanner(source)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for num := 1; scanner.Scan(); num++ {
+		count := "-"
+		if n, ok := counts[num]; ok && n == 0 {
+			count = "#####"
+		} else if ok {
+			count = strconv.Itoa(n)
+		}
+		fmt.Fprintf(w, "%9s:%5d:%s\n", count, num, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
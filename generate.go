@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// generate runs go generate on the packages before testing, and fails the
+// run if that changes tracked files (--generate)
+var generate bool
+
+// runGenerate runs go generate on the packages and returns the tracked
+// files it changed. Files that were already modified count only if
+// generation changed them again. Outside a git work tree changes can't be
+// detected; a warning says so, and the files are nil rather than empty.
+func runGenerate(ctx context.Context, packages []string) ([]string, error) {
+	before, err := modifiedFiles()
+	if err != nil {
+		warnf("--generate can't detect changed files outside a git work tree: %v", err)
+	}
+
+	args := []string{"generate"}
+	if buildTags != "" {
+		args = append(args, "-tags="+buildTags)
+	}
+	if verbose {
+		args = append(args, "-v")
+	}
+	cmd := goCommandContext(ctx, append(args, packages...)...)
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+	if verbose {
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	}
+	debugf("running %s", strings.Join(cmd.Args, " "))
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("go generate: %v\n%s", err, strings.TrimSpace(out.String()))
+	}
+	if before == nil {
+		return nil, nil
+	}
+
+	after, err := modifiedFiles()
+	if err != nil {
+		return nil, err
+	}
+	changed := []string{}
+	for _, file := range sortedKeys(after) {
+		if sum, ok := before[file]; !ok || sum != after[file] {
+			changed = append(changed, file)
+		}
+	}
+	return changed, nil
+}
+
+// modifiedFiles returns the tracked files that differ from the index, with
+// a hash of their content ("" for deleted files)
+func modifiedFiles() (map[string]string, error) {
+	out, err := gitOutput("ls-files", "--modified", "--full-name")
+	if err != nil {
+		return nil, err
+	}
+	root, err := gitOutput("rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]string)
+	for _, file := range strings.Split(out, "\n") {
+		if file == "" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(file)))
+		if err != nil {
+			files[file] = ""
+			continue
+		}
+		files[file] = fmt.Sprintf("%x", sha256.Sum256(data))
+	}
+	return files, nil
+}
+
+// printGenerateDrift lists the files go generate changed
+func printGenerateDrift(files []string) {
+	if len(files) == 0 {
+		fmt.Println("\nGenerated files: up to date")
+		return
+	}
+	fmt.Printf("\nOUT-OF-DATE GENERATED FILES (%d, run 'go generate' and commit them):\n", len(files))
+	for _, file := range files {
+		fmt.Printf("  %s\n", file)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// goEnv holds toolchain environment overrides (GOFLAGS, GOEXPERIMENT,
+// CGO_ENABLED, ...) applied to every go command gotest runs
+var goEnv = make(map[string]string)
+
+// goBinary is the go command to invoke; --go can point it at a
+// golang.org/dl wrapper such as go1.22.4
+var goBinary = "go"
+
+// goCommand returns a go command that runs with the toolchain overrides
+func goCommand(args ...string) *exec.Cmd {
+	return goCommandContext(context.Background(), args...)
+}
+
+// goCommandContext is goCommand with a context that kills the command
+// when canceled
+func goCommandContext(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, goBinary, args...)
+	cmd.Env = withEnv(os.Environ(), goEnv)
+	debugf("running %s %s", goBinary, strings.Join(args, " "))
+	return cmd
+}
+
+// goTestCommand returns a go command for running tests, which additionally
+// gets the test environment
+func goTestCommand(args ...string) *exec.Cmd {
+	cmd := goCommand(args...)
+	cmd.Env = testEnviron()
+	return cmd
+}
+
+// testEnviron returns the environment for running tests: toolchain
+// overrides plus the test environment
+func testEnviron() []string {
+	return withEnv(withEnv(os.Environ(), goEnv), testEnv)
+}
+
+// withEnv appends vars to env in a stable order. Values may reference other
+// variables as $VAR or ${VAR}.
+func withEnv(env []string, vars map[string]string) []string {
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		env = append(env, k+"="+os.ExpandEnv(vars[k]))
+	}
+	return env
+}
+
+// printGoEnv prints the effective toolchain environment, as reported by
+// go env under the overrides, for reproducing a run
+func printGoEnv() {
+	vars := []string{"GOVERSION", "GOOS", "GOARCH", "GOFLAGS", "GOEXPERIMENT", "CGO_ENABLED", "GOTOOLCHAIN"}
+	out, err := goCommand(append([]string{"env"}, vars...)...).Output()
+	if err != nil {
+		warnf("could not read go env: %v", err)
+		return
+	}
+
+	values := strings.Split(strings.TrimRight(string(out), "\n"), "\n")
+	fmt.Println("Environment:")
+	for i, name := range vars {
+		if i < len(values) {
+			fmt.Printf("  %s=%s\n", name, values[i])
+		}
+	}
+	fmt.Println()
+}
+
+// selectGoVersion arranges for all go commands to use the given Go version.
+// An installed golang.org/dl wrapper (e.g. go1.22.4) is preferred; otherwise
+// GOTOOLCHAIN makes the go command download and run that toolchain.
+func selectGoVersion(version string) error {
+	toolchain := resolveGoVersion(version)
+
+	via := "GOTOOLCHAIN"
+	if path, err := exec.LookPath(toolchain); err == nil {
+		goBinary = path
+		via = path
+	} else {
+		goEnv["GOTOOLCHAIN"] = toolchain
+	}
+
+	out, err := goCommand("version").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("selecting %s via %s: %v\n%s", toolchain, via, err, strings.TrimSpace(string(out)))
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) < 3 || fields[2] != toolchain {
+		return fmt.Errorf("requested %s, but %s reports %q", toolchain, via, strings.TrimSpace(string(out)))
+	}
+
+	infof("Using %s (via %s)", toolchain, via)
+	return nil
+}
+
+// resolveGoVersion turns a version like "1.22.4" or "1.22" into a toolchain
+// name. A bare language version from Go 1.21 on resolves to its latest
+// patch release, which is looked up on go.dev; if that fails, the .0
+// release is used. Before Go 1.21 the first release of a language version
+// had no .0, so "1.20" is go1.20, and prereleases such as "1.21rc2" are
+// taken as they are.
+func resolveGoVersion(version string) string {
+	version = strings.TrimPrefix(version, "go")
+	major, minor, _ := strings.Cut(version, ".")
+	m, errMajor := strconv.Atoi(major)
+	n, errMinor := strconv.Atoi(minor)
+	if errMajor != nil || errMinor != nil || m == 1 && n < 21 {
+		return "go" + version
+	}
+
+	for _, r := range stableGoReleases() {
+		if strings.HasPrefix(r, "go"+version+".") {
+			return r
+		}
+	}
+	return "go" + version + ".0"
+}
+
+// goReleases caches the stable releases listed on go.dev, newest first, so
+// a run asks for them at most once
+var goReleases struct {
+	fetched  bool
+	versions []string
+}
+
+// stableGoReleases returns the stable Go releases, or none if go.dev can't
+// be reached
+func stableGoReleases() []string {
+	if goReleases.fetched {
+		return goReleases.versions
+	}
+	goReleases.fetched = true
+
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get("https://go.dev/dl/?mode=json&include=all")
+	if err != nil {
+		debugf("listing Go releases: %v", err)
+		return nil
+	}
+	defer resp.Body.Close()
+	var releases []struct {
+		Version string `json:"version"`
+		Stable  bool   `json:"stable"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
+		debugf("listing Go releases: %v", err)
+		return nil
+	}
+	for _, r := range releases {
+		if r.Stable {
+			goReleases.versions = append(goReleases.versions, r.Version)
+		}
+	}
+	return goReleases.versions
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestResolveGoVersion(t *testing.T) {
+	goReleases.fetched, goReleases.versions = true, []string{"go1.23.2", "go1.23.1", "go1.22.8", "go1.21.13"}
+	defer func() { goReleases.fetched, goReleases.versions = false, nil }()
+
+	tests := []struct {
+		version, want string
+	}{
+		{"1.23", "go1.23.2"},
+		{"go1.22", "go1.22.8"},
+		{"1.21", "go1.21.13"},
+		// Not listed, e.g. when go.dev couldn't be reached
+		{"1.24", "go1.24.0"},
+		{"1.22.4", "go1.22.4"},
+		{"1.20", "go1.20"},
+		{"1.19", "go1.19"},
+		{"1.21rc2", "go1.21rc2"},
+		{"1.23.0", "go1.23.0"},
+		{"1", "go1"},
+	}
+	for _, tt := range tests {
+		if got := resolveGoVersion(tt.version); got != tt.want {
+			t.Errorf("resolveGoVersion(%q) = %q, want %q", tt.version, got, tt.want)
+		}
+	}
+}
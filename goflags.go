@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// goTestFlagSpec describes a flag of go test or the go build flags it
+// accepts
+type goTestFlagSpec struct {
+	value    bool   // takes a value, as "-run X" or "-run=X"
+	conflict string // why gotest rejects the flag, "" if it doesn't
+}
+
+// goTestFlags lists every flag go test knows, by name without dashes. Test
+// flags are also accepted in their -test. form. Flags that aren't listed
+// are passed to the test binary by go test, and are taken to be boolean.
+var goTestFlags = map[string]goTestFlagSpec{
+	// Build flags
+	"C": {value: true}, "a": {}, "asan": {}, "asmflags": {value: true},
+	"buildmode": {value: true}, "buildvcs": {}, "compiler": {value: true},
+	"cover": {}, "covermode": {value: true}, "gccgoflags": {value: true},
+	"gcflags": {value: true}, "installsuffix": {value: true}, "ldflags": {value: true},
+	"linkshared": {}, "mod": {value: true}, "modcacherw": {}, "modfile": {value: true},
+	"msan": {}, "n": {}, "overlay": {value: true}, "p": {value: true},
+	"pgo": {value: true}, "pkgdir": {value: true}, "race": {}, "tags": {value: true},
+	"toolexec": {value: true}, "trimpath": {}, "work": {}, "x": {},
+	"coverpkg": {value: true, conflict: "gotest measures coverage across all discovered packages itself"},
+
+	// go test's own flags
+	"exec": {value: true}, "vet": {value: true},
+	"c":    {conflict: "gotest runs the tests; use 'gotest build' to only compile them"},
+	"o":    {value: true, conflict: "gotest runs the test binaries and doesn't keep them; use 'go test -c -o' to build one"},
+	"json": {conflict: "gotest reads go test's text output"},
+
+	// Test binary flags
+	"bench": {value: true}, "benchmem": {}, "benchtime": {value: true},
+	"blockprofile": {value: true}, "blockprofilerate": {value: true},
+	"count": {value: true}, "coverprofile": {value: true}, "cpu": {value: true},
+	"cpuprofile": {value: true}, "failfast": {}, "fullpath": {},
+	"fuzz": {value: true}, "fuzzcachedir": {value: true}, "fuzzminimizetime": {value: true},
+	"fuzztime": {value: true}, "memprofile": {value: true}, "memprofilerate": {value: true},
+	"mutexprofile": {value: true}, "mutexprofilefraction": {value: true},
+	"outputdir": {value: true}, "parallel": {value: true}, "run": {value: true},
+	"short": {}, "shuffle": {value: true}, "skip": {value: true},
+	"timeout": {value: true}, "trace": {value: true}, "v": {},
+	"list": {value: true, conflict: "-list doesn't run the tests; use 'gotest list'"},
+}
+
+// lookupGoTestFlag returns the name and description of the go test flag
+// arg, with or without "=value"
+func lookupGoTestFlag(arg string) (string, goTestFlagSpec, bool) {
+	if !strings.HasPrefix(arg, "-") {
+		return "", goTestFlagSpec{}, false
+	}
+	name, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+	spec, ok := goTestFlags[name]
+	if !ok {
+		if short, found := strings.CutPrefix(name, "test."); found {
+			name = short
+			spec, ok = goTestFlags[name]
+		}
+	}
+	return name, spec, ok
+}
+
+// takesValue reports whether a go test flag without "=" consumes the next
+// argument
+func takesValue(arg string) bool {
+	if strings.Contains(arg, "=") {
+		return false
+	}
+	_, spec, ok := lookupGoTestFlag(arg)
+	return ok && spec.value
+}
+
+// goTestFlag returns the value of the go test flag name (without dashes,
+// also accepted in its -test. form) in args; the last one given wins
+func goTestFlag(args []string, name string) (string, bool) {
+	var value string
+	found := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "-args" || arg == "--args" {
+			break
+		}
+		flag, v, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || strings.TrimPrefix(flag, "test.") != name {
+			if takesValue(arg) {
+				i++
+			}
+			continue
+		}
+		if !hasValue && i+1 < len(args) {
+			i++
+			v = args[i]
+		}
+		value, found = v, true
+	}
+	return value, found
+}
+
+// insertGoTestFlags adds flags to the go test arguments, before -args
+func insertGoTestFlags(args []string, flags ...string) []string {
+	for i, arg := range args {
+		if arg == "-args" || arg == "--args" {
+			return append(append(append([]string(nil), args[:i]...), flags...), args[i:]...)
+		}
+	}
+	return append(append([]string(nil), args...), flags...)
+}
+
+// extractCoverFlags takes the -coverprofile and -covermode flags out of the
+// go test arguments, since gotest passes its own, and makes gotest use their
+// values: the profile is written where the user asked, and the summary and
+// HTML report are made from it.
+func extractCoverFlags(args []string) ([]string, error) {
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "-args" || arg == "--args" {
+			return append(rest, args[i:]...), nil
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		name = strings.TrimPrefix(name, "test.")
+		if !strings.HasPrefix(arg, "-") || name != "coverprofile" && name != "covermode" {
+			rest = append(rest, arg)
+			if takesValue(arg) && i+1 < len(args) {
+				i++
+				rest = append(rest, args[i])
+			}
+			continue
+		}
+		if !hasValue {
+			if i+1 == len(args) {
+				return nil, fmt.Errorf("flag %s needs a value", arg)
+			}
+			i++
+			value = args[i]
+		}
+
+		switch name {
+		case "coverprofile":
+			userCoverProfile = value
+		case "covermode":
+			if value != "set" && value != "count" && value != "atomic" {
+				return nil, fmt.Errorf("invalid -covermode value %q (expected set, count or atomic)", value)
+			}
+			coverMode = value
+			coverModeSet = true
+		}
+	}
+	return rest, nil
+}
+
+// checkGoTestFlags reports go test flags among args that gotest sets itself
+// or that it can't work with, instead of passing them on for go test to
+// receive twice or gotest to misread its output. Arguments after -args
+// belong to the test binary and are not checked.
+func checkGoTestFlags(args []string) error {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "-args" || arg == "--args" {
+			break
+		}
+		if _, spec, ok := lookupGoTestFlag(arg); ok && spec.conflict != "" {
+			return fmt.Errorf("go test flag %s conflicts with gotest: %s", arg, spec.conflict)
+		}
+		if takesValue(arg) {
+			i++
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTakesValue(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want bool
+	}{
+		{"-run", true},
+		{"--run", true},
+		{"-test.run", true},
+		{"-run=TestA", false},
+		{"-count", true},
+		{"-tags", true},
+		{"-ldflags", true},
+		{"-C", true},
+		{"-v", false},
+		{"-test.v", false},
+		{"-race", false},
+		{"-short", false},
+		{"-trimpath", false},
+		{"-benchmem", false},
+		{"-myflag", false},
+		{"run", false},
+	}
+	for _, tt := range tests {
+		if got := takesValue(tt.arg); got != tt.want {
+			t.Errorf("takesValue(%q) = %v, want %v", tt.arg, got, tt.want)
+		}
+	}
+}
+
+func TestGoTestFlag(t *testing.T) {
+	tests := []struct {
+		args  []string
+		name  string
+		want  string
+		found bool
+	}{
+		{[]string{"-run", "TestA"}, "run", "TestA", true},
+		{[]string{"-run=TestA"}, "run", "TestA", true},
+		{[]string{"-test.run", "TestA"}, "run", "TestA", true},
+		{[]string{"-run", "TestA", "-run=TestB"}, "run", "TestB", true},
+		{[]string{"-v", "-count", "1"}, "count", "1", true},
+		// The value of another flag isn't taken for a flag itself
+		{[]string{"-tags", "-run", "-v"}, "run", "", false},
+		{[]string{"-v", "-short"}, "run", "", false},
+		{[]string{"-args", "-run", "TestA"}, "run", "", false},
+	}
+	for _, tt := range tests {
+		got, found := goTestFlag(tt.args, tt.name)
+		if got != tt.want || found != tt.found {
+			t.Errorf("goTestFlag(%q, %q) = %q, %v; want %q, %v", tt.args, tt.name, got, found, tt.want, tt.found)
+		}
+	}
+}
+
+func TestExtractCoverFlags(t *testing.T) {
+	tests := []struct {
+		args        []string
+		rest        []string
+		profile     string
+		mode        string
+		errContains string
+	}{
+		{args: []string{"-v", "-run", "TestA"}, rest: []string{"-v", "-run", "TestA"}},
+		{args: []string{"-coverprofile", "c.out", "-v"}, rest: []string{"-v"}, profile: "c.out"},
+		{args: []string{"-test.coverprofile=c.out"}, profile: "c.out"},
+		{args: []string{"-covermode=count", "-short"}, rest: []string{"-short"}, mode: "count"},
+		// A flag's value that looks like a cover flag is kept with it
+		{args: []string{"-run", "-coverprofile"}, rest: []string{"-run", "-coverprofile"}},
+		{args: []string{"-args", "-coverprofile", "c.out"}, rest: []string{"-args", "-coverprofile", "c.out"}},
+		{args: []string{"-covermode=sometimes"}, errContains: "invalid -covermode"},
+		{args: []string{"-coverprofile"}, errContains: "needs a value"},
+	}
+	for _, tt := range tests {
+		userCoverProfile, coverMode, coverModeSet = "", "", false
+		rest, err := extractCoverFlags(tt.args)
+		if tt.errContains != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+				t.Errorf("extractCoverFlags(%q) error = %v, want %q", tt.args, err, tt.errContains)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(rest, tt.rest) || userCoverProfile != tt.profile || coverMode != tt.mode {
+			t.Errorf("extractCoverFlags(%q) = %q, %v (profile %q, mode %q); want %q (profile %q, mode %q)",
+				tt.args, rest, err, userCoverProfile, coverMode, tt.rest, tt.profile, tt.mode)
+		}
+	}
+	userCoverProfile, coverMode, coverModeSet = "", "", false
+}
+
+func TestCheckGoTestFlags(t *testing.T) {
+	tests := []struct {
+		args []string
+		bad  string
+	}{
+		{[]string{"-v", "-race", "-run", "TestA", "-count=1"}, ""},
+		{[]string{"-json"}, "-json"},
+		{[]string{"--json"}, "--json"},
+		{[]string{"-test.list", "."}, "-test.list"},
+		{[]string{"-coverpkg=./..."}, "-coverpkg=./..."},
+		{[]string{"-c"}, "-c"},
+		{[]string{"-o", "x.test"}, "-o"},
+		// Values and test binary arguments aren't flags of go test
+		{[]string{"-run", "-json"}, ""},
+		{[]string{"-skip", "-c", "-v"}, ""},
+		{[]string{"-args", "-json"}, ""},
+		{[]string{"-myflag", "-json"}, "-json"},
+	}
+	for _, tt := range tests {
+		err := checkGoTestFlags(tt.args)
+		switch {
+		case tt.bad == "" && err != nil:
+			t.Errorf("checkGoTestFlags(%q) = %v, want nil", tt.args, err)
+		case tt.bad != "" && (err == nil || !strings.Contains(err.Error(), "flag "+tt.bad+" conflicts")):
+			t.Errorf("checkGoTestFlags(%q) = %v, want a conflict for %s", tt.args, err, tt.bad)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"go/scanner"
+	"go/token"
+	"html"
+	"html/template"
+	"strings"
+)
+
+// predeclared are the identifiers of the universe scope, highlighted like
+// keywords are
+var predeclared = map[string]bool{
+	"any": true, "bool": true, "byte": true, "comparable": true, "complex64": true, "complex128": true,
+	"error": true, "float32": true, "float64": true, "int": true, "int8": true, "int16": true,
+	"int32": true, "int64": true, "rune": true, "string": true, "uint": true, "uint8": true,
+	"uint16": true, "uint32": true, "uint64": true, "uintptr": true,
+	"true": true, "false": true, "iota": true, "nil": true,
+	"append": true, "cap": true, "clear": true, "close": true, "complex": true, "copy": true,
+	"delete": true, "imag": true, "len": true, "make": true, "max": true, "min": true, "new": true,
+	"panic": true, "print": true, "println": true, "real": true, "recover": true,
+}
+
+// highlightGo splits Go source into lines of HTML with the tokens wrapped
+// in spans of class kw (keywords), bi (predeclared identifiers), fn
+// (declared function names), str, num and com (comments). It only
+// tokenizes, so source that doesn't compile is highlighted as far as it
+// goes.
+func highlightGo(src []byte) []template.HTML {
+	var lines []template.HTML
+	var line strings.Builder
+	// write adds text to the current line, wrapped in a span of class; a
+	// token spanning lines, such as a raw string, gets a span on each
+	write := func(text, class string) {
+		for i, part := range strings.Split(text, "\n") {
+			if i > 0 {
+				lines = append(lines, template.HTML(line.String()))
+				line.Reset()
+			}
+			part = strings.TrimSuffix(part, "\r")
+			if part == "" {
+				continue
+			}
+			if class == "" {
+				line.WriteString(html.EscapeString(part))
+			} else {
+				line.WriteString(`<span class="` + class + `">` + html.EscapeString(part) + `</span>`)
+			}
+		}
+	}
+
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+	var s scanner.Scanner
+	s.Init(file, src, func(token.Position, string) {}, scanner.ScanComments)
+	offset := 0
+	// name tracks a declaration from func to its name: after func, or
+	// after the receiver of a method declared at the top level
+	const (
+		none = iota
+		afterFunc
+		inReceiver
+		afterReceiver
+	)
+	name, depth := none, 0
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.SEMICOLON && lit == "\n" {
+			// Inserted automatically; the newline is written as text
+			continue
+		}
+		start := file.Offset(pos)
+		text := lit
+		if text == "" {
+			text = tok.String()
+		}
+		end := tokenEnd(src, start, text)
+		write(string(src[offset:start]), "")
+
+		class := ""
+		switch {
+		case tok.IsKeyword():
+			class = "kw"
+		case tok == token.STRING || tok == token.CHAR:
+			class = "str"
+		case tok == token.INT || tok == token.FLOAT || tok == token.IMAG:
+			class = "num"
+		case tok == token.COMMENT:
+			class = "com"
+		case tok == token.IDENT && (name == afterFunc || name == afterReceiver):
+			class = "fn"
+		case tok == token.IDENT && predeclared[lit]:
+			class = "bi"
+		}
+		write(string(src[start:end]), class)
+		offset = end
+
+		switch {
+		case tok == token.FUNC:
+			name = afterFunc
+			if file.Position(pos).Column != 1 {
+				// A function literal or type; the parenthesis is not a receiver
+				name = none
+			}
+		case name == afterFunc && tok == token.LPAREN:
+			name, depth = inReceiver, 0
+		case name == inReceiver && (tok == token.LPAREN || tok == token.LBRACK):
+			depth++
+		case name == inReceiver && (tok == token.RPAREN || tok == token.RBRACK):
+			if depth == 0 {
+				name = afterReceiver
+			} else {
+				depth--
+			}
+		case name == inReceiver || tok == token.COMMENT:
+		default:
+			name = none
+		}
+	}
+	write(string(src[offset:]), "")
+	if line.Len() > 0 {
+		lines = append(lines, template.HTML(line.String()))
+	}
+	return lines
+}
+
+// tokenEnd returns the offset in src where the token at start ends. The
+// scanner drops carriage returns from raw strings and comments, so text
+// may be shorter than the token as written.
+func tokenEnd(src []byte, start int, text string) int {
+	i := start
+	for j := 0; j < len(text) && i < len(src); i++ {
+		if src[i] == text[j] {
+			j++
+		} else if src[i] != '\r' {
+			break
+		}
+	}
+	return i
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"html/template"
+	"reflect"
+	"testing"
+)
+
+func TestHighlightGo(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []template.HTML
+	}{
+		{
+			name: "declaration",
+			src:  "func (s *T) Len() int { return len(s.x) }",
+			want: []template.HTML{`<span class="kw">func</span> (s *T) <span class="fn">Len</span>() <span class="bi">int</span> { <span class="kw">return</span> <span class="bi">len</span>(s.x) }`},
+		},
+		{
+			name: "raw string with quotes and comment markers",
+			src:  "s := `say \"hi\" // not a comment`",
+			want: []template.HTML{`s := <span class="str">` + "`" + `say &#34;hi&#34; // not a comment` + "`" + `</span>`},
+		},
+		{
+			name: "raw string over lines",
+			src:  "s := `a\n/* b\nc` + x",
+			want: []template.HTML{
+				`s := <span class="str">` + "`" + `a</span>`,
+				`<span class="str">/* b</span>`,
+				`<span class="str">c` + "`" + `</span> + x`,
+			},
+		},
+		{
+			name: "raw string with CRLF line endings",
+			src:  "s := `a\r\nb`\r\nx := 1",
+			want: []template.HTML{
+				`s := <span class="str">` + "`" + `a</span>`,
+				`<span class="str">b` + "`" + `</span>`,
+				`x := <span class="num">1</span>`,
+			},
+		},
+		{
+			name: "runes with quotes",
+			src:  `q, a, b := '"', '\'', '\\'`,
+			want: []template.HTML{`q, a, b := <span class="str">&#39;&#34;&#39;</span>, <span class="str">&#39;\&#39;&#39;</span>, <span class="str">&#39;\\&#39;</span>`},
+		},
+		{
+			name: "string with comment markers and escaped quote",
+			src:  `s := "a // b /* c \" d" // real`,
+			want: []template.HTML{`s := <span class="str">&#34;a // b /* c \&#34; d&#34;</span> <span class="com">// real</span>`},
+		},
+		{
+			name: "comments with quotes",
+			src:  "// it's \"quoted\"\n/* don't `end` here\n*/ x",
+			want: []template.HTML{
+				`<span class="com">// it&#39;s &#34;quoted&#34;</span>`,
+				`<span class="com">/* don&#39;t ` + "`" + `end` + "`" + ` here</span>`,
+				`<span class="com">*/</span> x`,
+			},
+		},
+		{
+			name: "unterminated string",
+			src:  "s := \"abc\nx := 1",
+			want: []template.HTML{
+				`s := <span class="str">&#34;abc</span>`,
+				`x := <span class="num">1</span>`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := highlightGo([]byte(tt.src)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("highlightGo(%q) =\n%q\nwant\n%q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
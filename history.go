@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Hoofffman/gotest/pkg/coverprofile"
+)
+
+// historyRun is one line of the run history: the run summary plugins get,
+// plus the coverage of every package in the coverage table and the
+// flakiness score of every test that flipped within the runs up to it
+type historyRun struct {
+	runSummary
+	PackageCoverage map[string]float64 `json:"package_coverage"`
+	Flakiness       map[string]float64 `json:"flakiness,omitempty"`
+}
+
+// historyPath returns the history file of the current directory. Histories
+// live in the user cache directory, one per project directory, unless
+// GOTEST_HISTORY names a file. Each suite run by "gotest suite" (which sets
+// GOTEST_SUITE) has its own history.
+func historyPath() (string, error) {
+	suffix := ""
+	if suite := os.Getenv("GOTEST_SUITE"); suite != "" {
+		suffix = "-" + suite
+	}
+	if path := os.Getenv("GOTEST_HISTORY"); path != "" {
+		ext := filepath.Ext(path)
+		return strings.TrimSuffix(path, ext) + suffix + ext, nil
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(cwd))
+	return filepath.Join(cacheDir, "gotest", "history", hex.EncodeToString(sum[:8])+suffix+".jsonl"), nil
+}
+
+// loadHistory returns the recorded runs, oldest first. A missing history is
+// empty; unreadable lines are skipped.
+func loadHistory() ([]historyRun, error) {
+	path, err := historyPath()
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var runs []historyRun
+	scanner := bufio.NewScanner(file)
+	// Failure output makes for long lines
+	scanner.Buffer(make([]byte, 64*1024), 64<<20)
+	for scanner.Scan() {
+		var run historyRun
+		if json.Unmarshal(scanner.Bytes(), &run) == nil {
+			runs = append(runs, run)
+		}
+	}
+	return runs, scanner.Err()
+}
+
+// recordRun appends the run to the history
+func recordRun(ctx context.Context, summary runSummary) error {
+	run := historyRun{runSummary: summary, PackageCoverage: make(map[string]float64)}
+	if profile, err := coverprofile.ParseFile(ctx, summary.CoverProfile); err == nil {
+		for _, stats := range profile.Packages() {
+			run.PackageCoverage[stats.Package] = stats.Percent()
+		}
+	}
+	if runs, err := loadHistory(); err == nil {
+		window := append(recentRuns(runs, flakinessWindow-1), run)
+		run.Flakiness = flakinessMap(flakinessScores(window))
+	}
+	data, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+
+	path, err := historyPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// coverageBaseline is the coverage a run is compared with: per package, the
+// coverage recorded by the latest run that included it, and the previous run
+type coverageBaseline struct {
+	Packages map[string]float64
+	Last     *historyRun
+}
+
+// previousCoverage builds the coverage baseline from the history
+func previousCoverage(runs []historyRun) *coverageBaseline {
+	if len(runs) == 0 {
+		return nil
+	}
+	baseline := &coverageBaseline{Packages: make(map[string]float64), Last: &runs[len(runs)-1]}
+	for _, run := range runs {
+		for pkg, pct := range run.PackageCoverage {
+			baseline.Packages[pkg] = pct
+		}
+	}
+	return baseline
+}
+
+// packages returns the per-package baseline; a nil baseline has none
+func (b *coverageBaseline) packages() map[string]float64 {
+	if b == nil {
+		return nil
+	}
+	return b.Packages
+}
+
+// total returns the total coverage of the previous run, if it covered the
+// same packages; otherwise the totals aren't comparable
+func (b *coverageBaseline) total(packages []coverprofile.PackageStats) (float64, bool) {
+	if b == nil || len(b.Last.PackageCoverage) != len(packages) {
+		return 0, false
+	}
+	for _, stats := range packages {
+		if _, ok := b.Last.PackageCoverage[stats.Package]; !ok {
+			return 0, false
+		}
+	}
+	return b.Last.Coverage.Percent, true
+}
+
+// formatDelta formats a coverage change right-aligned in width columns,
+// colored if the terminal supports it. Changes that round to zero are blank.
+func formatDelta(delta float64, width int) string {
+	text := fmt.Sprintf("%+.1f%%", delta)
+	if text == "+0.0%" || text == "-0.0%" {
+		return fmt.Sprintf("%*s", width, "")
+	}
+	text = fmt.Sprintf("%*s", width, text)
+	if delta > 0 {
+		return colorize(text, colorGreen)
+	}
+	return colorize(text, colorRed)
+}
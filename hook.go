@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// hookMarker identifies hooks written by install-hook, so they can be
+// replaced without --force
+const hookMarker = "# Installed by gotest install-hook"
+
+// hookBase is the ref each hook type compares against: a pre-commit hook
+// checks the uncommitted changes, a pre-push hook everything not yet
+// pushed to the upstream branch
+var hookBase = map[string]string{
+	"pre-commit": `base=HEAD`,
+	"pre-push":   `base=$(git rev-parse --abbrev-ref --symbolic-full-name '@{upstream}' 2>/dev/null) || base=HEAD~1`,
+}
+
+// runInstallHook implements "gotest install-hook [pre-push|pre-commit]
+// [--force] [gotest options...]". Extra options are added to the gotest
+// command in the hook.
+func runInstallHook(args []string) error {
+	hook := "pre-push"
+	force := false
+	var extra []string
+	for i, arg := range args {
+		switch {
+		case i == 0 && hookBase[arg] != "":
+			hook = arg
+		case arg == "--force" || arg == "-force":
+			force = true
+		default:
+			extra = append(extra, arg)
+		}
+	}
+	if len(args) > 0 && strings.HasPrefix(args[0], "pre-") && hookBase[args[0]] == "" {
+		return fmt.Errorf("unsupported hook %q (expected pre-push or pre-commit)", args[0])
+	}
+
+	out, err := exec.Command("git", "rev-parse", "--git-path", "hooks").Output()
+	if err != nil {
+		return fmt.Errorf("not in a git repository: %w", commandError(err))
+	}
+	dir := strings.TrimSpace(string(out))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating hooks directory: %w", err)
+	}
+	path := filepath.Join(dir, hook)
+
+	if existing, err := os.ReadFile(path); err == nil && !strings.Contains(string(existing), hookMarker) && !force {
+		return fmt.Errorf("%s already exists; use --force to replace it", path)
+	}
+
+	if err := os.WriteFile(path, []byte(hookScript(hook, extra)), 0755); err != nil {
+		return fmt.Errorf("writing hook: %w", err)
+	}
+	fmt.Printf("Installed %s hook: %s\n", hook, path)
+	return nil
+}
+
+// hookScript returns a hook running gotest in a fast mode: only packages
+// changed since the hook's base ref, without opening the browser
+func hookScript(hook string, extra []string) string {
+	var quoted []string
+	for _, arg := range extra {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	options := ""
+	if len(quoted) > 0 {
+		options = " " + strings.Join(quoted, " ")
+	}
+
+	return fmt.Sprintf(`#!/bin/sh
+%s
+# Set GOTEST to use a different binary, or skip with git's --no-verify.
+
+%s
+exec "${GOTEST:-gotest}" --since "$base" --no-browser%s
+`, hookMarker, hookBase[hook], options)
+}
+
+// shellQuote quotes s for a POSIX shell if needed
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./=,:@", r))
+	}) == -1 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/Hoofffman/gotest/pkg/coverprofile"
+)
+
+// hotFunc is a function with how often it was called, taken from the count
+// of its first block
+type hotFunc struct {
+	Name  string
+	Pos   string
+	Calls int
+}
+
+// printHotPaths lists the n most executed blocks and functions of the
+// profile. Counts are only recorded in count and atomic mode.
+func printHotPaths(ctx context.Context, coverProfile string, n int) error {
+	profile, err := coverprofile.ParseFile(ctx, coverProfile)
+	if err != nil {
+		return err
+	}
+	if profile.Mode == "set" {
+		fmt.Println("\n--hot needs execution counts; the profile was recorded in set mode")
+		return nil
+	}
+
+	blocks := make([]coverprofile.Block, 0, len(profile.Blocks))
+	for _, b := range profile.Blocks {
+		if b.Count > 0 {
+			blocks = append(blocks, b)
+		}
+	}
+	if len(blocks) == 0 {
+		return nil
+	}
+	sort.SliceStable(blocks, func(i, j int) bool { return blocks[i].Count > blocks[j].Count })
+
+	fmt.Println()
+	fmt.Println(strings.Repeat("=", 60))
+	fmt.Println("HOT STATEMENTS")
+	fmt.Println(strings.Repeat("=", 60))
+	for _, b := range blocks[:min(n, len(blocks))] {
+		fmt.Printf("%12d  %s:%d (%d statement(s))\n", b.Count, localPath(b.File), b.StartLine, b.NumStmt)
+	}
+
+	funcs, err := hotFunctions(ctx, profile)
+	if err != nil {
+		return err
+	}
+	if len(funcs) > 0 {
+		fmt.Println()
+		fmt.Println("HOT FUNCTIONS")
+		fmt.Println(strings.Repeat("-", 60))
+		for _, f := range funcs[:min(n, len(funcs))] {
+			fmt.Printf("%12d  %s (%s)\n", f.Calls, f.Name, f.Pos)
+		}
+	}
+	fmt.Println(strings.Repeat("=", 60))
+	return nil
+}
+
+// hotFunctions returns the executed functions of the profile by number of
+// calls, most called first. The function of a block is found by parsing its
+// file; files that can't be found or parsed are left out.
+func hotFunctions(ctx context.Context, profile *coverprofile.Profile) ([]hotFunc, error) {
+	dirs, err := packageDirs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byFile := make(map[string][]coverprofile.Block)
+	for _, b := range profile.Blocks {
+		byFile[b.File] = append(byFile[b.File], b)
+	}
+
+	var funcs []hotFunc
+	fset := token.NewFileSet()
+	for name, blocks := range byFile {
+		file, err := parser.ParseFile(fset, sourcePath(name, dirs), nil, parser.SkipObjectResolution)
+		if err != nil {
+			continue
+		}
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+			start := fset.Position(fn.Body.Lbrace)
+			end := fset.Position(fn.Body.Rbrace)
+
+			// The first block of the body runs once per call
+			var first *coverprofile.Block
+			for i, b := range blocks {
+				if b.StartLine < start.Line || b.StartLine > end.Line {
+					continue
+				}
+				if first == nil || b.StartLine < first.StartLine || b.StartLine == first.StartLine && b.StartCol < first.StartCol {
+					first = &blocks[i]
+				}
+			}
+			if first == nil || first.Count == 0 {
+				continue
+			}
+			funcs = append(funcs, hotFunc{
+				Name:  path.Base(path.Dir(name)) + "." + funcName(fn),
+				Pos:   fmt.Sprintf("%s:%d", localPath(name), fset.Position(fn.Pos()).Line),
+				Calls: first.Count,
+			})
+		}
+	}
+	sort.Slice(funcs, func(i, j int) bool {
+		if funcs[i].Calls != funcs[j].Calls {
+			return funcs[i].Calls > funcs[j].Calls
+		}
+		return funcs[i].Pos < funcs[j].Pos
+	})
+	return funcs, nil
+}
+
+// funcName returns a function's name, qualified by its receiver type
+func funcName(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return fn.Name.Name
+	}
+	typ := fn.Recv.List[0].Type
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	if index, ok := typ.(*ast.IndexExpr); ok {
+		typ = index.X
+	}
+	if index, ok := typ.(*ast.IndexListExpr); ok {
+		typ = index.X
+	}
+	if ident, ok := typ.(*ast.Ident); ok {
+		return ident.Name + "." + fn.Name.Name
+	}
+	return fn.Name.Name
+}
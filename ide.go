@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Hoofffman/gotest/pkg/runner"
+)
+
+// ideProtocolVersion is the version of the --ide-protocol events; it
+// changes when fields are removed or change meaning
+const ideProtocolVersion = 1
+
+// ideProtocol is where --ide-protocol events go: "fd:<n>" (or just a
+// number) for an open file descriptor, "unix:<path>" for a Unix socket
+var ideProtocol string
+
+// ideEvent is one JSON line of the IDE protocol
+type ideEvent struct {
+	Event           string             `json:"event"`
+	Time            time.Time          `json:"time"`
+	Version         int                `json:"version,omitempty"`
+	Packages        []string           `json:"packages,omitempty"`
+	Package         string             `json:"package,omitempty"`
+	ImportPath      string             `json:"import_path,omitempty"`
+	Test            string             `json:"test,omitempty"`
+	ID              string             `json:"id,omitempty"`
+	Status          string             `json:"status,omitempty"`
+	Cached          bool               `json:"cached,omitempty"`
+	DurationSeconds float64            `json:"duration_seconds,omitempty"`
+	Output          string             `json:"output,omitempty"`
+	Coverage        *summaryCoverage   `json:"coverage,omitempty"`
+	PackageCoverage map[string]float64 `json:"package_coverage,omitempty"`
+	ExitCode        *int               `json:"exit_code,omitempty"`
+	Error           string             `json:"error,omitempty"`
+}
+
+var ide struct {
+	mu sync.Mutex
+	w  io.WriteCloser
+}
+
+// openIDEProtocol connects to where --ide-protocol events go
+func openIDEProtocol(spec string) error {
+	if path, ok := strings.CutPrefix(spec, "unix:"); ok {
+		conn, err := net.Dial("unix", path)
+		if err != nil {
+			return fmt.Errorf("connecting to IDE socket: %w", err)
+		}
+		ide.w = conn
+		return nil
+	}
+	fd, err := strconv.Atoi(strings.TrimPrefix(spec, "fd:"))
+	if err != nil || fd < 0 {
+		return fmt.Errorf("invalid --ide-protocol %q (expected fd:<n> or unix:<path>)", spec)
+	}
+	file := os.NewFile(uintptr(fd), "ide-protocol")
+	if file == nil {
+		return fmt.Errorf("invalid file descriptor %d", fd)
+	}
+	ide.w = file
+	return nil
+}
+
+// emitIDE writes an event if --ide-protocol is set. When the IDE goes away
+// the run continues without events.
+func emitIDE(e ideEvent) {
+	ide.mu.Lock()
+	defer ide.mu.Unlock()
+	if ide.w == nil {
+		return
+	}
+	e.Time = time.Now()
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	if _, err := ide.w.Write(append(data, '\n')); err != nil {
+		warnf("IDE protocol disconnected: %v", err)
+		ide.w.Close()
+		ide.w = nil
+	}
+}
+
+// ideProgress reports the runner's progress as IDE events
+func ideProgress(e runner.Event) {
+	event := ideEvent{Event: string(e.Kind), Package: e.Package}
+	switch e.Kind {
+	case runner.EventTestStart:
+		event.Test = e.Test.Name
+	case runner.EventTestFinish:
+		event.Test = e.Test.Name
+		event.Status = string(e.Test.Status)
+		event.DurationSeconds = e.Test.Duration.Seconds()
+		event.Output = e.Test.Output
+	case runner.EventPackageFinish:
+		event.ImportPath = e.Result.ImportPath
+		event.Status = string(e.Result.Status)
+		event.Cached = e.Result.Cached
+		event.DurationSeconds = e.Result.Duration.Seconds()
+	}
+	if event.Test != "" && e.Package != "" {
+		event.ID = testID(e.Package, e.Test.Name)
+	}
+	emitIDE(event)
+}
+
+// emitIDECoverage reports the final coverage of the run
+func emitIDECoverage(summary runSummary) {
+	event := ideEvent{Event: "coverage", Coverage: &summary.Coverage, PackageCoverage: make(map[string]float64)}
+	for _, pkg := range summary.Packages {
+		if pkg.Coverage != nil {
+			event.PackageCoverage[pkg.Package] = pkg.Coverage.Percent
+		}
+	}
+	emitIDE(event)
+}
+
+// closeIDEProtocol reports the end of the run with its exit code
+func closeIDEProtocol(code int, err error) {
+	event := ideEvent{Event: "run_finish", ExitCode: &code}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	emitIDE(event)
+	ide.mu.Lock()
+	defer ide.mu.Unlock()
+	if ide.w != nil {
+		ide.w.Close()
+		ide.w = nil
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+)
+
+// parseJobs parses a --jobs value: a number of parallel go test
+// invocations, or "auto" for one per CPU
+func parseJobs(value string) (int, error) {
+	if value == "auto" {
+		return runtime.GOMAXPROCS(0), nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid --jobs value %q (expected a number or auto)", value)
+	}
+	return n, nil
+}
+
+// parallelism returns the -p (packages built and tested at once) and
+// -parallel (tests at once per package) flags for each of workers parallel
+// go test invocations, and an explanation for detail mode. go test sets both
+// to the number of CPUs; with several invocations each gets its share, so
+// together they don't run workers times more processes and tests than there
+// are CPUs. Values the user passed are kept.
+func parallelism(args []string, workers int) ([]string, string) {
+	cpus := runtime.GOMAXPROCS(0)
+	share := strconv.Itoa(cpus)
+	if workers > 1 {
+		share = strconv.Itoa(max(1, cpus/workers))
+	}
+
+	var flags []string
+	p, userP := goTestFlag(args, "p")
+	if !userP {
+		p = share
+		if workers > 1 {
+			flags = append(flags, "-p="+p)
+		}
+	}
+	parallel, userParallel := goTestFlag(args, "parallel")
+	if !userParallel {
+		parallel = share
+		if workers > 1 {
+			flags = append(flags, "-parallel="+parallel)
+		}
+	}
+
+	if workers <= 1 {
+		return flags, fmt.Sprintf("Parallelism: one go test, %s package(s) at a time (-p), %s test(s) at a time per package (-parallel); %d CPU(s)", p, parallel, cpus)
+	}
+	return flags, fmt.Sprintf("Parallelism: %d go test invocations at a time, each with -p %s and -parallel %s; %d CPU(s)", workers, p, parallel, cpus)
+}
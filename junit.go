@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Hoofffman/gotest/pkg/runner"
+)
+
+// JUnit XML as read by Jenkins, GitLab, Azure Pipelines and most other CI
+// systems: one testsuite per package, one testcase per test or subtest
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// junitSeconds formats a duration the way JUnit expects
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// junitSuites converts the package results of a run to JUnit test suites.
+// A package that failed to build gets a single erroring test case, as it
+// has no test results.
+func junitSuites(result *runner.Result, started time.Time) []junitTestSuite {
+	var suites []junitTestSuite
+	for _, res := range result.Packages {
+		name := res.ImportPath
+		if name == "" {
+			name = res.Package
+		}
+		suite := junitTestSuite{
+			Name:      name,
+			Time:      junitSeconds(res.Duration),
+			Timestamp: started.UTC().Format("2006-01-02T15:04:05"),
+		}
+		for _, t := range res.Tests {
+			tc := junitTestCase{Name: t.Name, Classname: name, Time: junitSeconds(t.Duration)}
+			switch t.Status {
+			case runner.TestFailed:
+				tc.Failure = &junitMessage{Message: "Failed", Body: t.Output}
+				suite.Failures++
+			case runner.TestSkipped:
+				tc.Skipped = &junitMessage{Message: strings.TrimSpace(t.Output)}
+				suite.Skipped++
+			}
+			suite.Cases = append(suite.Cases, tc)
+		}
+		if res.Status == runner.StatusBuildFailed {
+			suite.Cases = append(suite.Cases, junitTestCase{
+				Name:      "build",
+				Classname: name,
+				Time:      junitSeconds(0),
+				Error:     &junitMessage{Message: "Build failed", Body: res.Output},
+			})
+			suite.Errors++
+		}
+		suite.Tests = len(suite.Cases)
+		suites = append(suites, suite)
+	}
+	return suites
+}
+
+// writeJUnit writes the results of a run as one JUnit file with all
+// packages (--junit) and/or one file per package (--junit-dir)
+func writeJUnit(result *runner.Result, started time.Time) error {
+	suites := junitSuites(result, started)
+
+	if junitFile != "" {
+		all := junitTestSuites{Suites: suites, Time: junitSeconds(time.Since(started))}
+		for _, s := range suites {
+			all.Tests += s.Tests
+			all.Failures += s.Failures
+			all.Errors += s.Errors
+			all.Skipped += s.Skipped
+		}
+		if err := writeXMLFile(junitFile, all); err != nil {
+			return err
+		}
+	}
+
+	if junitDir != "" {
+		if err := os.MkdirAll(junitDir, 0755); err != nil {
+			return err
+		}
+		for _, s := range suites {
+			path := filepath.Join(junitDir, "TEST-"+junitFileName(s.Name)+".xml")
+			if err := writeXMLFile(path, s); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// junitFileName turns a package path into a file name
+func junitFileName(pkg string) string {
+	name := strings.NewReplacer("/", "_", "\\", "_", ":", "_").Replace(strings.TrimPrefix(pkg, "./"))
+	if name == "" || name == "." {
+		return "root"
+	}
+	return name
+}
+
+// writeXMLFile writes v as an indented XML document
+func writeXMLFile(path string, v any) error {
+	data, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append([]byte(xml.Header), append(data, '\n')...), 0644)
+}
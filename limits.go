@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Resource limits of the test processes: memLimit and maxProcs become
+// GOMEMLIMIT and GOMAXPROCS (--memlimit, --maxprocs), dataLimit caps the
+// memory of every process on Linux (--rlimit-mem); zero leaves them alone
+var (
+	memLimit  int64
+	maxProcs  int
+	dataLimit int64
+)
+
+// byteUnits are the size suffixes parseByteSize accepts, as in GOMEMLIMIT,
+// plus their short forms
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"TiB", 1 << 40}, {"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10},
+	{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1},
+}
+
+// parseByteSize parses a size such as "512MiB", "2G" or "1048576"
+func parseByteSize(value string) (int64, error) {
+	number, unit := strings.TrimSpace(value), int64(1)
+	for _, u := range byteUnits {
+		if n, ok := strings.CutSuffix(number, u.suffix); ok {
+			number, unit = strings.TrimSpace(n), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 1 || n > (1<<62)/unit {
+		return 0, fmt.Errorf("invalid size %q (expected e.g. 512MiB or 2GiB)", value)
+	}
+	return n * unit, nil
+}
+
+// applyResourceLimits passes the limits on to the test processes, through
+// their environment and, for --rlimit-mem, gotest's own limits, which every
+// process it starts inherits
+func applyResourceLimits() error {
+	if memLimit > 0 {
+		testEnv["GOMEMLIMIT"] = strconv.FormatInt(memLimit, 10)
+	}
+	if maxProcs > 0 {
+		testEnv["GOMAXPROCS"] = strconv.Itoa(maxProcs)
+		// The -p and -parallel gotest chooses follow it
+		runtime.GOMAXPROCS(maxProcs)
+	}
+	if dataLimit > 0 {
+		if race || sanitizer != "" {
+			return fmt.Errorf("--rlimit-mem can't be combined with --race or sanitizers, which reserve large amounts of memory up front")
+		}
+		if err := setDataLimit(dataLimit); err != nil {
+			return fmt.Errorf("--rlimit-mem: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+package main
+
+import "syscall"
+
+// setDataLimit caps the data segment, which holds the Go heap, of gotest
+// and every process started after it. It applies to each process on its
+// own; an allocation beyond it fails, and the Go runtime exits with "out of
+// memory".
+func setDataLimit(limit int64) error {
+	return syscall.Setrlimit(syscall.RLIMIT_DATA, &syscall.Rlimit{Cur: uint64(limit), Max: uint64(limit)})
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "fmt"
+
+func setDataLimit(limit int64) error {
+	return fmt.Errorf("only supported on Linux")
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// runLint runs golangci-lint on the packages and prints its findings in a
+// dedicated section. A missing golangci-lint only produces a warning.
+func runLint(packages []string) error {
+	linter, err := exec.LookPath("golangci-lint")
+	if err != nil {
+		warnf("golangci-lint not found in PATH, skipping lint stage")
+		return nil
+	}
+
+	args := []string{"run"}
+	if buildTags != "" {
+		args = append(args, "--build-tags="+buildTags)
+	}
+	args = append(args, packages...)
+
+	if verbose {
+		fmt.Printf("Running: golangci-lint %s\n", strings.Join(args, " "))
+	}
+
+	var output bytes.Buffer
+	cmd := exec.Command(linter, args...)
+	cmd.Env = withEnv(os.Environ(), goEnv)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err = cmd.Run()
+
+	if err == nil {
+		fmt.Println("golangci-lint: no problems found")
+		return nil
+	}
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return fmt.Errorf("running golangci-lint: %w", err)
+	}
+
+	fmt.Println("\n--- LINT FINDINGS ---")
+	fmt.Println(strings.TrimRight(output.String(), "\n"))
+	fmt.Println("---------------------")
+	return withExitCode(exitTestsFailed, fmt.Errorf("golangci-lint reported problems"))
+}
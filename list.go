@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// listEntry is one test function in the output of "gotest list --json"
+type listEntry struct {
+	Package string `json:"package"`
+	Name    string `json:"name"`
+	Kind    string `json:"kind"`
+}
+
+// runList prints the test, benchmark, fuzz and example functions of all
+// discovered packages, or of the packages named on the command line, whose
+// names match the regular expression pattern
+func runList(args []string) error {
+	pattern := "."
+	var patterns []string
+	var asJSON, vscode, havePattern bool
+	for _, arg := range args {
+		switch {
+		case arg == "--json" || arg == "-json":
+			asJSON = true
+		case arg == "--vscode" || arg == "-vscode":
+			vscode = true
+		case strings.HasPrefix(arg, "-"):
+			return fmt.Errorf("unknown flag %s\nusage: gotest list [--json | --vscode] [pattern] [packages...]", arg)
+		case !havePattern:
+			pattern, havePattern = arg, true
+		default:
+			patterns = append(patterns, arg)
+		}
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern: %w", err)
+	}
+
+	if err := loadCompletionIgnoreRules(); err != nil {
+		return err
+	}
+	tests, err := listTests(context.Background())
+	if err != nil {
+		return fmt.Errorf("listing tests: %w", err)
+	}
+
+	entries := []listEntry{}
+	for _, t := range tests {
+		if !re.MatchString(t.name) || len(patterns) > 0 && !matchesAnyPattern(t.pkg, patterns) {
+			continue
+		}
+		entries = append(entries, listEntry{Package: t.pkg, Name: t.name, Kind: testKind(t.name)})
+	}
+
+	if vscode {
+		return printVSCodeItems(entries)
+	}
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	}
+	for i, e := range entries {
+		if i == 0 || entries[i-1].Package != e.Package {
+			fmt.Println(e.Package)
+		}
+		fmt.Printf("  %s\n", e.Name)
+	}
+	return nil
+}
+
+// testKind classifies a function listed by go test -list by its prefix
+func testKind(name string) string {
+	switch {
+	case strings.HasPrefix(name, "Benchmark"):
+		return "benchmark"
+	case strings.HasPrefix(name, "Fuzz"):
+		return "fuzz"
+	case strings.HasPrefix(name, "Example"):
+		return "example"
+	}
+	return "test"
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// logLevel is the minimum severity of the diagnostics gotest prints to
+// stderr; the test output and reports themselves are not affected
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+)
+
+// logThreshold is set with --log-level or --debug
+var logThreshold = levelInfo
+
+// parseLogLevel parses a --log-level value
+func parseLogLevel(value string) (logLevel, error) {
+	switch strings.ToLower(value) {
+	case "debug":
+		return levelDebug, nil
+	case "info":
+		return levelInfo, nil
+	case "warn", "warning":
+		return levelWarn, nil
+	}
+	return 0, fmt.Errorf("invalid log level %q (expected debug, info or warn)", value)
+}
+
+// debugf logs discovery decisions and subprocesses
+func debugf(format string, args ...any) {
+	logf(levelDebug, "debug: ", format, args...)
+}
+
+// infof logs what gotest is doing beyond the test output
+func infof(format string, args ...any) {
+	logf(levelInfo, "", format, args...)
+}
+
+// warnf logs problems that don't stop the run
+func warnf(format string, args ...any) {
+	logf(levelWarn, "Warning: ", format, args...)
+}
+
+func logf(level logLevel, prefix, format string, args ...any) {
+	if level >= logThreshold {
+		fmt.Fprintf(os.Stderr, prefix+format+"\n", args...)
+	}
+}
+
+// debugWriter returns stderr in debug mode, for the packages that log
+// through an io.Writer, and nil otherwise
+func debugWriter() io.Writer {
+	if logThreshold > levelDebug {
+		return nil
+	}
+	return os.Stderr
+}
@@ -1,24 +1,221 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
-	"runtime"
-	"sort"
 	"strconv"
 	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Hoofffman/gotest/pkg/coverprofile"
+	"github.com/Hoofffman/gotest/pkg/discover"
+	"github.com/Hoofffman/gotest/pkg/runner"
 )
 
 var (
-	verbose        bool
-	ignorePatterns []string
+	verbose          bool
+	ignorePatterns   []discover.Pattern
+	onlyPatterns     []discover.Pattern
+	ignoreRules      discover.IgnoreRules
+	jobs             int
+	shardIndex       int
+	shardCount       int
+	timingsFile      string
+	noCache          bool
+	buildTags        string
+	includeSubmods   bool
+	followSymlinks   bool
+	pkgPatterns      []string
+	packagesFile     string
+	chdir            string
+	roots            []string
+	configFile       string
+	profileName      string
+	envFlags         = make(map[string]string)
+	goEnvFlags       = make(map[string]string)
+	goFlags          string
+	vetFirst         bool
+	vetFailFast      bool
+	lint             bool
+	fmtCheck         bool
+	fmtFail          bool
+	fmtTool          string
+	compileOnly      bool
+	crossCheck       bool
+	platforms        []string
+	cgoMode          string
+	sanitizer        string
+	race             bool
+	raceCoverMode    string
+	coverMode        = "atomic"
+	coverModeSet     bool   // -covermode was given
+	userCoverProfile string // -coverprofile, replacing /tmp/cover.out
+	goVersion        string
+	noBrowser        bool
+	inDocker         bool
+	dockerImage      string
+	benchMode        bool
+	benchSave        string
+	benchCompare     string
+	benchThreshold   float64 // percent; 0 disables the regression gate
+	pprofKinds       []string
+	pprofDir         = "/tmp/gotest-pprof"
+	traceMode        bool
+	minCoverage      float64 // percent; 0 disables the check
+	maxDuration      time.Duration
+	failureLines     = 20 // lines shown per failing test in TEST ERRORS
+	fullFailures     bool
+	noHistory        bool
+	importPaths      bool
+	unifiedReport    bool
+	badgeDir         string
+	badgePerPackage  bool
+	hotCount         int
+	newSince         string
+	newPackageMin    float64
+	newPackageMinSet bool // --new-min-coverage was given
+	affectedRef      string
+	sinceRef         string
+	artifactsDir     string
+	junitFile        string
+	junitDir         string
+	templateFile     string
+	templateOut      string
 )
 
 func main() {
+	rawArgs := os.Args[1:]
+
+	// Subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "merge":
+			if err := runMerge(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(exitCode(err))
+			}
+			return
+		case "matrix":
+			if err := runMatrix(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(exitCode(err))
+			}
+			return
+		case "compare":
+			if err := runCompare(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(exitCode(err))
+			}
+			return
+		case "flaky":
+			if err := runFlaky(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(exitCode(err))
+			}
+			return
+		case "report":
+			if err := runReport(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(exitCode(err))
+			}
+			return
+		case "export":
+			if err := runExport(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(exitCode(err))
+			}
+			return
+		case "serve":
+			if err := runServe(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(exitCode(err))
+			}
+			return
+		case "history":
+			if err := runHistory(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(exitCode(err))
+			}
+			return
+		case "suite":
+			if err := runSuites(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(exitCode(err))
+			}
+			return
+		case "version", "--version":
+			if err := runVersion(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(exitCode(err))
+			}
+			return
+		case "completion":
+			if err := runCompletion(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(exitCode(err))
+			}
+			return
+		case "__complete":
+			runComplete(context.Background(), os.Args[2:])
+			return
+		case "__no-network":
+			os.Exit(runNoNetwork(os.Args[2:]))
+		case "__netns":
+			os.Exit(runNetns(os.Args[2:]))
+		case "self-update":
+			if err := runSelfUpdate(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(exitCode(err))
+			}
+			return
+		case "list":
+			if err := runList(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(exitCode(err))
+			}
+			return
+		case "gaps":
+			if err := runGaps(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(exitCode(err))
+			}
+			return
+		case "scaffold":
+			if err := runScaffold(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(exitCode(err))
+			}
+			return
+		case "config":
+			if err := runConfig(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(exitCode(err))
+			}
+			return
+		case "install-hook":
+			if err := runInstallHook(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(exitCode(err))
+			}
+			return
+		case "build":
+			compileOnly = true
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+		case "crosscheck":
+			crossCheck = true
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+		case "bench":
+			benchMode = true
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+		}
+	}
+
 	// Parse our own flags
 	args := parseFlags(os.Args[1:])
 
@@ -30,65 +227,652 @@ func main() {
 		}
 	}
 
-	if err := run(args); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+	if inDocker {
+		if err := runInDocker(rawArgs); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitCode(err))
+		}
+		return
+	}
+
+	// Ctrl+C cancels the run, stopping go test, instead of killing gotest
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// --max-duration bounds the whole run, from discovery to the reports
+	runCtx := ctx
+	if maxDuration > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, maxDuration)
+		defer cancel()
+	}
+
+	if onelineOutput {
+		startOneline()
+	}
+
+	err := run(runCtx, args)
+	if onelineOutput {
+		printOneline(err)
+	}
+	if err != nil {
+		code := exitCode(err)
+		switch {
+		case ctx.Err() != nil:
+			fmt.Fprintln(os.Stderr, "\nInterrupted")
+			code = exitInterrupted
+		case errors.Is(runCtx.Err(), context.DeadlineExceeded):
+			fmt.Fprintf(os.Stderr, "\nStopped: the run exceeded --max-duration %s\n", maxDuration)
+			code = exitTimeout
+		case !onelineOutput: // the result line and exit code say it failed
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		closeIDEProtocol(code, err)
+		os.Exit(code)
 	}
+	closeIDEProtocol(exitOK, nil)
 }
 
 // parseFlags extracts gotest-specific flags and returns remaining args for go test
 func parseFlags(args []string) []string {
 	var goTestArgs []string
+	var verbatimArgs []string // after --
 	for i := 0; i < len(args); i++ {
 		arg := args[i]
 		switch {
 		case arg == "-d" || arg == "--detail" || arg == "-detail":
 			verbose = true
-		case arg == "-i" || arg == "--ignore" || arg == "-ignore":
-			// Next arg should be the patterns
-			if i+1 < len(args) {
-				i++
-				patterns := strings.Split(args[i], ",")
-				for _, p := range patterns {
-					p = strings.TrimSpace(p)
-					if p != "" {
-						ignorePatterns = append(ignorePatterns, p)
+		case isFlag(arg, "-i", "--ignore", "-ignore"):
+			if value, ok := flagValue(args, &i, "-i", "--ignore", "-ignore"); ok {
+				for _, p := range splitList(value) {
+					pattern, err := discover.ParsePattern(p)
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+						os.Exit(exitToolError)
 					}
+					ignorePatterns = append(ignorePatterns, pattern)
+				}
+			}
+		case isFlag(arg, "--only", "-only"):
+			if value, ok := flagValue(args, &i, "--only", "-only"); ok {
+				for _, p := range splitList(value) {
+					pattern, err := discover.ParsePattern(p)
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+						os.Exit(exitToolError)
+					}
+					onlyPatterns = append(onlyPatterns, pattern)
+				}
+			}
+		case isFlag(arg, "--packages", "-packages"):
+			if value, ok := flagValue(args, &i, "--packages", "-packages"); ok {
+				packagesFile = value
+			}
+		case isFlag(arg, "-C", "--chdir", "-chdir"):
+			if value, ok := flagValue(args, &i, "-C", "--chdir", "-chdir"); ok {
+				chdir = value
+			}
+		case isFlag(arg, "--root", "-root"):
+			if value, ok := flagValue(args, &i, "--root", "-root"); ok {
+				roots = append(roots, splitList(value)...)
+			}
+		case isFlag(arg, "--config", "-config"):
+			if value, ok := flagValue(args, &i, "--config", "-config"); ok {
+				configFile = value
+			}
+		case isFlag(arg, "--profile", "-profile"):
+			if value, ok := flagValue(args, &i, "--profile", "-profile"); ok {
+				profileName = value
+			}
+		case isFlag(arg, "--env", "-env"):
+			if value, ok := flagValue(args, &i, "--env", "-env"); ok {
+				key, val, err := parseEnvAssignment(value)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(exitToolError)
+				}
+				envFlags[key] = val
+			}
+		case isFlag(arg, "--goenv", "-goenv"):
+			if value, ok := flagValue(args, &i, "--goenv", "-goenv"); ok {
+				key, val, err := parseEnvAssignment(value)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(exitToolError)
+				}
+				goEnvFlags[key] = val
+			}
+		case isFlag(arg, "--goflags", "-goflags"):
+			if value, ok := flagValue(args, &i, "--goflags", "-goflags"); ok {
+				goFlags = value
+			}
+		case arg == "--vet-first" || arg == "-vet-first":
+			vetFirst = true
+		case arg == "--vet-fail-fast" || arg == "-vet-fail-fast":
+			vetFirst = true
+			vetFailFast = true
+		case arg == "--lint" || arg == "-lint":
+			lint = true
+		case arg == "--generate" || arg == "-generate":
+			generate = true
+		case arg == "--fmt-check" || arg == "-fmt-check":
+			fmtCheck = true
+		case arg == "--fmt-fail" || arg == "-fmt-fail":
+			fmtCheck = true
+			fmtFail = true
+		case isFlag(arg, "--fmt-tool", "-fmt-tool"):
+			if value, ok := flagValue(args, &i, "--fmt-tool", "-fmt-tool"); ok {
+				fmtTool = value
+			}
+		case arg == "--compile-only" || arg == "-compile-only":
+			compileOnly = true
+		case isFlag(arg, "--platforms", "-platforms"):
+			if value, ok := flagValue(args, &i, "--platforms", "-platforms"); ok {
+				platforms = append(platforms, splitList(value)...)
+			}
+		case isFlag(arg, "--cgo", "-cgo"):
+			if value, ok := flagValue(args, &i, "--cgo", "-cgo"); ok {
+				switch strings.ToLower(value) {
+				case "on", "1", "true":
+					cgoMode = "1"
+				case "off", "0", "false":
+					cgoMode = "0"
+				default:
+					fmt.Fprintf(os.Stderr, "Error: invalid --cgo value %q (expected on or off)\n", value)
+					os.Exit(exitToolError)
+				}
+				goEnvFlags["CGO_ENABLED"] = cgoMode
+			}
+		case arg == "--msan" || arg == "-msan":
+			sanitizer = "msan"
+		case arg == "--asan" || arg == "-asan":
+			sanitizer = "asan"
+		case arg == "--race" || arg == "-race":
+			race = true
+		case isFlag(arg, "--race-covermode", "-race-covermode"):
+			if value, ok := flagValue(args, &i, "--race-covermode", "-race-covermode"); ok {
+				if value != "set" && value != "atomic" {
+					fmt.Fprintf(os.Stderr, "Error: invalid --race-covermode value %q (expected set or atomic)\n", value)
+					os.Exit(exitToolError)
 				}
+				raceCoverMode = value
+			}
+		case isFlag(arg, "--go", "-go"):
+			if value, ok := flagValue(args, &i, "--go", "-go"); ok {
+				goVersion = value
+			}
+		case isFlag(arg, "--in-docker", "-in-docker"):
+			// The image is optional, so it can only be given with "="
+			inDocker = true
+			if _, value, ok := strings.Cut(arg, "="); ok {
+				dockerImage = value
+			}
+		case isFlag(arg, "--pprof", "-pprof"):
+			if value, ok := flagValue(args, &i, "--pprof", "-pprof"); ok {
+				kinds, err := parsePprofKinds(value)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(exitToolError)
+				}
+				pprofKinds = kinds
+			}
+		case isFlag(arg, "--pprof-dir", "-pprof-dir"):
+			if value, ok := flagValue(args, &i, "--pprof-dir", "-pprof-dir"); ok {
+				pprofDir = value
+			}
+		case isFlag(arg, "--save", "-save"):
+			if value, ok := flagValue(args, &i, "--save", "-save"); ok {
+				benchSave = value
+			}
+		case isFlag(arg, "--compare", "-compare"):
+			if value, ok := flagValue(args, &i, "--compare", "-compare"); ok {
+				benchCompare = value
+			}
+		case isFlag(arg, "--bench-threshold", "-bench-threshold"):
+			if value, ok := flagValue(args, &i, "--bench-threshold", "-bench-threshold"); ok {
+				n, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+				if err != nil || n <= 0 {
+					fmt.Fprintf(os.Stderr, "Error: invalid --bench-threshold value %q (expected a percentage like 5%%)\n", value)
+					os.Exit(exitToolError)
+				}
+				benchThreshold = n
+			}
+		case isFlag(arg, "--min-coverage", "-min-coverage"):
+			if value, ok := flagValue(args, &i, "--min-coverage", "-min-coverage"); ok {
+				n, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+				if err != nil || n < 0 || n > 100 {
+					fmt.Fprintf(os.Stderr, "Error: invalid --min-coverage value %q (expected a percentage like 80%%)\n", value)
+					os.Exit(exitToolError)
+				}
+				minCoverage = n
+			}
+		case isFlag(arg, "--max-duration", "-max-duration"):
+			if value, ok := flagValue(args, &i, "--max-duration", "-max-duration"); ok {
+				d, err := time.ParseDuration(value)
+				if err != nil || d <= 0 {
+					fmt.Fprintf(os.Stderr, "Error: invalid --max-duration value %q (expected a duration like 15m)\n", value)
+					os.Exit(exitToolError)
+				}
+				maxDuration = d
+			}
+		case isFlag(arg, "--affected", "-affected"):
+			if value, ok := flagValue(args, &i, "--affected", "-affected"); ok {
+				affectedRef = value
+			}
+		case isFlag(arg, "--since", "-since"):
+			if value, ok := flagValue(args, &i, "--since", "-since"); ok {
+				sinceRef = value
+			}
+		case arg == "--trace":
+			// Single-dash -trace <file> remains go test's own flag
+			traceMode = true
+		case arg == "--full-failures" || arg == "-full-failures":
+			fullFailures = true
+		case isFlag(arg, "--failure-lines", "-failure-lines"):
+			if value, ok := flagValue(args, &i, "--failure-lines", "-failure-lines"); ok {
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 1 {
+					fmt.Fprintf(os.Stderr, "Error: invalid --failure-lines value %q\n", value)
+					os.Exit(exitToolError)
+				}
+				failureLines = n
+			}
+		case isFlag(arg, "--badge", "-badge"):
+			if value, ok := flagValue(args, &i, "--badge", "-badge"); ok {
+				badgeDir = value
+			}
+		case arg == "--badge-per-package" || arg == "-badge-per-package":
+			badgePerPackage = true
+		case isFlag(arg, "--coverdir", "-coverdir"):
+			if value, ok := flagValue(args, &i, "--coverdir", "-coverdir"); ok {
+				coverDirs = append(coverDirs, splitList(value)...)
+			}
+		case arg == "--by-func" || arg == "-by-func":
+			byFunc = true
+		case arg == "--deadcode" || arg == "-deadcode":
+			deadCode = true
+		case isFlag(arg, "--memlimit", "-memlimit"):
+			if value, ok := flagValue(args, &i, "--memlimit", "-memlimit"); ok {
+				n, err := parseByteSize(value)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: --memlimit: %v\n", err)
+					os.Exit(exitToolError)
+				}
+				memLimit = n
+			}
+		case isFlag(arg, "--maxprocs", "-maxprocs"):
+			if value, ok := flagValue(args, &i, "--maxprocs", "-maxprocs"); ok {
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 1 {
+					fmt.Fprintf(os.Stderr, "Error: invalid --maxprocs value %q\n", value)
+					os.Exit(exitToolError)
+				}
+				maxProcs = n
+			}
+		case isFlag(arg, "--rlimit-mem", "-rlimit-mem"):
+			if value, ok := flagValue(args, &i, "--rlimit-mem", "-rlimit-mem"); ok {
+				n, err := parseByteSize(value)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: --rlimit-mem: %v\n", err)
+					os.Exit(exitToolError)
+				}
+				dataLimit = n
+			}
+		case arg == "--no-network" || arg == "-no-network":
+			noNetwork = true
+		case isFlag(arg, "--default-timeout", "-default-timeout"):
+			if value, ok := flagValue(args, &i, "--default-timeout", "-default-timeout"); ok {
+				d, err := time.ParseDuration(value)
+				if err != nil || d < 0 {
+					fmt.Fprintf(os.Stderr, "Error: invalid --default-timeout value %q\n", value)
+					os.Exit(exitToolError)
+				}
+				defaultTimeout = d
+			}
+		case isFlag(arg, "--max-failures", "-max-failures"):
+			if value, ok := flagValue(args, &i, "--max-failures", "-max-failures"); ok {
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 1 {
+					fmt.Fprintf(os.Stderr, "Error: invalid --max-failures value %q\n", value)
+					os.Exit(exitToolError)
+				}
+				maxFailures = n
+			}
+		case isFlag(arg, "--hot", "-hot"):
+			if value, ok := flagValue(args, &i, "--hot", "-hot"); ok {
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 1 {
+					fmt.Fprintf(os.Stderr, "Error: invalid --hot value %q\n", value)
+					os.Exit(exitToolError)
+				}
+				hotCount = n
+			}
+		case isFlag(arg, "--new-since", "-new-since"):
+			if value, ok := flagValue(args, &i, "--new-since", "-new-since"); ok {
+				newSince = value
+			}
+		case isFlag(arg, "--new-min-coverage", "-new-min-coverage"):
+			if value, ok := flagValue(args, &i, "--new-min-coverage", "-new-min-coverage"); ok {
+				n, err := parsePercent(value)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: invalid --new-min-coverage value %q (expected a percentage like 80%%)\n", value)
+					os.Exit(exitToolError)
+				}
+				newPackageMin, newPackageMinSet = n, true
+			}
+		case arg == "--unified" || arg == "-unified":
+			unifiedReport = true
+		case isFlag(arg, "--log-level", "-log-level"):
+			if value, ok := flagValue(args, &i, "--log-level", "-log-level"); ok {
+				level, err := parseLogLevel(value)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(exitToolError)
+				}
+				logThreshold = level
+			}
+		case arg == "--debug" || arg == "-debug":
+			logThreshold = levelDebug
+		case arg == "--import-paths" || arg == "-import-paths":
+			importPaths = true
+		case isFlag(arg, "--template", "-template"):
+			if value, ok := flagValue(args, &i, "--template", "-template"); ok {
+				templateFile = value
+			}
+		case isFlag(arg, "--template-out", "-template-out"):
+			if value, ok := flagValue(args, &i, "--template-out", "-template-out"); ok {
+				templateOut = value
+			}
+		case isFlag(arg, "--junit", "-junit"):
+			if value, ok := flagValue(args, &i, "--junit", "-junit"); ok {
+				junitFile = value
+			}
+		case isFlag(arg, "--junit-dir", "-junit-dir"):
+			if value, ok := flagValue(args, &i, "--junit-dir", "-junit-dir"); ok {
+				junitDir = value
+			}
+		case isFlag(arg, "--artifacts", "-artifacts"):
+			if value, ok := flagValue(args, &i, "--artifacts", "-artifacts"); ok {
+				artifactsDir = value
+			}
+		case arg == "--fail-first-order" || arg == "-fail-first-order":
+			failFirstOrder = true
+		case arg == "--no-history" || arg == "-no-history":
+			noHistory = true
+		case arg == "--oneline" || arg == "-oneline":
+			onelineOutput = true
+			noBrowser = true
+		case arg == "--copy" || arg == "-copy":
+			copySummary = true
+		case arg == "--no-browser" || arg == "-no-browser":
+			noBrowser = true
+		case isFlag(arg, "--ide-protocol", "-ide-protocol"):
+			if value, ok := flagValue(args, &i, "--ide-protocol", "-ide-protocol"); ok {
+				ideProtocol = value
 			}
-		case strings.HasPrefix(arg, "-i=") || strings.HasPrefix(arg, "--ignore=") || strings.HasPrefix(arg, "-ignore="):
-			// Handle -i=pattern,pattern format
-			var value string
-			if strings.HasPrefix(arg, "-i=") {
-				value = arg[3:]
-			} else if strings.HasPrefix(arg, "--ignore=") {
-				value = arg[9:]
-			} else {
-				value = arg[8:]
-			}
-			patterns := strings.Split(value, ",")
-			for _, p := range patterns {
-				p = strings.TrimSpace(p)
-				if p != "" {
-					ignorePatterns = append(ignorePatterns, p)
+		case arg == "--icons" || arg == "-icons":
+			iconOutput = true
+		case arg == "--plain" || arg == "-plain":
+			plainOutput = true
+		case isFlag(arg, "-j", "--jobs", "-jobs"):
+			if value, ok := flagValue(args, &i, "-j", "--jobs", "-jobs"); ok {
+				n, err := parseJobs(value)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(exitToolError)
 				}
+				jobs = n
 			}
+		case isFlag(arg, "--shard", "-shard"):
+			if value, ok := flagValue(args, &i, "--shard", "-shard"); ok {
+				index, count, err := parseShard(value)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(exitToolError)
+				}
+				shardIndex, shardCount = index, count
+			}
+		case arg == "--no-cache" || arg == "-no-cache":
+			noCache = true
+		case isFlag(arg, "--tags", "-tags"):
+			if value, ok := flagValue(args, &i, "--tags", "-tags"); ok {
+				buildTags = strings.Join(splitList(value), ",")
+			}
+		case arg == "--include-submodules" || arg == "-include-submodules":
+			includeSubmods = true
+		case arg == "--follow-symlinks" || arg == "-follow-symlinks":
+			followSymlinks = true
+		case isFlag(arg, "--timings", "-timings"):
+			if value, ok := flagValue(args, &i, "--timings", "-timings"); ok {
+				timingsFile = value
+			}
+		case arg == "-args" || arg == "--args":
+			// Everything after -args goes to the test binary untouched
+			goTestArgs = append(goTestArgs, args[i:]...)
+			i = len(args)
+		case arg == "--":
+			// Everything after -- goes to go test untouched, even flags
+			// gotest knows itself or rejects
+			verbatimArgs = args[i+1:]
+			i = len(args)
+		case !strings.HasPrefix(arg, "-"):
+			pkgPatterns = append(pkgPatterns, arg)
 		default:
 			goTestArgs = append(goTestArgs, arg)
+			// Keep the value of go test flags like "-run TestFoo" with its flag
+			if takesValue(arg) && i+1 < len(args) {
+				i++
+				goTestArgs = append(goTestArgs, args[i])
+			}
+		}
+	}
+	goTestArgs, err := extractCoverFlags(goTestArgs)
+	if err == nil {
+		err = checkGoTestFlags(goTestArgs)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitToolError)
+	}
+	goTestArgs = append(goTestArgs, verbatimArgs...)
+
+	// Flags added by gotest must come before -args
+	var binaryArgs []string
+	for i, arg := range goTestArgs {
+		if arg == "-args" || arg == "--args" {
+			goTestArgs, binaryArgs = goTestArgs[:i:i], goTestArgs[i:]
+			break
+		}
+	}
+	if noCache {
+		goTestArgs = append(goTestArgs, "-count=1")
+	}
+	if junitFile != "" || junitDir != "" || ideProtocol != "" || onelineOutput {
+		// go test only reports passed and skipped tests with -v
+		if _, ok := goTestFlag(goTestArgs, "v"); !ok {
+			goTestArgs = append(goTestArgs, "-v")
 		}
 	}
-	return goTestArgs
+	goTestArgs = withDefaultTimeout(goTestArgs)
+	if buildTags != "" {
+		goTestArgs = append(goTestArgs, "-tags="+buildTags)
+	}
+	if sanitizer != "" {
+		goTestArgs = append(goTestArgs, "-"+sanitizer)
+	}
+	if race {
+		goTestArgs = append(scaleTimeout(goTestArgs, raceTimeoutFactor), "-race")
+		if raceCoverMode != "" && !coverModeSet {
+			coverMode = raceCoverMode
+		}
+	}
+	return append(goTestArgs, binaryArgs...)
 }
 
-func printUsage() {
-	fmt.Println(`gotest - Run go test recursively with coverage
+// isFlag reports whether arg is one of names, either bare or in "name=value" form
+func isFlag(arg string, names ...string) bool {
+	for _, name := range names {
+		if arg == name || strings.HasPrefix(arg, name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// flagValue returns the value of a flag given either as "name value" or
+// "name=value". When the value is a separate argument, i is advanced past it;
+// a missing value is an error.
+func flagValue(args []string, i *int, names ...string) (string, bool) {
+	arg := args[*i]
+	for _, name := range names {
+		if arg == name {
+			if *i+1 < len(args) {
+				*i++
+				return args[*i], true
+			}
+			fmt.Fprintf(os.Stderr, "Error: flag %s needs a value\n", name)
+			os.Exit(exitToolError)
+		}
+		if strings.HasPrefix(arg, name+"=") {
+			return arg[len(name)+1:], true
+		}
+	}
+	return "", false
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, p := range strings.Split(value, ",") {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			items = append(items, p)
+		}
+	}
+	return items
+}
+
+// usage is the help text; shell completion takes gotest's flags from its
+// Options section
+const usage = `gotest - Run go test recursively with coverage
 
 Usage:
-  gotest [options] [go test flags...]
+  gotest [options] [go test flags...] [packages...] [-- go test flags...]
+  gotest build [options] [packages...]
+  gotest bench [--save file] [--compare baseline] [options] [go test flags...] [packages...]
+  gotest crosscheck [--platforms os/arch,...] [options] [packages...]
+  gotest matrix --go <versions> [options] [go test flags...]
+  gotest suite <names...>|--all [options] [go test flags...]
+  gotest merge [-o output] <profiles...>
+  gotest export --gcov [-o dir] [profile]
+  gotest compare [--markdown] [<run-id> <run-id>]
+  gotest flaky [--trend] [--window n]
+  gotest report --history [-o file] [--no-browser]
+  gotest report --diff [--base-ref rev] [-o file] [--no-browser] <base-profile> <head-profile>
+  gotest history prune [--keep <age>] [--keep-runs <n>] [options]
+  gotest serve [--addr host:port]
+  gotest list [--json | --vscode] [pattern] [packages...]
+  gotest gaps [--json] [packages...]
+  gotest scaffold [-w] <package> [profile]
+  gotest config show [options] | gotest config init [--force]
+  gotest install-hook [pre-push|pre-commit] [--force] [options]
+  gotest version
+  gotest self-update [--check] [--force]
+  gotest completion bash|zsh|fish|powershell
 
 Options:
+  -C, --chdir <dir>         Change to dir before doing anything else
+      --root <dirs>         Test several Go trees in one run (repeatable, comma-separated)
+      --config <file>       Read settings from file (default: .gotest.yaml if present)
+      --profile <name>      Apply a profile from the config file
+      --env <KEY=VALUE>     Set an environment variable for the tests (repeatable)
+      --goenv <KEY=VALUE>   Set a toolchain variable for all go commands (repeatable)
+      --goflags <flags>     Set GOFLAGS for all go commands
+      --go <version>        Run with a specific Go toolchain, e.g. 1.22.4
+      --cgo <on|off>        Set CGO_ENABLED; with off, packages needing cgo are reported
+      --race                Test with the race detector (longer timeout, races summarized)
+      --race-covermode <m>  Coverage mode under --race: atomic (default) or set (faster)
+  -coverprofile <file>      Write the coverage profile to file instead of /tmp/cover.out;
+                            the HTML report is written next to it
+  -covermode <mode>         Coverage mode: set, count or atomic (default: atomic)
+      --msan                Test with the memory sanitizer (sets CC=clang)
+      --asan                Test with the address sanitizer
   -d, --detail              Show detailed test output (default: minimal output)
-  -i, --ignore <patterns>   Ignore packages matching patterns (comma-separated)
+      --failure-lines <n>   Lines shown per failing test in minimal output (default: 20)
+      --full-failures       Show failing tests' output in full in minimal output
+  -i, --ignore <patterns>   Ignore packages matching patterns (comma-separated;
+                            substring, glob, or re:<regexp>)
+      --only <patterns>     Only test packages matching patterns (same syntax as -i)
+      --packages <file>     Read packages to test from a file, or stdin with "-"
+  -j, --jobs <n|auto>       Run packages in n parallel 'go test' invocations (auto: one
+                            per CPU), sharing the CPUs through -p and -parallel
+      --shard <i/n>         Only test shard i of n (for CI matrices)
+      --vet-first           Run go vet on the packages before testing
+      --vet-fail-fast       Like --vet-first, but stop if go vet reports problems
+      --lint                Also run golangci-lint (if installed); problems fail the run
+      --generate            Run go generate first; fail if it changes tracked files
+      --fmt-check           Report files that are not gofmt-formatted
+      --fmt-fail            Like --fmt-check, but unformatted files fail the run
+      --fmt-tool <tool>     Formatter for the format check: gofmt or gofumpt
+      --compile-only        Only check that packages and tests compile (same as 'gotest build')
+      --platforms <list>    GOOS/GOARCH pairs for crosscheck (comma-separated)
+      --save <file>         Where 'gotest bench' saves results (default: /tmp/bench.txt)
+      --compare <file>      Compare 'gotest bench' results with a saved baseline
+      --bench-threshold <n%>
+                            Fail 'gotest bench' if a benchmark regresses by more than n%
+                            versus the baseline (--compare, or else the --save file)
+      --pprof <kinds>       Collect per-package profiles: cpu, mem, block, mutex
+                            (comma-separated) and offer to open the largest in pprof;
+                            not --profile, which selects a config profile
+      --pprof-dir <dir>     Where --pprof and --trace write files (default: /tmp/gotest-pprof)
+      --trace               Record a per-package execution trace and open go tool trace
+      --min-coverage <n%>   Fail if total coverage is below n% (exit code 3)
+      --new-since <date|ref>
+                            Require coverage from packages added after a date
+                            (YYYY-MM-DD) or git ref; older packages are exempt
+      --new-min-coverage <n%>
+                            Coverage required by --new-since (default: 80%)
+      --memlimit <size>     Run tests with GOMEMLIMIT set, e.g. 512MiB
+      --maxprocs <n>        Run tests with GOMAXPROCS=n, also for the -p and -parallel gotest picks
+      --rlimit-mem <size>   Cap the memory of every test process (Linux, not with --race)
+      --no-network          Run the test binaries without network access (Linux;
+                            elsewhere only HTTP through proxy variables is blocked)
+      --default-timeout <d> go test -timeout when none is given (default: 2m, 0 for go test's 10m)
+      --max-failures <n>    Stop the run after n failing tests or packages that don't build
+      --max-duration <d>    Stop the whole run after d, e.g. 15m (exit code 5)
+      --affected <ref>      Only test packages affected by changes since a git ref
+      --since <ref>         Only test packages changed since a git ref and their dependents
+      --timings <file>      Record package durations and balance shards by them
+      --no-cache            Bypass the go test cache (adds -count=1)
+      --tags <tags>         Build tags for discovery and go test (comma-separated)
+      --include-submodules  Also test nested modules, each in its own invocation
+      --follow-symlinks     Follow symlinked directories during discovery
+      --no-browser          Generate the HTML report without opening it
+      --oneline             Print only one result line, e.g. for log scrapers and prompts
+      --copy                Copy a Markdown summary of the run to the clipboard
+      --ide-protocol <fd:n|unix:path>
+                            Stream progress events as JSON lines to a file descriptor or Unix socket
+      --icons               List every package with a status icon (✔ ✖ ⊘) after the tests
+      --plain               Pure ASCII output: no colors, icons or non-ASCII test output
+      --import-paths        Show packages by import path instead of relative path
+      --coverdir <dirs>     Add the coverage of binaries built with -cover (GOCOVERDIR directories)
+      --by-func             List the coverage of every function
+      --deadcode            List unreachable functions with their coverage (needs deadcode)
+      --hot <n>             List the n most executed statements and functions
+      --badge <dir>         Write a coverage badge (coverage.svg) to dir
+      --badge-per-package   With --badge, also write one badge per package
+      --unified             Write one HTML report of test results and coverage (/tmp/report.html)
+      --fail-first-order    Test the packages that failed most recently first
+      --no-history          Neither record this run nor show coverage changes
+      --template <file>     Render the run summary with a Go text/template file
+      --template-out <file> Write the --template output to file instead of stdout
+      --junit <file>        Write the test results as one JUnit XML file (adds -v)
+      --junit-dir <dir>     Write one JUnit XML file per package to dir (adds -v)
+      --artifacts <dir>     Keep the profile, reports, test output and summary of
+                            each run in dir/<run-id>
+      --in-docker[=image]   Run inside a golang container (default: host Go version)
+      --log-level <level>   Diagnostics to print: debug, info or warn (default: info)
+      --debug               Log discovery decisions and subprocesses (--log-level debug)
   -h, --help                Show this help message
 
 Description:
@@ -104,115 +888,487 @@ Examples:
   gotest -i example,pb                Ignore packages containing "example" or "pb"
   gotest --ignore=cmd,testdata        Same as above with = syntax
   gotest -i generated -v              Ignore + verbose go test output
+  gotest -i '**/mocks/**'             Ignore packages matching a glob
+  gotest -i 're:_gen$'                Ignore packages matching a regular expression
   gotest -run TestFoo                 Run specific tests
+  gotest ./internal/... ./cmd/api     Only test packages under these paths
+  git diff --name-only main | gotest --packages -
+                                      Test the packages of changed files
+  gotest --only auth,billing          Only test packages containing "auth" or "billing"
+  gotest -C ../service                Run as if started in ../service
+  gotest --root api,worker,tools      Test three trees with a combined report
+  gotest --env DATABASE_URL=postgres://localhost/test
+                                      Run tests with an extra environment variable
+  gotest --goenv CGO_ENABLED=0 --goflags=-mod=mod
+                                      Control the go toolchain environment
+  gotest --profile integration        Use the "integration" profile from .gotest.yaml
+  gotest -j 8                         Test packages in 8 parallel workers
+  gotest --shard 2/5                  Test the second of five package shards
+  gotest build                        Check that everything compiles, without running tests
+  gotest bench --save main.txt        Run all benchmarks and save them as a baseline
+  gotest bench -count 6 --compare main.txt
+                                      Compare benchmarks with the saved baseline
+  gotest bench -count 6 --compare main.txt --bench-threshold 5%
+                                      Fail on benchmark regressions over 5%
+  gotest crosscheck --platforms linux/amd64,windows/amd64
+                                      Compile-check packages and tests for each platform
+  gotest matrix --go 1.21,1.22,1.23   Compare results across Go versions
+  gotest merge /tmp/cover-shard-*.out Merge shard profiles into /tmp/cover.out
+  gotest compare 20240501 20240502    Compare two recorded runs (IDs or unique prefixes)
+  gotest flaky --trend                Show whether tests got more or less flaky week by week
+  gotest report --history             Chart coverage, failures and durations of past runs
+  gotest report --diff --base-ref main base.out cover.out
+                                      Show main's and this branch's coverage side by side
+  gotest serve --addr :8080           Serve the run history as JSON and the dashboard
+  gotest history prune --keep 90d     Drop runs older than 90 days and their artifacts
+  gotest install-hook pre-commit      Test changed packages before every commit
+  gotest version                      Show the gotest build and the go toolchain it uses
+  gotest list --json Auth ./auth/...  List matching tests as JSON
+  gotest gaps ./internal/...          Rank untested packages and files by size
+  gotest scaffold -w ./internal/auth  Add test skeletons for its uncovered functions
+  gotest self-update                  Replace gotest with the latest GitHub release
+  source <(gotest completion bash)    Enable tab completion in bash
 
 Output:
   Coverage profile: /tmp/cover.out
   HTML report:      /tmp/cover.html
+  Unified report:   /tmp/report.html (--unified)
+
+Exit codes:
+  0    Success
+  1    Tests failed, or a vet, lint, format or benchmark check failed
+  2    Build error: packages or tests don't compile
+  3    Coverage below --min-coverage or --new-min-coverage
+  4    gotest error: invalid flags or config, missing tools, I/O errors
+  5    The run exceeded --max-duration
+  130  Interrupted
+
+All other flags are passed directly to 'go test'. See 'go help test' for details.
+Flags gotest can't work with (-coverpkg, -o, -c, -json, -list) are rejected
+with an error.
+Arguments after -- are passed to 'go test' as they are, even flags gotest
+knows itself or rejects; give packages before --.`
 
-All other flags are passed directly to 'go test'. See 'go help test' for details.`)
+func printUsage() {
+	fmt.Println(usage)
 }
 
-func run(userArgs []string) error {
-	// Find all directories containing .go files
-	packages, err := findGoPackages(".")
+func run(ctx context.Context, userArgs []string) error {
+	started := time.Now()
+
+	if chdir != "" {
+		if err := os.Chdir(chdir); err != nil {
+			return fmt.Errorf("changing directory: %w", err)
+		}
+	}
+
+	if err := applyConfig(); err != nil {
+		return err
+	}
+
+	if err := applyResourceLimits(); err != nil {
+		return withExitCode(exitToolError, err)
+	}
+	if noNetwork && !compileOnly {
+		flag, err := noNetworkExec(userArgs)
+		if err != nil {
+			return withExitCode(exitToolError, err)
+		}
+		userArgs = insertGoTestFlags(userArgs, flag)
+	}
+
+	if ideProtocol != "" {
+		if err := openIDEProtocol(ideProtocol); err != nil {
+			return withExitCode(exitToolError, err)
+		}
+	}
+
+	if goVersion != "" {
+		if err := selectGoVersion(goVersion); err != nil {
+			return err
+		}
+	}
+
+	if sanitizer != "" {
+		if err := setupSanitizer(sanitizer); err != nil {
+			return err
+		}
+	}
+
+	var reportTmpl *template.Template
+	if templateFile != "" {
+		var err error
+		if reportTmpl, err = loadReportTemplate(templateFile); err != nil {
+			return withExitCode(exitToolError, fmt.Errorf("%s: %w", templateFile, err))
+		}
+	}
+
+	rules, err := discover.LoadIgnoreFile(discover.IgnoreFileName)
 	if err != nil {
-		return fmt.Errorf("finding go packages: %w", err)
+		return fmt.Errorf("reading %s: %w", discover.IgnoreFileName, err)
 	}
+	ignoreRules = rules
 
-	if len(packages) == 0 {
+	// Find all directories containing .go files. With explicit roots, each
+	// root is tested on its own like a nested module.
+	var packages []string
+	if len(roots) == 0 {
+		packages, err = findGoPackages(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("finding go packages: %w", err)
+		}
+	}
+
+	if packagesFile != "" {
+		list, err := readPackageList(packagesFile)
+		if err != nil {
+			return fmt.Errorf("reading package list: %w", err)
+		}
+		if len(list) == 0 {
+			fmt.Println("No packages given")
+			return nil
+		}
+		pkgPatterns = append(pkgPatterns, list...)
+	}
+
+	// Restrict to the packages requested on the command line
+	packages = filterPatterns(packages, "")
+	debugf("%d package(s) selected", len(packages))
+
+	// Nested modules are skipped by discovery; optionally test them separately
+	var modules []string
+	if includeSubmods && len(roots) == 0 {
+		modules, err = findSubmodules(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("finding submodules: %w", err)
+		}
+	}
+	for _, root := range roots {
+		modules = append(modules, rootPath(root))
+	}
+
+	if len(packages) == 0 && len(modules) == 0 {
 		fmt.Println("No Go packages found")
 		return nil
 	}
 
+	// Coverage output file
+	coverProfile := "/tmp/cover.out"
+	coverHTML := "/tmp/cover.html"
+
+	// Coverage is still measured across all discovered packages so that
+	// shard profiles can be merged into an accurate total
+	coverPkgs := packages
+
+	if affectedRef != "" && sinceRef != "" {
+		return fmt.Errorf("--affected and --since cannot be combined")
+	}
+	if ref := affectedRef + sinceRef; ref != "" {
+		changed, err := changedFiles(ref)
+		if err != nil {
+			return fmt.Errorf("finding changed files: %w", err)
+		}
+		if affectedRef != "" {
+			packages, err = affectedPackages(packages, changed)
+		} else {
+			packages, err = changedPackages(packages, changed)
+		}
+		if err != nil {
+			return fmt.Errorf("finding affected packages: %w", err)
+		}
+		modules = affectedModules(modules, changed)
+		if len(packages) == 0 && len(modules) == 0 {
+			fmt.Printf("No packages affected by changes since %s\n", ref)
+			return nil
+		}
+		fmt.Printf("Affected by changes since %s: %d of %d package(s)\n", ref, len(packages), len(coverPkgs))
+	}
+
+	if shardCount > 0 {
+		selected := packages
+		var timings map[string]float64
+		if timingsFile != "" {
+			timings, err = loadTimings(timingsFile)
+			if err != nil {
+				warnf("could not read timings: %v", err)
+			}
+		}
+		if len(timings) > 0 {
+			packages = balancedShard(selected, timings, shardIndex, shardCount)
+		} else {
+			packages = shardPackages(selected, shardIndex, shardCount)
+		}
+		// Submodules are assigned to shards as whole units
+		modules = shardPackages(modules, shardIndex, shardCount)
+		coverProfile = fmt.Sprintf("/tmp/cover-shard-%d-of-%d.out", shardIndex, shardCount)
+		coverHTML = fmt.Sprintf("/tmp/cover-shard-%d-of-%d.html", shardIndex, shardCount)
+		if len(packages) == 0 && len(modules) == 0 {
+			fmt.Printf("No packages in shard %d/%d\n", shardIndex, shardCount)
+			return nil
+		}
+		fmt.Printf("Shard %d/%d: %d of %d package(s)\n", shardIndex, shardCount, len(packages), len(selected))
+	}
+
+	// A -coverprofile given by the user replaces the default paths, with
+	// the HTML report next to it
+	if userCoverProfile != "" {
+		coverProfile, err = filepath.Abs(userCoverProfile)
+		if err != nil {
+			return err
+		}
+		coverHTML = strings.TrimSuffix(coverProfile, filepath.Ext(coverProfile)) + ".html"
+		if err := os.MkdirAll(filepath.Dir(coverProfile), 0755); err != nil {
+			return err
+		}
+	}
+
 	if verbose {
+		printGoEnv()
 		fmt.Printf("Found %d package(s) with Go files:\n", len(packages))
 		for _, pkg := range packages {
 			fmt.Printf("  - %s\n", pkg)
 		}
 		fmt.Println()
+	} else if compileOnly || crossCheck {
+		fmt.Printf("Compiling %d package(s)...\n", len(packages))
+	} else if benchMode {
+		fmt.Printf("Benchmarking %d package(s)...\n", len(packages))
 	} else {
 		fmt.Printf("Testing %d package(s)...\n", len(packages))
 	}
 
-	// Coverage output file
-	coverProfile := "/tmp/cover.out"
-	coverHTML := "/tmp/cover.html"
+	if cgoMode == "0" {
+		reportCgoPackages(packages)
+	}
 
-	// Build go test arguments
-	args := []string{"test"}
+	var generated []string
+	if generate && len(packages) > 0 {
+		if generated, err = runGenerate(ctx, packages); err != nil {
+			return withExitCode(exitTestsFailed, err)
+		}
+	}
 
-	// Add coverage flags
-	// -coverpkg with all discovered packages ensures cross-package calls are counted
-	// while respecting ignore patterns
-	coverpkgList := strings.Join(packages, ",")
-	args = append(args, "-coverprofile="+coverProfile, "-covermode=atomic", "-coverpkg="+coverpkgList)
+	if compileOnly {
+		return withExitCode(exitBuildFailed, runCompileCheck(packages))
+	}
+	if crossCheck {
+		return runCrossCheck(packages)
+	}
+	if benchMode {
+		return runBench(packages, userArgs)
+	}
 
-	// Add user-provided arguments
-	args = append(args, userArgs...)
+	if vetFirst && len(packages) > 0 {
+		if !runVet(packages) && vetFailFast {
+			return withExitCode(exitTestsFailed, fmt.Errorf("go vet reported problems"))
+		}
+	}
 
-	// Add all packages to test
-	args = append(args, packages...)
+	var lintErr error
+	if lint && len(packages) > 0 {
+		lintErr = runLint(packages)
+	}
 
-	// Run go test
-	if verbose {
-		fmt.Printf("Running: go %s\n\n", strings.Join(args, " "))
+	var unformatted []string
+	var fmtErr error
+	if fmtCheck && len(packages) > 0 {
+		unformatted, fmtErr = checkFormatting(packages)
 	}
 
-	cmd := exec.Command("go", args...)
+	if len(pprofKinds) > 0 || traceMode {
+		if err := preparePprofDir(); err != nil {
+			return fmt.Errorf("creating profile directory: %w", err)
+		}
+	}
 
-	var testOutput bytes.Buffer
+	if failFirstOrder && len(packages) > 1 {
+		if noHistory {
+			warnf("--fail-first-order needs the run history; ignored with --no-history")
+		} else if runs, err := loadHistory(); err != nil {
+			warnf("could not read run history: %v", err)
+		} else {
+			var failed int
+			if packages, failed = orderFailuresFirst(packages, runs); failed > 0 {
+				fmt.Printf("Testing %d package(s) that failed recently first\n", failed)
+			}
+		}
+	}
+
+	// Sections printed as tests finish already show local paths
+	loadModulePaths(ctx)
+	emitIDE(ideEvent{Event: "run_start", Version: ideProtocolVersion, Packages: packages})
+
+	result := &runner.Result{}
 	var testErr error
+	switch {
+	case len(packages) == 0:
+		// Only nested modules have packages to test
+	case len(tagVariants) > 0 && buildTags == "":
+		result, testErr = testTagVariants(ctx, packages, coverPkgs, userArgs, coverProfile)
+	default:
+		result, testErr = runTests(ctx, ".", packages, coverPkgs, userArgs, coverProfile)
+	}
 
-	if verbose {
-		// In verbose mode, stream output directly
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Stdin = os.Stdin
-		testErr = cmd.Run()
-	} else {
-		// In quiet mode, capture output and only show errors
-		cmd.Stdout = &testOutput
-		cmd.Stderr = &testOutput
-		testErr = cmd.Run()
+	if len(modules) > 0 {
+		var rootProfile string
+		if len(packages) > 0 {
+			rootProfile = coverProfile
+		}
+		sub, err := testSubmodules(ctx, modules, userArgs, rootProfile, coverProfile)
+		result.Output += sub.Output
+		result.Packages = append(result.Packages, sub.Packages...)
+		if testErr == nil {
+			testErr = err
+		}
+	}
 
-		// Only show output if there were errors
-		if testErr != nil {
-			fmt.Println("\n--- TEST ERRORS ---")
-			// Filter output to show only failures
-			printTestErrors(testOutput.String())
-			fmt.Println("-------------------")
+	oneline.result = result
+	if err := ctx.Err(); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			printPartialResults(result)
 		}
+		return err
 	}
 
+	if timingsFile != "" {
+		if result.Durations == nil {
+			result.Durations = parseTestDurations(result.Output, packages)
+		}
+		if err := saveTimings(timingsFile, result.Durations); err != nil {
+			warnf("could not save timings: %v", err)
+		}
+	}
+
+	if sanitizer != "" {
+		printSanitizerReports(sanitizer, parseSanitizerReports(result.Output))
+	}
+	if race {
+		printRaceReports(parseRaceReports(result.Output))
+	}
 	if testErr != nil {
-		fmt.Fprintf(os.Stderr, "\nTests failed\n")
-	} else {
+		printFuzzCrashes(triageFuzzCrashes(packages, result.Output))
+	}
+	if len(pprofKinds) > 0 {
+		reportPprofProfiles()
+	}
+
+	repeats := testRepeats(userArgs)
+	testErr = testFailure(result, testErr)
+	switch {
+	case testErr != nil:
+		if !onelineOutput {
+			fmt.Fprintf(os.Stderr, "\nTests failed\n")
+		}
+	case repeats > 1:
+		fmt.Printf("All tests passed (%d runs each)\n", repeats)
+	default:
 		fmt.Println("All tests passed")
 	}
+	if iconOutput {
+		printPackageStatuses(result)
+	}
+	if repeats > 1 {
+		printRepeatedTests(result, repeats)
+	}
+	printNearTimeouts(result, testTimeout(userArgs))
+	if junitFile != "" || junitDir != "" {
+		if err := writeJUnit(result, started); err != nil {
+			warnf("could not write JUnit report: %v", err)
+		}
+	}
 
 	// Check if coverage profile was generated
 	if _, err := os.Stat(coverProfile); os.IsNotExist(err) {
+		if testErr != nil {
+			return testErr
+		}
 		return fmt.Errorf("coverage profile not generated at %s", coverProfile)
 	}
 
+	var testsProfile, binariesProfile *coverprofile.Profile
+	if len(coverDirs) > 0 {
+		var err error
+		if testsProfile, binariesProfile, err = mergeCoverDirs(ctx, coverDirs, coverProfile); err != nil {
+			warnf("could not add the coverage of %s: %v", strings.Join(coverDirs, ", "), err)
+		}
+	}
+
 	// Parse and display coverage statistics
 	fmt.Println()
 	fmt.Println(strings.Repeat("=", 60))
 	fmt.Println("COVERAGE SUMMARY")
 	fmt.Println(strings.Repeat("=", 60))
 
-	if err := displayCoverageStats(coverProfile); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: could not parse coverage stats: %v\n", err)
+	var baseline *coverageBaseline
+	if !noHistory {
+		runs, err := loadHistory()
+		if err != nil {
+			warnf("could not read run history: %v", err)
+		}
+		baseline = previousCoverage(runs)
+	}
+	if err := displayCoverageStats(ctx, coverProfile, parseCachedPackages(result.Output), baseline); err != nil {
+		warnf("could not parse coverage stats: %v", err)
+	}
+
+	if badgeDir != "" {
+		if err := writeBadges(ctx, coverProfile, badgeDir, badgePerPackage); err != nil {
+			warnf("could not write badges: %v", err)
+		}
+	}
+
+	var coverageErr error
+	if minCoverage > 0 {
+		coverageErr = checkMinCoverage(ctx, coverProfile)
+	}
+	if newSince != "" {
+		coverageErr = errors.Join(coverageErr, checkNewPackages(ctx, coverProfile))
 	}
 
 	fmt.Println(strings.Repeat("=", 60))
 
+	if err := printUncoveredPackages(ctx, coverProfile, result); err != nil {
+		warnf("could not list uncovered packages: %v", err)
+	}
+
+	if byFunc {
+		if err := printFunctionCoverage(ctx, coverProfile, testsProfile, binariesProfile); err != nil {
+			warnf("could not report function coverage: %v", err)
+		}
+	}
+
+	if hotCount > 0 {
+		if err := printHotPaths(ctx, coverProfile, hotCount); err != nil {
+			warnf("could not report hot paths: %v", err)
+		}
+	}
+
+	if deadCode && len(packages) > 0 {
+		if err := printDeadCode(ctx, coverProfile, packages); err != nil {
+			warnf("could not report dead code: %v", err)
+		}
+	}
+
+	var generateErr error
+	if generated != nil {
+		printGenerateDrift(generated)
+		if len(generated) > 0 {
+			generateErr = withExitCode(exitTestsFailed, fmt.Errorf("go generate changed %d tracked file(s)", len(generated)))
+		}
+	}
+
+	if fmtCheck && fmtErr == nil {
+		printUnformatted(unformatted)
+		if len(unformatted) > 0 && fmtFail {
+			fmtErr = withExitCode(exitTestsFailed, fmt.Errorf("%d file(s) not formatted with %s", len(unformatted), fmtTool))
+		}
+	}
+
 	// Generate HTML coverage report
 	if verbose {
 		fmt.Printf("\nGenerating coverage report: %s\n", coverHTML)
 	}
-	coverCmd := exec.Command("go", "tool", "cover", "-html="+coverProfile, "-o", coverHTML)
+	coverCmd := goCommandContext(ctx, "tool", "cover", "-html="+coverProfile, "-o", coverHTML)
 	if verbose {
 		coverCmd.Stdout = os.Stdout
 		coverCmd.Stderr = os.Stderr
@@ -222,231 +1378,483 @@ func run(userArgs []string) error {
 		return fmt.Errorf("generating coverage HTML: %w", err)
 	}
 
-	// Open coverage report in browser
-	fmt.Printf("\nOpening %s in browser...\n", coverHTML)
-	if err := openBrowser(coverHTML); err != nil {
-		return fmt.Errorf("opening browser: %w", err)
+	summary := buildSummary(ctx, result, testErr == nil, started, coverProfile, coverHTML)
+	emitIDECoverage(summary)
+	oneline.coverage = &summary.Coverage.Percent
+
+	// The unified report is shown instead of the coverage report
+	report := coverHTML
+	if unifiedReport {
+		report = unifiedReportPath(coverHTML)
+		if err := writeUnifiedReport(ctx, report, summary); err != nil {
+			return fmt.Errorf("generating unified report: %w", err)
+		}
 	}
 
-	return nil
-}
+	if reportTmpl != nil {
+		if err := renderReportTemplate(reportTmpl, summary); err != nil {
+			warnf("could not render %s: %v", templateFile, err)
+		}
+	}
 
-// printTestErrors filters and prints only error-related output
-func printTestErrors(output string) {
-	lines := strings.Split(output, "\n")
-	for _, line := range lines {
-		// Show FAIL lines, error messages, and panic info
-		if strings.Contains(line, "FAIL") ||
-			strings.Contains(line, "Error") ||
-			strings.Contains(line, "error") ||
-			strings.Contains(line, "panic") ||
-			strings.Contains(line, "--- FAIL") ||
-			strings.HasPrefix(strings.TrimSpace(line), "got:") ||
-			strings.HasPrefix(strings.TrimSpace(line), "want:") ||
-			strings.HasPrefix(strings.TrimSpace(line), "expected") ||
-			strings.Contains(line, "_test.go:") {
-			fmt.Println(line)
+	if artifactsDir != "" {
+		if err := saveArtifacts(&summary, result.Output, report); err != nil {
+			warnf("could not save artifacts: %v", err)
+		}
+	}
+	if !noHistory {
+		if err := recordRun(ctx, summary); err != nil {
+			warnf("could not record run history: %v", err)
+		} else if n, err := pruneHistory(historyKeep, historyKeepRuns); err != nil {
+			warnf("could not prune run history: %v", err)
+		} else if n > 0 {
+			debugf("pruned %d run(s) from the history", n)
+		}
+	}
+	if len(plugins) > 0 {
+		runPlugins(ctx, summary)
+	}
+	if copySummary {
+		if via, err := copyToClipboard(markdownSummary(summary)); err != nil {
+			warnf("could not copy the summary: %v", err)
+		} else {
+			fmt.Printf("\nSummary copied to the clipboard (%s)\n", via)
+		}
+	}
+
+	if noBrowser {
+		fmt.Printf("\nCoverage report: %s\n", report)
+	} else {
+		// Open coverage report in browser
+		fmt.Println()
+		if err := openReport(report); err != nil {
+			return fmt.Errorf("opening browser: %w", err)
 		}
 	}
+
+	if traceMode {
+		openTrace()
+	}
+
+	if summary.ArtifactDir != "" {
+		fmt.Printf("Artifacts (run %s): %s\n", summary.RunID, summary.ArtifactDir)
+	}
+
+	// The most severe failure comes first, as it decides the exit code
+	return errors.Join(testErr, lintErr, fmtErr, generateErr, coverageErr)
 }
 
-// CoverageStats holds coverage statistics for a package
-type CoverageStats struct {
-	TotalStatements   int
-	CoveredStatements int
+// testFailure classifies a failed test run by its exit code: packages that
+// don't build take precedence over failing tests
+func testFailure(result *runner.Result, err error) error {
+	var exitErr *exec.ExitError
+	if err == nil || !errors.As(err, &exitErr) {
+		return err
+	}
+
+	var failed, broken int
+	for _, res := range result.Failed() {
+		if res.Status == runner.StatusBuildFailed {
+			broken++
+		} else {
+			failed++
+		}
+	}
+	switch {
+	case broken > 0:
+		return withExitCode(exitBuildFailed, fmt.Errorf("%d package(s) failed to build", broken))
+	case failed > 0:
+		return withExitCode(exitTestsFailed, fmt.Errorf("%d package(s) failed", failed))
+	}
+	// go test failed before reporting any package, e.g. on an invalid flag
+	return withExitCode(exitBuildFailed, err)
 }
 
-// displayCoverageStats parses the coverage profile and displays per-package and total coverage
-func displayCoverageStats(coverProfile string) error {
-	file, err := os.Open(coverProfile)
+// checkMinCoverage fails if the total coverage of the profile is below
+// --min-coverage
+func checkMinCoverage(ctx context.Context, coverProfile string) error {
+	profile, err := coverprofile.ParseFile(ctx, coverProfile)
 	if err != nil {
-		return err
+		return fmt.Errorf("checking coverage: %w", err)
 	}
-	defer file.Close()
+	total := profile.Total().Percent()
+	if total >= minCoverage {
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "\nCoverage %.1f%% is below the minimum of %g%%\n", total, minCoverage)
+	return withExitCode(exitCoverage, fmt.Errorf("coverage %.1f%% below minimum %g%%", total, minCoverage))
+}
 
-	// Map of package path to coverage stats
-	packageStats := make(map[string]*CoverageStats)
+// runTests runs go test through the runner package. Unless verbose, the
+// output of failing tests is filtered into a TEST ERRORS section.
+func runTests(ctx context.Context, dir string, packages, coverPkgs, userArgs []string, coverProfile string) (*runner.Result, error) {
+	// Nested modules and tag variants after the limit was reached don't run
+	if failureLimitReached() {
+		return &runner.Result{}, nil
+	}
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
+	workers := 1
+	if jobs > 1 {
+		workers = jobs
+	}
+	flags, explanation := parallelism(userArgs, workers)
+	if verbose {
+		fmt.Println(explanation)
+	}
+	userArgs = insertGoTestFlags(userArgs, flags...)
+
+	opts := runner.Options{
+		Dir:           dir,
+		Packages:      packages,
+		CoverPackages: coverPkgs,
+		CoverMode:     coverMode,
+		CoverProfile:  coverProfile,
+		Args:          userArgs,
+		Jobs:          jobs,
+		// go test only writes CPU/memory profiles and traces for a single package
+		PerPackage:  len(pprofKinds) > 0 || traceMode,
+		PackageArgs: pprofArgs,
+		Go:          goBinary,
+		Env:         testEnviron(),
+		Debug:       debugWriter(),
+	}
+	if ideProtocol != "" {
+		opts.Progress = ideProgress
+	}
+	runCtx := ctx
+	if maxFailures > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		failureLimit.cancel = cancel
+		report := opts.Progress
+		opts.Progress = func(e runner.Event) {
+			if report != nil {
+				report(e)
+			}
+			countFailure(e)
+		}
+	}
+	if verbose {
+		opts.Stdout = os.Stdout
+		opts.Stdin = os.Stdin
+		if plainOutput {
+			opts.Stdout = &asciiWriter{w: os.Stdout}
+		}
+	}
 
-		// Skip mode line
-		if strings.HasPrefix(line, "mode:") {
-			continue
+	result, err := runner.Run(runCtx, opts)
+	stopped := failureLimitReached() && runCtx.Err() != nil && ctx.Err() == nil
+	if stopped {
+		err = stoppedResult(result)
+	}
+	if err == nil || verbose || ctx.Err() != nil {
+		if stopped {
+			fmt.Printf("\nStopped after %d failure(s) (--max-failures); the rest of the run was canceled\n", maxFailures)
 		}
+		return result, err
+	}
 
-		// Parse coverage line: file:startLine.startCol,endLine.endCol numStatements count
-		// Example: github.com/user/pkg/file.go:10.2,12.16 3 1
-		parts := strings.Fields(line)
-		if len(parts) != 3 {
-			continue
+	outputs := []string{result.Output}
+	if opts.PerPackage || opts.Jobs > 1 {
+		outputs = nil
+		for _, res := range result.Failed() {
+			outputs = append(outputs, res.Output)
 		}
+	}
+	if plainOutput {
+		for i := range outputs {
+			outputs[i] = asciiOnly(outputs[i])
+		}
+	}
 
-		// Extract file path (before the colon with line numbers)
-		filePart := parts[0]
-		colonIdx := strings.LastIndex(filePart, ":")
-		if colonIdx == -1 {
-			continue
+	// Build errors need a different fix than failing tests, so they are
+	// shown apart, and only packages that ran get TEST ERRORS
+	var buildErrs []buildError
+	for i, output := range outputs {
+		var errs []buildError
+		errs, outputs[i] = splitBuildErrors(output)
+		buildErrs = append(buildErrs, errs...)
+	}
+	printBuildErrors(buildErrs, result)
+
+	testsFailed := len(result.Packages) == 0
+	for _, res := range result.Failed() {
+		testsFailed = testsFailed || res.Status != runner.StatusBuildFailed
+	}
+	if testsFailed {
+		fmt.Println("\n--- TEST ERRORS ---")
+		for _, output := range outputs {
+			printTestErrors(output)
 		}
-		filePath := filePart[:colonIdx]
+		fmt.Println("-------------------")
+	}
+	if stopped {
+		fmt.Printf("\nStopped after %d failure(s) (--max-failures); the rest of the run was canceled\n", maxFailures)
+	}
+	return result, err
+}
 
-		// Get package path (directory of the file)
-		pkgPath := filepath.Dir(filePath)
+// unifiedReportPath returns where --unified writes its report: next to the
+// coverage report, named report instead of cover
+func unifiedReportPath(coverHTML string) string {
+	dir, name := filepath.Split(coverHTML)
+	if strings.Contains(name, "cover") {
+		return filepath.Join(dir, strings.Replace(name, "cover", "report", 1))
+	}
+	return filepath.Join(dir, "report-"+name)
+}
 
-		// Parse number of statements
-		numStatements, err := strconv.Atoi(parts[1])
-		if err != nil {
-			continue
+// printPartialResults lists the packages that finished before
+// --max-duration stopped the run; go test only writes the coverage profile
+// at the end, so there is no coverage to report
+func printPartialResults(result *runner.Result) {
+	var finished []runner.PackageResult
+	for _, res := range result.Packages {
+		// Packages killed mid-run have no result line to take the import path from
+		if res.ImportPath != "" {
+			finished = append(finished, res)
 		}
+	}
 
-		// Parse count (how many times executed)
-		count, err := strconv.Atoi(parts[2])
-		if err != nil {
+	fmt.Printf("\n--- PARTIAL RESULTS (stopped after %s) ---\n", maxDuration)
+	if len(finished) == 0 {
+		fmt.Println("No package finished")
+	}
+	for _, res := range finished {
+		fmt.Printf("  %-12s %s\n", res.Status, res.Package)
+		for _, f := range res.Failures {
+			fmt.Printf("      --- FAIL: %s\n", f.Test)
+		}
+	}
+	fmt.Println("---------------------")
+}
+
+// printTestErrors filters and prints only error-related output. Unless
+// --full-failures is given, each failing test is cut off after
+// failureLines lines, so one huge failure can't hide the others. A test
+// that failed repeatedly (-count) is only shown once.
+func printTestErrors(output string) {
+	var shown, hidden int
+	seen := make(map[string]bool)
+	repeated := false
+	flush := func() {
+		if hidden > 0 {
+			fmt.Printf("    (+%d more lines, run with --full-failures)\n", hidden)
+		}
+		shown, hidden = 0, 0
+	}
+
+	lines := strings.Split(output, "\n")
+	for _, line := range lines {
+		// Show FAIL lines, error messages, and panic info
+		if !(strings.Contains(line, "FAIL") ||
+			strings.Contains(line, "Error") ||
+			strings.Contains(line, "error") ||
+			strings.Contains(line, "panic") ||
+			strings.Contains(line, "--- FAIL") ||
+			strings.HasPrefix(strings.TrimSpace(line), "got:") ||
+			strings.HasPrefix(strings.TrimSpace(line), "want:") ||
+			strings.HasPrefix(strings.TrimSpace(line), "expected") ||
+			strings.Contains(line, "_test.go:")) {
 			continue
 		}
 
-		// Initialize package stats if needed
-		if packageStats[pkgPath] == nil {
-			packageStats[pkgPath] = &CoverageStats{}
+		switch {
+		case strings.HasPrefix(line, "--- FAIL"):
+			// A top-level test starts a new failure; its subtests belong to it
+			flush()
+			name, _, _ := strings.Cut(strings.TrimPrefix(line, "--- FAIL: "), " (")
+			repeated = seen[name]
+			seen[name] = true
+			if !repeated {
+				fmt.Println(line)
+			}
+		case strings.HasPrefix(line, "FAIL"), strings.HasPrefix(line, "ok "):
+			// Package results are always shown
+			flush()
+			seen, repeated = make(map[string]bool), false
+			fmt.Println(line)
+		case repeated:
+		case fullFailures || shown < failureLines:
+			fmt.Println(line)
+			shown++
+		default:
+			hidden++
 		}
+	}
+	flush()
+}
 
-		packageStats[pkgPath].TotalStatements += numStatements
-		if count > 0 {
-			packageStats[pkgPath].CoveredStatements += numStatements
+// parseCachedPackages reports, for every package with a test result in the
+// go test output, whether that result was served from the test cache
+func parseCachedPackages(output string) map[string]bool {
+	cached := make(map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || (fields[0] != "ok" && fields[0] != "FAIL") {
+			continue
 		}
+		cached[fields[1]] = fields[2] == "(cached)"
 	}
+	return cached
+}
 
-	if err := scanner.Err(); err != nil {
+// displayCoverageStats parses the coverage profile and displays per-package and total coverage.
+// Packages whose test results came from the go test cache are marked. With a
+// baseline, each row shows the change in coverage since then.
+func displayCoverageStats(ctx context.Context, coverProfile string, cached map[string]bool, baseline *coverageBaseline) error {
+	profile, err := coverprofile.ParseFile(ctx, coverProfile)
+	if err != nil {
 		return err
 	}
 
-	if len(packageStats) == 0 {
+	packages := profile.Packages()
+	if len(packages) == 0 {
 		fmt.Println("No coverage data found")
 		return nil
 	}
 
-	// Sort packages for consistent output
-	var pkgNames []string
-	for pkg := range packageStats {
-		pkgNames = append(pkgNames, pkg)
+	// The package column fits the longest package, as far as the terminal
+	// allows; longer names are shortened in the middle
+	const coverageCol = 10 // " COVERAGE" / "   100.0%"
+	markerCol := 0
+	if len(cached) > 0 {
+		markerCol = len(" (cached)")
+	}
+	deltaCol := 0
+	if baseline != nil {
+		deltaCol = len("  -100.0%")
+		markerCol += deltaCol
 	}
-	sort.Strings(pkgNames)
+	pkgCol := len("PACKAGE")
+	for _, stats := range packages {
+		pkgCol = max(pkgCol, len(localPath(stats.Package)))
+	}
+	pkgCol = max(min(pkgCol, terminalWidth()-coverageCol-markerCol), 20)
 
 	// Display header
 	fmt.Println()
-	fmt.Printf("%-61s %10s\n", "PACKAGE", "COVERAGE")
-	fmt.Println(strings.Repeat("-", 70))
-
-	// Calculate and display per-package coverage
-	var totalStatements, totalCovered int
-
-	for _, pkg := range pkgNames {
-		stats := packageStats[pkg]
-		totalStatements += stats.TotalStatements
-		totalCovered += stats.CoveredStatements
-
-		var coverage float64
-		if stats.TotalStatements > 0 {
-			coverage = float64(stats.CoveredStatements) / float64(stats.TotalStatements) * 100
+	fmt.Printf("%-*s %9s\n", pkgCol, "PACKAGE", "COVERAGE")
+	fmt.Println(strings.Repeat("-", pkgCol+coverageCol))
+
+	// Display per-package coverage
+	for _, stats := range packages {
+		marker := ""
+		if cached[stats.Package] {
+			marker = " (cached)"
 		}
-
-		// Truncate long package names with "..." prefix
-		displayPkg := pkg
-		if len(displayPkg) > 58 {
-			displayPkg = "..." + displayPkg[len(displayPkg)-55:]
+		delta := ""
+		if prev, ok := baseline.packages()[stats.Package]; ok {
+			delta = formatDelta(stats.Percent()-prev, deltaCol)
+		} else if deltaCol > 0 {
+			delta = fmt.Sprintf("%*s", deltaCol, "new")
 		}
-
-		fmt.Printf("%-61s %8.1f%%\n", displayPkg, coverage)
+		row := fmt.Sprintf("%-*s %8.1f%%%s%s", pkgCol, middleEllipsis(localPath(stats.Package), pkgCol), stats.Percent(), delta, marker)
+		fmt.Println(strings.TrimRight(row, " "))
 	}
 
 	// Display total
-	fmt.Println(strings.Repeat("-", 70))
+	fmt.Println(strings.Repeat("-", pkgCol+coverageCol))
 
-	var totalCoverage float64
-	if totalStatements > 0 {
-		totalCoverage = float64(totalCovered) / float64(totalStatements) * 100
+	total := profile.Total()
+	totalDelta := ""
+	if prev, ok := baseline.total(packages); ok {
+		totalDelta = formatDelta(total.Percent()-prev, deltaCol)
+	}
+	fmt.Printf("%-*s %8.1f%%%s\n", pkgCol, "TOTAL", total.Percent(), strings.TrimRight(totalDelta, " "))
+	fmt.Printf("\nStatements: %d/%d covered\n", total.Covered, total.Statements)
+
+	if len(cached) > 0 {
+		var numCached int
+		for _, c := range cached {
+			if c {
+				numCached++
+			}
+		}
+		fmt.Printf("Test results: %d executed, %d cached\n", len(cached)-numCached, numCached)
 	}
-
-	fmt.Printf("%-61s %8.1f%%\n", "TOTAL", totalCoverage)
-	fmt.Printf("\nStatements: %d/%d covered\n", totalCovered, totalStatements)
 
 	return nil
 }
 
-// findGoPackages finds all directories containing .go files (excluding test files only dirs)
-func findGoPackages(root string) ([]string, error) {
-	var packages []string
-	seen := make(map[string]bool)
-
-	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		// Skip hidden directories and common non-source directories
-		if info.IsDir() {
-			name := info.Name()
-			// Skip hidden dirs (but not "." which is the root), vendor, and testdata
-			if (strings.HasPrefix(name, ".") && name != ".") || name == "vendor" || name == "testdata" {
-				return filepath.SkipDir
-			}
+// printUncoveredPackages lists the packages with no coverage at all, and
+// those without tests of their own, so they stand out from the main table
+func printUncoveredPackages(ctx context.Context, coverProfile string, result *runner.Result) error {
+	profile, err := coverprofile.ParseFile(ctx, coverProfile)
+	if err != nil {
+		return err
+	}
 
-			// Skip directories matching ignore patterns
-			if shouldIgnore(path) {
-				return filepath.SkipDir
-			}
-			return nil
+	noTests := make(map[string]bool)
+	for _, res := range result.Packages {
+		if res.Status == runner.StatusNoTests {
+			noTests[res.ImportPath] = true
 		}
+	}
 
-		// Check for .go files (including test files)
-		if strings.HasSuffix(path, ".go") {
-			dir := filepath.Dir(path)
-			if !seen[dir] && !shouldIgnore(dir) {
-				seen[dir] = true
-				// Convert to package path format
-				if dir == "." {
-					packages = append(packages, "./.")
-				} else {
-					packages = append(packages, "./"+dir)
-				}
-			}
+	var uncovered []coverprofile.PackageStats
+	for _, stats := range profile.Packages() {
+		if stats.Statements > 0 && (stats.Covered == 0 || noTests[stats.Package]) {
+			uncovered = append(uncovered, stats)
 		}
-
+	}
+	if len(uncovered) == 0 {
 		return nil
-	})
+	}
 
-	if err != nil {
-		return nil, err
+	pkgCol := len("PACKAGE")
+	for _, stats := range uncovered {
+		pkgCol = max(pkgCol, len(localPath(stats.Package)))
 	}
+	pkgCol = max(min(pkgCol, terminalWidth()-35), 20)
 
-	return packages, nil
+	fmt.Printf("\n--- UNCOVERED PACKAGES (%d) ---\n", len(uncovered))
+	for _, stats := range uncovered {
+		note := ""
+		if noTests[stats.Package] {
+			note = " (no tests)"
+		}
+		fmt.Printf("%-*s %8.1f%% %6d statement(s)%s\n", pkgCol, middleEllipsis(localPath(stats.Package), pkgCol), stats.Percent(), stats.Statements, note)
+	}
+	fmt.Println("------------------------------")
+	return nil
 }
 
-// shouldIgnore checks if a path matches any of the ignore patterns
-func shouldIgnore(path string) bool {
-	for _, pattern := range ignorePatterns {
-		if strings.Contains(path, pattern) {
-			return true
-		}
+// discoverOptions returns the discovery settings from the command line
+func discoverOptions(root string) discover.Options {
+	opts := discover.Options{
+		Root:           root,
+		Tags:           buildTags,
+		Ignore:         ignorePatterns,
+		Rules:          ignoreRules,
+		FollowSymlinks: followSymlinks,
+		Go:             goBinary,
+		Env:            withEnv(os.Environ(), goEnv),
 	}
-	return false
+	if verbose || logThreshold == levelDebug {
+		opts.Warnings = os.Stderr
+	}
+	opts.Debug = debugWriter()
+	return opts
 }
 
-// openBrowser opens the specified URL in the default browser
-func openBrowser(url string) error {
-	var cmd *exec.Cmd
-
-	switch runtime.GOOS {
-	case "darwin":
-		cmd = exec.Command("open", url)
-	case "linux":
-		cmd = exec.Command("xdg-open", url)
-	case "windows":
-		cmd = exec.Command("cmd", "/c", "start", url)
-	default:
-		return fmt.Errorf("unsupported platform: %s", runtime.GOOS)
+// findGoPackages finds all packages under root in the "./dir" form used on
+// the go test command line
+func findGoPackages(ctx context.Context, root string) ([]string, error) {
+	found, err := discover.Packages(ctx, discoverOptions(root))
+	if err != nil {
+		return nil, err
+	}
+	packages := make([]string, len(found))
+	for i, pkg := range found {
+		packages[i] = pkg.Path
 	}
+	return packages, nil
+}
 
-	return cmd.Start()
+// shouldIgnore checks if a path matches any of the ignore patterns or the ignore file
+func shouldIgnore(path string) bool {
+	opts := discover.Options{Ignore: ignorePatterns, Rules: ignoreRules}
+	return opts.Ignored(path)
 }
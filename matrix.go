@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Hoofffman/gotest/pkg/coverprofile"
+)
+
+// matrixResult holds the outcome of the suite under one Go version
+type matrixResult struct {
+	Version  string
+	Passed   bool
+	Coverage string
+	Duration time.Duration
+	Err      error
+}
+
+// runMatrix implements "gotest matrix": the suite is run once per Go version
+// by invoking gotest itself with --go, followed by a comparison table. All
+// other arguments are passed through to each run.
+func runMatrix(args []string) error {
+	var versions []string
+	var passthrough []string
+	for i := 0; i < len(args); i++ {
+		if isFlag(args[i], "--go", "-go") {
+			if value, ok := flagValue(args, &i, "--go", "-go"); ok {
+				versions = append(versions, splitList(value)...)
+			}
+			continue
+		}
+		passthrough = append(passthrough, args[i])
+	}
+	if len(versions) == 0 {
+		return fmt.Errorf("usage: gotest matrix --go <versions> [options] [go test flags...]")
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("locating gotest executable: %w", err)
+	}
+
+	// Each run writes its own profile, unless the arguments name one
+	profileDir, err := os.MkdirTemp("", "gotest-matrix-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(profileDir)
+	userProfile := ""
+	for i := 0; i < len(passthrough) && passthrough[i] != "--"; i++ {
+		if isFlag(passthrough[i], "-coverprofile", "--coverprofile") {
+			userProfile, _ = flagValue(passthrough, &i, "-coverprofile", "--coverprofile")
+		}
+	}
+
+	var results []matrixResult
+	for i, version := range versions {
+		// Resolved here, so the runs don't each look up the latest patch
+		// release
+		version = resolveGoVersion(version)
+		fmt.Printf("\n=== Go %s\n", strings.TrimPrefix(version, "go"))
+
+		profile := userProfile
+		childArgs := []string{"--go", version, "--no-browser"}
+		if profile == "" {
+			profile = filepath.Join(profileDir, fmt.Sprintf("%d.out", i))
+			childArgs = append(childArgs, "-coverprofile="+profile)
+		}
+		os.Remove(profile)
+		childArgs = append(childArgs, passthrough...)
+
+		var output bytes.Buffer
+		cmd := exec.Command(self, childArgs...)
+		cmd.Stdout = io.MultiWriter(os.Stdout, &output)
+		cmd.Stderr = io.MultiWriter(os.Stderr, &output)
+
+		start := time.Now()
+		runErr := cmd.Run()
+		res := matrixResult{
+			Version:  version,
+			Passed:   runErr == nil,
+			Duration: time.Since(start),
+			Coverage: "-",
+			Err:      runErr,
+		}
+		for _, line := range strings.Split(output.String(), "\n") {
+			if fields := strings.Fields(line); strings.HasPrefix(line, "Using ") && len(fields) > 1 {
+				res.Version = fields[1]
+			}
+		}
+		if p, err := coverprofile.ParseFile(context.Background(), profile); err == nil {
+			res.Coverage = fmt.Sprintf("%.1f%%", p.Total().Percent())
+		}
+		results = append(results, res)
+	}
+
+	fmt.Println()
+	fmt.Println(strings.Repeat("=", 60))
+	fmt.Println("GO VERSION MATRIX")
+	fmt.Println(strings.Repeat("=", 60))
+	fmt.Printf("%-20s %-8s %10s %12s\n", "VERSION", "RESULT", "COVERAGE", "DURATION")
+	fmt.Println(strings.Repeat("-", 60))
+
+	var failed int
+	for _, res := range results {
+		result := "PASS"
+		if !res.Passed {
+			result = "FAIL"
+			failed++
+		}
+		fmt.Printf("%-20s %-8s %10s %12s\n", res.Version, result, res.Coverage, res.Duration.Round(time.Second))
+	}
+	fmt.Println(strings.Repeat("=", 60))
+
+	if failed > 0 {
+		return withExitCode(exitTestsFailed, fmt.Errorf("%d of %d Go version(s) failed", failed, len(results)))
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/Hoofffman/gotest/pkg/runner"
+)
+
+// maxFailures stops the run after this many failing tests or packages that
+// don't build (--max-failures); zero means no limit
+var maxFailures int
+
+// failureLimit counts failures across all go test invocations of the run
+// and cancels the current one when maxFailures is reached
+var failureLimit struct {
+	mu       sync.Mutex
+	failures int
+	cancel   context.CancelFunc
+}
+
+// countFailure is a runner progress handler counting failed top-level
+// tests, whose subtests fail with them, and packages that don't build
+func countFailure(e runner.Event) {
+	failed := e.Kind == runner.EventTestFinish && e.Test.Status == runner.TestFailed && !strings.Contains(e.Test.Name, "/") ||
+		e.Kind == runner.EventPackageFinish && e.Result.Status == runner.StatusBuildFailed
+	if !failed {
+		return
+	}
+	failureLimit.mu.Lock()
+	defer failureLimit.mu.Unlock()
+	failureLimit.failures++
+	if failureLimit.failures == maxFailures {
+		failureLimit.cancel()
+	}
+}
+
+// failureLimitReached reports whether --max-failures stopped the run
+func failureLimitReached() bool {
+	failureLimit.mu.Lock()
+	defer failureLimit.mu.Unlock()
+	return maxFailures > 0 && failureLimit.failures >= maxFailures
+}
+
+// stoppedResult drops the packages that didn't finish when the run was
+// stopped: those killed mid-run have no result line to take the import
+// path from, and those not started never ran
+func stoppedResult(result *runner.Result) error {
+	var finished []runner.PackageResult
+	for _, res := range result.Packages {
+		if res.ImportPath != "" {
+			finished = append(finished, res)
+		}
+	}
+	result.Packages = finished
+	return withExitCode(exitTestsFailed, fmt.Errorf("stopped after %d failure(s) (--max-failures)", maxFailures))
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// moduleDirs maps the path of each main module (several in a workspace) to
+// its directory relative to the current directory, longest path first, so
+// coverage can be shown by local path. It is empty until loadModulePaths.
+var moduleDirs []moduleDir
+
+type moduleDir struct {
+	path string
+	dir  string // slash-separated, relative to the current directory
+}
+
+// loadModulePaths resolves the main modules with go list -m. Modules outside
+// the current directory are left out, as are all modules with --import-paths;
+// their packages keep their import paths.
+func loadModulePaths(ctx context.Context) {
+	moduleDirs = nil
+	if importPaths {
+		return
+	}
+	out, err := goCommandContext(ctx, "list", "-m", "-f", "{{.Path}}\t{{.Dir}}").Output()
+	if err != nil {
+		debugf("could not resolve module paths: %v", err)
+		return
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		modPath, dir, ok := strings.Cut(line, "\t")
+		if !ok || dir == "" {
+			continue
+		}
+		rel, err := filepath.Rel(cwd, dir)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		moduleDirs = append(moduleDirs, moduleDir{path: modPath, dir: filepath.ToSlash(rel)})
+	}
+	sort.Slice(moduleDirs, func(i, j int) bool { return len(moduleDirs[i].path) > len(moduleDirs[j].path) })
+}
+
+// localPath returns the path of a package, or a file in it, relative to the
+// current directory: "internal/auth" for "example.com/app/internal/auth".
+// Packages of other modules keep their import path; "./dir" paths of nested
+// modules lose the "./".
+func localPath(importPath string) string {
+	if rel, ok := strings.CutPrefix(importPath, "./"); ok {
+		return rel
+	}
+	for _, m := range moduleDirs {
+		if importPath == m.path {
+			return m.dir
+		}
+		if rest, ok := strings.CutPrefix(importPath, m.path+"/"); ok {
+			return path.Join(m.dir, rest)
+		}
+	}
+	return importPath
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+)
+
+// noNetwork runs the test binaries without network access (--no-network)
+var noNetwork bool
+
+// proxyEnv sends HTTP requests to a port nothing listens on, for where
+// network namespaces aren't available: they fail at once instead of
+// reaching the network. Go's HTTP client doesn't proxy localhost, so local
+// test servers keep working.
+var proxyEnv = map[string]string{
+	"HTTP_PROXY": "http://127.0.0.1:9", "http_proxy": "http://127.0.0.1:9",
+	"HTTPS_PROXY": "http://127.0.0.1:9", "https_proxy": "http://127.0.0.1:9",
+	"ALL_PROXY": "http://127.0.0.1:9", "all_proxy": "http://127.0.0.1:9",
+	"NO_PROXY": "", "no_proxy": "",
+}
+
+// noNetworkExec returns the go test -exec flag that runs every test binary
+// through "gotest __no-network". Where no network namespace can be created,
+// only the proxy variables block the network, which a warning says.
+func noNetworkExec(args []string) (string, error) {
+	if _, ok := goTestFlag(args, "exec"); ok {
+		return "", fmt.Errorf("--no-network can't be combined with -exec")
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("locating gotest executable: %w", err)
+	}
+	if strings.ContainsAny(self, `'"`) {
+		return "", fmt.Errorf("--no-network: the path of gotest, %s, contains quotes", self)
+	}
+	wrapper := "'" + self + "' __no-network"
+	if err := probeNetworkNamespace(self); err != nil {
+		warnf("--no-network can't create a network namespace (%v); only HTTP requests through the proxy variables are blocked", err)
+		wrapper += " -proxy"
+	}
+	debugf("running test binaries with -exec %s", wrapper)
+	return "-exec=" + wrapper, nil
+}
+
+// runNoNetwork implements "gotest __no-network [-proxy] program [args]",
+// the -exec wrapper of --no-network: it runs the test binary in a new
+// network namespace that has only a loopback interface or, with -proxy,
+// with proxyEnv. It returns the binary's exit code.
+func runNoNetwork(args []string) int {
+	proxyOnly := len(args) > 0 && args[0] == "-proxy"
+	if proxyOnly {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: gotest __no-network [-proxy] program [args]")
+		return exitToolError
+	}
+
+	var cmd *exec.Cmd
+	if proxyOnly {
+		cmd = exec.Command(args[0], args[1:]...)
+		cmd.Env = withEnv(os.Environ(), proxyEnv)
+	} else {
+		self, err := os.Executable()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: locating gotest executable: %v\n", err)
+			return exitToolError
+		}
+		cmd = exec.Command(self, append([]string{"__netns"}, args...)...)
+		isolateNetwork(cmd)
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --no-network: %v\n", err)
+		return exitToolError
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardedSignals...)
+	go func() {
+		for s := range signals {
+			cmd.Process.Signal(s)
+		}
+	}()
+
+	err := cmd.Wait()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exitErr) && exitErr.ExitCode() >= 0:
+		return exitErr.ExitCode()
+	default:
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// capNetAdmin is CAP_NET_ADMIN, which bringing up the loopback interface
+// takes
+const capNetAdmin = 12
+
+// isolateNetwork makes cmd start in new user and network namespaces, which
+// unprivileged users may create. The process keeps its user and group IDs
+// and, until runNetns drops it, the capability to configure the namespace's
+// network.
+func isolateNetwork(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  syscall.CLONE_NEWUSER | syscall.CLONE_NEWNET,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}},
+		AmbientCaps: []uintptr{capNetAdmin},
+		// The test binary doesn't outlive a wrapper go test kills
+		Pdeathsig: syscall.SIGKILL,
+	}
+}
+
+// probeNetworkNamespace checks that network namespaces can be created,
+// which kernels and container runtimes may forbid
+func probeNetworkNamespace(self string) error {
+	cmd := exec.Command(self, "__netns")
+	isolateNetwork(cmd)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%s", strings.TrimPrefix(msg, "Error: "))
+		}
+		return err
+	}
+	return nil
+}
+
+// runNetns implements "gotest __netns [program [args]]", which runs in the
+// namespaces of isolateNetwork: it brings up the loopback interface, so
+// tests can still serve and connect on localhost, drops its capabilities
+// and replaces itself with the program. Without a program it only checks
+// the namespace.
+func runNetns(args []string) int {
+	if err := loopbackUp(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: bringing up loopback interface: %v\n", err)
+		return exitToolError
+	}
+	if len(args) == 0 {
+		return 0
+	}
+	const prCapAmbient, prCapAmbientClearAll = 47, 4
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prCapAmbient, prCapAmbientClearAll, 0); errno != 0 {
+		fmt.Fprintf(os.Stderr, "Error: dropping capabilities: %v\n", errno)
+		return exitToolError
+	}
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitToolError
+	}
+	err = syscall.Exec(path, args, os.Environ())
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	return exitToolError
+}
+
+// loopbackUp sets the IFF_UP flag of the loopback interface, which a new
+// network namespace starts without
+func loopbackUp() error {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	// struct ifreq: the interface name, then a union holding the flags
+	var req struct {
+		name  [syscall.IFNAMSIZ]byte
+		flags uint16
+		_     [22]byte
+	}
+	copy(req.name[:], "lo")
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.SIOCGIFFLAGS, uintptr(unsafe.Pointer(&req))); errno != 0 {
+		return errno
+	}
+	req.flags |= syscall.IFF_UP
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.SIOCSIFFLAGS, uintptr(unsafe.Pointer(&req))); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+func isolateNetwork(cmd *exec.Cmd) {}
+
+func probeNetworkNamespace(self string) error {
+	return fmt.Errorf("only supported on Linux")
+}
+
+func runNetns(args []string) int {
+	fmt.Fprintln(os.Stderr, "Error: network namespaces are only supported on Linux")
+	return exitToolError
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Hoofffman/gotest/pkg/coverprofile"
+)
+
+// defaultNewPackageMin is the coverage new packages need if the policy
+// doesn't say
+const defaultNewPackageMin = 80
+
+// checkNewPackages applies the coverage policy for new packages: packages
+// that didn't exist at newSince (a date or git ref) must have at least
+// newPackageMin percent coverage. Older packages are exempt.
+func checkNewPackages(ctx context.Context, coverProfile string) error {
+	base, err := policyBase(newSince)
+	if err != nil {
+		return fmt.Errorf("new package policy: %w", err)
+	}
+	existing, err := packageDirsAt(base)
+	if err != nil {
+		return fmt.Errorf("new package policy: %w", err)
+	}
+	top, err := gitOutput("rev-parse", "--show-toplevel")
+	if err != nil {
+		return fmt.Errorf("new package policy: %w", err)
+	}
+	dirs, err := packageDirs(ctx)
+	if err != nil {
+		return err
+	}
+	profile, err := coverprofile.ParseFile(ctx, coverProfile)
+	if err != nil {
+		return err
+	}
+
+	var checked int
+	var failing []coverprofile.PackageStats
+	for _, stats := range profile.Packages() {
+		dir, ok := dirs[stats.Package]
+		if !ok && strings.HasPrefix(stats.Package, "./") {
+			dir, _ = filepath.Abs(stats.Package)
+		}
+		rel, err := filepath.Rel(top, dir)
+		if err != nil || dir == "" || existing[filepath.ToSlash(rel)] {
+			continue
+		}
+		checked++
+		if stats.Percent() < newPackageMin {
+			failing = append(failing, stats)
+		}
+	}
+
+	if checked == 0 {
+		return nil
+	}
+	if len(failing) == 0 {
+		fmt.Printf("\nNew package policy: %d package(s) added since %s, all at %g%% or more\n", checked, newSince, newPackageMin)
+		return nil
+	}
+
+	fmt.Printf("\n--- NEW PACKAGE POLICY (%d of %d below %g%%) ---\n", len(failing), checked, newPackageMin)
+	fmt.Printf("Packages added since %s need %g%% coverage:\n", newSince, newPackageMin)
+	for _, stats := range failing {
+		fmt.Printf("  %-50s %6.1f%%\n", localPath(stats.Package), stats.Percent())
+	}
+	fmt.Println("------------------------------")
+	return withExitCode(exitCoverage, fmt.Errorf("%d new package(s) below %g%% coverage", len(failing), newPackageMin))
+}
+
+// policyBase resolves the policy's starting point to a commit: a date
+// means the last commit before it, anything else is a git ref. An empty
+// result means the repository is younger than the date.
+func policyBase(since string) (string, error) {
+	if _, err := time.Parse("2006-01-02", since); err == nil {
+		return gitOutput("rev-list", "-1", "--before="+since+"T00:00:00", "HEAD")
+	}
+	commit, err := gitOutput("rev-parse", "--verify", "--quiet", since+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("unknown git ref %q", since)
+	}
+	return commit, nil
+}
+
+// packageDirsAt returns the directories, relative to the repository root,
+// that contained Go files at commit; without a commit there are none
+func packageDirsAt(commit string) (map[string]bool, error) {
+	dirs := make(map[string]bool)
+	if commit == "" {
+		return dirs, nil
+	}
+	out, err := gitOutput("ls-tree", "-r", "--name-only", "--full-tree", commit)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range strings.Split(out, "\n") {
+		if strings.HasSuffix(file, ".go") {
+			dirs[filepath.ToSlash(filepath.Dir(file))] = true
+		}
+	}
+	return dirs, nil
+}
+
+// gitOutput runs git and returns its trimmed output
+func gitOutput(args ...string) (string, error) {
+	out, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w", args[0], commandError(err))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Hoofffman/gotest/pkg/runner"
+)
+
+// onelineOutput replaces the output of a run with a single result line
+// (--oneline)
+var onelineOutput bool
+
+// oneline holds what the result line reports, collected as the run goes
+var oneline struct {
+	stdout   *os.File
+	started  time.Time
+	result   *runner.Result
+	coverage *float64
+}
+
+// startOneline silences stdout for the rest of the run; warnings still go
+// to stderr
+func startOneline() {
+	oneline.stdout, oneline.started = os.Stdout, time.Now()
+	if devnull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0); err == nil {
+		os.Stdout = devnull
+	}
+}
+
+// printOneline prints the result line of a run that ended with err, e.g.
+// "gotest: FAIL tests=412 failed=3 skipped=7 coverage=81.4% duration=92s".
+// Packages that don't build are added as build_failed=n.
+func printOneline(err error) {
+	status := "PASS"
+	if err != nil {
+		status = "FAIL"
+	}
+	var tests, failed, skipped, broken int
+	if oneline.result != nil {
+		for _, pkg := range oneline.result.Packages {
+			if pkg.Status == runner.StatusBuildFailed {
+				broken++
+			}
+			tests += len(pkg.Tests)
+			for _, t := range pkg.Tests {
+				switch t.Status {
+				case runner.TestFailed:
+					failed++
+				case runner.TestSkipped:
+					skipped++
+				}
+			}
+		}
+	}
+	coverage := "-"
+	if oneline.coverage != nil {
+		coverage = fmt.Sprintf("%.1f%%", *oneline.coverage)
+	}
+	line := fmt.Sprintf("gotest: %s tests=%d failed=%d skipped=%d coverage=%s", status, tests, failed, skipped, coverage)
+	if broken > 0 {
+		line += fmt.Sprintf(" build_failed=%d", broken)
+	}
+	duration := time.Since(oneline.started).Round(100 * time.Millisecond)
+	fmt.Fprintf(oneline.stdout, "%s duration=%gs\n", line, duration.Seconds())
+}
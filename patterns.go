@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// filterPatterns keeps the packages matching any of the package patterns
+// given on the command line and any of the --only patterns. Packages are
+// relative to dir, which is "" for the current directory.
+func filterPatterns(packages []string, dir string) []string {
+	if len(pkgPatterns) == 0 && len(onlyPatterns) == 0 {
+		return packages
+	}
+
+	var matched []string
+	for _, pkg := range packages {
+		full := path.Join(dir, pkg)
+		switch {
+		case !matchesAny(full):
+			debugf("skipping %s: doesn't match the package patterns %s", full, strings.Join(pkgPatterns, " "))
+		case !matchesOnly(full):
+			debugf("skipping %s: doesn't match an --only pattern", full)
+		default:
+			matched = append(matched, pkg)
+		}
+	}
+	return matched
+}
+
+// matchesAny reports whether pkg matches a command-line package pattern
+func matchesAny(pkg string) bool {
+	if len(pkgPatterns) == 0 {
+		return true
+	}
+	for _, pattern := range pkgPatterns {
+		if matchPattern(pattern, pkg) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesOnly reports whether pkg matches one of the --only patterns
+func matchesOnly(pkg string) bool {
+	if len(onlyPatterns) == 0 {
+		return true
+	}
+	for _, pattern := range onlyPatterns {
+		if pattern.Match(pkg) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPattern reports whether the package directory pkg matches a relative
+// package pattern such as "./cmd/api" or "./internal/..."
+func matchPattern(pattern, pkg string) bool {
+	pattern = path.Clean(pattern)
+	pkg = path.Clean(pkg)
+
+	if pattern == "..." {
+		return true
+	}
+	if base, ok := strings.CutSuffix(pattern, "/..."); ok {
+		return base == "." || pkg == base || strings.HasPrefix(pkg, base+"/")
+	}
+	return pkg == pattern
+}
+
+// readPackageList reads a newline-separated list of packages from a file, or
+// from stdin if name is "-". Entries may be package directories, patterns or
+// Go file paths (which select the file's package), so the output of
+// "git diff --name-only" can be piped in directly. Other files are skipped.
+func readPackageList(name string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	var list []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		entry = filepath.ToSlash(entry)
+		if strings.HasSuffix(entry, ".go") {
+			entry = path.Dir(entry)
+		} else if path.Ext(entry) != "" && !strings.HasSuffix(entry, "...") {
+			continue
+		}
+		entry = "./" + path.Clean(entry)
+		if !seen[entry] {
+			seen[entry] = true
+			list = append(list, entry)
+		}
+	}
+
+	return list, scanner.Err()
+}
@@ -0,0 +1,434 @@
+// Package coverprofile parses, merges and summarizes Go coverage profiles
+// as written by go test -coverprofile.
+package coverprofile
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+)
+
+// Block is one basic block of a profile: a source range, its number of
+// statements and how often it was executed
+type Block struct {
+	File      string
+	StartLine int
+	StartCol  int
+	EndLine   int
+	EndCol    int
+	NumStmt   int
+	Count     int
+}
+
+// Key identifies the block's source range independent of its count
+func (b Block) Key() string {
+	return fmt.Sprintf("%s:%d.%d,%d.%d", b.File, b.StartLine, b.StartCol, b.EndLine, b.EndCol)
+}
+
+// Package returns the import path (or directory) of the block's file
+func (b Block) Package() string {
+	return path.Dir(b.File)
+}
+
+// Profile is a coverage profile. Blocks are unique and kept in the order
+// they first appeared.
+type Profile struct {
+	Mode   string
+	Blocks []Block
+}
+
+// maxLine bounds a single profile line; real lines are short, so a longer
+// one means the input isn't a profile
+const maxLine = 64 << 20
+
+// Parse reads a profile. A block listed more than once, as happens when
+// several test binaries cover the same package, is merged by Merge's rules.
+// Blocks are merged as they are read, so memory use is bounded by the
+// number of distinct blocks rather than the size of the input, and lines
+// may be of any length. Parsing stops early if ctx is canceled.
+//
+// A line that is neither a mode line nor a block, or a block before the
+// first mode line, fails the whole parse with an error naming the line,
+// since skipping it would make the coverage silently wrong. Validate
+// counts such lines instead.
+func Parse(ctx context.Context, r io.Reader) (*Profile, error) {
+	p := &Profile{}
+	index := make(map[blockRange]int)
+	// Blocks of the same file share one copy of its name
+	files := make(map[string]string)
+
+	err := readLines(ctx, r, func(num int, text []byte) error {
+		if m, ok := bytes.CutPrefix(text, []byte("mode:")); ok {
+			// Concatenated profiles have a mode line each
+			p.setMode(MergedMode(p.Mode, string(bytes.TrimSpace(m))))
+			return nil
+		}
+		if p.Mode == "" {
+			return fmt.Errorf("missing mode line")
+		}
+		block, err := parseBlock(text, files)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", num, err)
+		}
+		p.merge(index, block)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// readLines calls fn with every non-empty line of r, trimmed, until fn
+// returns an error
+func readLines(ctx context.Context, r io.Reader, fn func(num int, text []byte) error) error {
+	br := bufio.NewReaderSize(r, 256<<10)
+	var long []byte
+	for num := 1; ; num++ {
+		if num%4096 == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+
+		line, err := br.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			// Rare: a line longer than the buffer is assembled in long
+			long = append(long[:0], line...)
+			for err == bufio.ErrBufferFull {
+				if len(long) > maxLine {
+					return fmt.Errorf("line %d: longer than %d MB", num, maxLine>>20)
+				}
+				line, err = br.ReadSlice('\n')
+				long = append(long, line...)
+			}
+			line = long
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		if text := bytes.TrimSpace(line); len(text) > 0 {
+			if ferr := fn(num, text); ferr != nil {
+				return ferr
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// ParseFile reads the profile at path
+func ParseFile(ctx context.Context, path string) (*Profile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	p, err := Parse(ctx, file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// parseBlock parses "file:startLine.startCol,endLine.endCol numStmt count".
+// The file name is interned in files.
+func parseBlock(line []byte, files map[string]string) (Block, error) {
+	var b Block
+	colon := bytes.LastIndexByte(line, ':')
+	if colon == -1 {
+		return b, fmt.Errorf("malformed block %q", line)
+	}
+
+	rest := line[colon+1:]
+	var ok bool
+	if b.StartLine, rest, ok = cutInt(rest, '.'); !ok {
+		return b, fmt.Errorf("malformed range in %q", line)
+	}
+	if b.StartCol, rest, ok = cutInt(rest, ','); !ok {
+		return b, fmt.Errorf("malformed range in %q", line)
+	}
+	if b.EndLine, rest, ok = cutInt(rest, '.'); !ok {
+		return b, fmt.Errorf("malformed range in %q", line)
+	}
+	if b.EndCol, rest, ok = cutInt(rest, ' '); !ok {
+		return b, fmt.Errorf("malformed range in %q", line)
+	}
+	if b.NumStmt, rest, ok = cutInt(bytes.TrimLeft(rest, " \t"), ' '); !ok {
+		return b, fmt.Errorf("malformed statement count in %q", line)
+	}
+	if b.Count, _, ok = cutInt(bytes.TrimLeft(rest, " \t"), 0); !ok {
+		return b, fmt.Errorf("malformed count in %q", line)
+	}
+
+	file, seen := files[string(line[:colon])]
+	if !seen {
+		file = string(line[:colon])
+		files[file] = file
+	}
+	b.File = file
+	return b, nil
+}
+
+// cutInt parses the non-negative decimal number at the start of s, which
+// must be followed by sep, or make up the rest of s if sep is 0. It returns
+// the remainder of s after sep.
+func cutInt(s []byte, sep byte) (int, []byte, bool) {
+	n, i := 0, 0
+	for ; i < len(s) && s[i] >= '0' && s[i] <= '9'; i++ {
+		if n > (math.MaxInt-9)/10 {
+			return 0, nil, false
+		}
+		n = n*10 + int(s[i]-'0')
+	}
+	if i == 0 {
+		return 0, nil, false
+	}
+	if sep == 0 {
+		return n, nil, i == len(s)
+	}
+	if i == len(s) || s[i] != sep {
+		return 0, nil, false
+	}
+	return n, s[i+1:], true
+}
+
+// blockRange identifies a block by its source range
+type blockRange struct {
+	file                                 string
+	startLine, startCol, endLine, endCol int
+}
+
+func (b Block) rng() blockRange {
+	return blockRange{b.File, b.StartLine, b.StartCol, b.EndLine, b.EndCol}
+}
+
+// add merges blocks into the profile
+func (p *Profile) add(blocks []Block) {
+	index := make(map[blockRange]int, len(p.Blocks))
+	for i, b := range p.Blocks {
+		index[b.rng()] = i
+	}
+	for _, b := range blocks {
+		p.merge(index, b)
+	}
+}
+
+// merge adds one block, given the index of the profile's blocks by range.
+// Counts for the same block are summed in count/atomic mode; in set mode a
+// block is covered if any copy was.
+func (p *Profile) merge(index map[blockRange]int, b Block) {
+	if p.Mode == "set" && b.Count > 0 {
+		b.Count = 1
+	}
+	i, seen := index[b.rng()]
+	if !seen {
+		index[b.rng()] = len(p.Blocks)
+		p.Blocks = append(p.Blocks, b)
+		return
+	}
+	if p.Mode == "set" {
+		p.Blocks[i].Count = max(p.Blocks[i].Count, b.Count)
+	} else {
+		p.Blocks[i].Count += b.Count
+	}
+}
+
+// MergedMode returns the mode of profiles in the given modes merged into
+// one. Counts only add up in the same mode, so differing modes are merged in
+// the mode that promises the least: set if any profile is in set mode, as
+// counts then only tell whether a block ran, and otherwise count, as count
+// mode may undercount concurrent code where atomic doesn't. Empty modes
+// are ignored.
+func MergedMode(modes ...string) string {
+	merged := ""
+	for _, mode := range modes {
+		switch {
+		case mode == "" || mode == merged:
+		case merged == "":
+			merged = mode
+		case mode == "set" || merged == "set":
+			merged = "set"
+		default:
+			merged = "count"
+		}
+	}
+	return merged
+}
+
+// setMode changes the mode of the profile, reducing the counts to 0 or 1
+// in set mode
+func (p *Profile) setMode(mode string) {
+	if mode == "set" && p.Mode != "set" {
+		for i := range p.Blocks {
+			p.Blocks[i].Count = min(p.Blocks[i].Count, 1)
+		}
+	}
+	p.Mode = mode
+}
+
+// Merge combines profiles into one, in the mode MergedMode returns for
+// theirs; without any, the result is in atomic mode.
+func Merge(profiles ...*Profile) *Profile {
+	merged := &Profile{}
+	for _, p := range profiles {
+		merged.Mode = MergedMode(merged.Mode, p.Mode)
+	}
+	if merged.Mode == "" {
+		merged.Mode = "atomic"
+	}
+	for _, p := range profiles {
+		merged.add(p.Blocks)
+	}
+	return merged
+}
+
+// MergeFiles merges the profiles at paths and writes the result to out
+func MergeFiles(ctx context.Context, paths []string, out string) error {
+	var profiles []*Profile
+	for _, path := range paths {
+		p, err := ParseFile(ctx, path)
+		if err != nil {
+			return err
+		}
+		profiles = append(profiles, p)
+	}
+	return Merge(profiles...).WriteFile(out)
+}
+
+// Write writes the profile in go test's format
+func (p *Profile) Write(w io.Writer) error {
+	bw := bufio.NewWriterSize(w, 256<<10)
+	fmt.Fprintf(bw, "mode: %s\n", p.Mode)
+	var line []byte
+	for _, b := range p.Blocks {
+		line = append(line[:0], b.File...)
+		line = append(line, ':')
+		line = strconv.AppendInt(line, int64(b.StartLine), 10)
+		line = append(line, '.')
+		line = strconv.AppendInt(line, int64(b.StartCol), 10)
+		line = append(line, ',')
+		line = strconv.AppendInt(line, int64(b.EndLine), 10)
+		line = append(line, '.')
+		line = strconv.AppendInt(line, int64(b.EndCol), 10)
+		line = append(line, ' ')
+		line = strconv.AppendInt(line, int64(b.NumStmt), 10)
+		line = append(line, ' ')
+		line = strconv.AppendInt(line, int64(b.Count), 10)
+		line = append(line, '\n')
+		if _, err := bw.Write(line); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteFile writes the profile to path
+func (p *Profile) WriteFile(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := p.Write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// PackageStats is the statement coverage of one package, or of a whole
+// profile when Package is empty
+type PackageStats struct {
+	Package    string
+	Statements int
+	Covered    int
+}
+
+// Percent returns the covered share of statements, 0 if there are none
+func (s PackageStats) Percent() float64 {
+	if s.Statements == 0 {
+		return 0
+	}
+	return float64(s.Covered) / float64(s.Statements) * 100
+}
+
+// Packages returns the coverage of each package, sorted by package
+func (p *Profile) Packages() []PackageStats {
+	byPkg := make(map[string]*PackageStats)
+	for _, b := range p.Blocks {
+		pkg := b.Package()
+		stats := byPkg[pkg]
+		if stats == nil {
+			stats = &PackageStats{Package: pkg}
+			byPkg[pkg] = stats
+		}
+		stats.Statements += b.NumStmt
+		if b.Count > 0 {
+			stats.Covered += b.NumStmt
+		}
+	}
+
+	packages := make([]PackageStats, 0, len(byPkg))
+	for _, stats := range byPkg {
+		packages = append(packages, *stats)
+	}
+	sort.Slice(packages, func(i, j int) bool { return packages[i].Package < packages[j].Package })
+	return packages
+}
+
+// Total returns the coverage of the whole profile
+func (p *Profile) Total() PackageStats {
+	var total PackageStats
+	for _, b := range p.Blocks {
+		total.Statements += b.NumStmt
+		if b.Count > 0 {
+			total.Covered += b.NumStmt
+		}
+	}
+	return total
+}
+
+// PackageDiff compares the coverage of a package between two profiles.
+// Base or Head has zero statements if the package is missing on that side.
+type PackageDiff struct {
+	Package string
+	Base    PackageStats
+	Head    PackageStats
+}
+
+// Delta returns the change in coverage, in percentage points
+func (d PackageDiff) Delta() float64 {
+	return d.Head.Percent() - d.Base.Percent()
+}
+
+// Diff compares per-package coverage of base and head, sorted by package
+func Diff(base, head *Profile) []PackageDiff {
+	byPkg := make(map[string]*PackageDiff)
+	for _, stats := range base.Packages() {
+		byPkg[stats.Package] = &PackageDiff{Package: stats.Package, Base: stats}
+	}
+	for _, stats := range head.Packages() {
+		if d, ok := byPkg[stats.Package]; ok {
+			d.Head = stats
+		} else {
+			byPkg[stats.Package] = &PackageDiff{Package: stats.Package, Head: stats}
+		}
+	}
+
+	diffs := make([]PackageDiff, 0, len(byPkg))
+	for _, d := range byPkg {
+		diffs = append(diffs, *d)
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Package < diffs[j].Package })
+	return diffs
+}
@@ -0,0 +1,179 @@
+package coverprofile
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, s string) *Profile {
+	t.Helper()
+	p, err := Parse(context.Background(), strings.NewReader(s))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return p
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want *Profile
+	}{
+		{
+			name: "blocks",
+			in:   "mode: set\na/b.go:1.2,3.4 2 1\na/b.go:5.1,6.2 1 0\n",
+			want: &Profile{Mode: "set", Blocks: []Block{
+				{File: "a/b.go", StartLine: 1, StartCol: 2, EndLine: 3, EndCol: 4, NumStmt: 2, Count: 1},
+				{File: "a/b.go", StartLine: 5, StartCol: 1, EndLine: 6, EndCol: 2, NumStmt: 1, Count: 0},
+			}},
+		},
+		{
+			name: "duplicates summed in count mode",
+			in:   "mode: count\na/b.go:1.2,3.4 2 3\na/b.go:1.2,3.4 2 4\n",
+			want: &Profile{Mode: "count", Blocks: []Block{
+				{File: "a/b.go", StartLine: 1, StartCol: 2, EndLine: 3, EndCol: 4, NumStmt: 2, Count: 7},
+			}},
+		},
+		{
+			name: "duplicates covered once in set mode",
+			in:   "mode: set\na/b.go:1.2,3.4 2 0\na/b.go:1.2,3.4 2 1\na/b.go:1.2,3.4 2 1\n",
+			want: &Profile{Mode: "set", Blocks: []Block{
+				{File: "a/b.go", StartLine: 1, StartCol: 2, EndLine: 3, EndCol: 4, NumStmt: 2, Count: 1},
+			}},
+		},
+		{
+			name: "concatenated profiles in different modes",
+			in:   "mode: atomic\na/b.go:1.2,3.4 2 5\nmode: set\na/b.go:1.2,3.4 2 1\n",
+			want: &Profile{Mode: "set", Blocks: []Block{
+				{File: "a/b.go", StartLine: 1, StartCol: 2, EndLine: 3, EndCol: 4, NumStmt: 2, Count: 1},
+			}},
+		},
+		{
+			name: "windows line endings and blank lines",
+			in:   "mode: set\r\n\r\nC:/x/b.go:1.2,3.4 2 1\r\n",
+			want: &Profile{Mode: "set", Blocks: []Block{
+				{File: "C:/x/b.go", StartLine: 1, StartCol: 2, EndLine: 3, EndCol: 4, NumStmt: 2, Count: 1},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parse(t, tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"no mode", "a/b.go:1.2,3.4 2 1\n", "missing mode line"},
+		{"no colon", "mode: set\nbogus\n", "line 2: malformed block"},
+		{"bad range", "mode: set\na/b.go:1.2-3.4 2 1\n", "line 2: malformed range"},
+		{"bad statements", "mode: set\na/b.go:1.2,3.4 x 1\n", "line 2: malformed statement count"},
+		{"bad count", "mode: set\na/b.go:1.2,3.4 2 -1\n", "line 2: malformed count"},
+		{"trailing text", "mode: set\na/b.go:1.2,3.4 2 1 extra\n", "line 2: malformed count"},
+		// One bad line fails the parse, however many good ones surround it
+		{"bad line among blocks", "mode: set\na/b.go:1.2,3.4 2 1\n<html>\na/b.go:5.1,6.2 1 0\n", `line 3: malformed block "<html>"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(context.Background(), strings.NewReader(tt.in))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergedMode(t *testing.T) {
+	tests := []struct {
+		modes []string
+		want  string
+	}{
+		{nil, ""},
+		{[]string{"atomic"}, "atomic"},
+		{[]string{"", "count", ""}, "count"},
+		{[]string{"atomic", "atomic"}, "atomic"},
+		{[]string{"atomic", "count"}, "count"},
+		{[]string{"count", "set", "atomic"}, "set"},
+	}
+	for _, tt := range tests {
+		if got := MergedMode(tt.modes...); got != tt.want {
+			t.Errorf("MergedMode(%q) = %q, want %q", tt.modes, got, tt.want)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name     string
+		profiles []string
+		want     string
+	}{
+		{
+			name:     "none",
+			profiles: nil,
+			want:     "mode: atomic\n",
+		},
+		{
+			name: "counts summed, blocks kept in order",
+			profiles: []string{
+				"mode: atomic\na/x.go:1.1,2.1 1 2\na/x.go:3.1,4.1 1 0\n",
+				"mode: atomic\nb/y.go:1.1,2.1 3 1\na/x.go:3.1,4.1 1 5\n",
+			},
+			want: "mode: atomic\na/x.go:1.1,2.1 1 2\na/x.go:3.1,4.1 1 5\nb/y.go:1.1,2.1 3 1\n",
+		},
+		{
+			name: "set wins over counts",
+			profiles: []string{
+				"mode: count\na/x.go:1.1,2.1 1 7\na/x.go:3.1,4.1 1 0\n",
+				"mode: set\na/x.go:3.1,4.1 1 1\n",
+			},
+			want: "mode: set\na/x.go:1.1,2.1 1 1\na/x.go:3.1,4.1 1 1\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var profiles []*Profile
+			for _, s := range tt.profiles {
+				profiles = append(profiles, parse(t, s))
+			}
+			var buf bytes.Buffer
+			if err := Merge(profiles...).Write(&buf); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("Merge wrote\n%s\nwant\n%s", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestStats(t *testing.T) {
+	p := parse(t, "mode: set\na/x.go:1.1,2.1 3 1\na/x.go:3.1,4.1 1 0\nb/y.go:1.1,2.1 2 0\n")
+	want := []PackageStats{{Package: "a", Statements: 4, Covered: 3}, {Package: "b", Statements: 2}}
+	if got := p.Packages(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Packages = %+v, want %+v", got, want)
+	}
+	if got := p.Total(); got != (PackageStats{Statements: 6, Covered: 3}) || got.Percent() != 50 {
+		t.Errorf("Total = %+v (%.1f%%), want 3/6 (50%%)", got, got.Percent())
+	}
+	if got := (PackageStats{}).Percent(); got != 0 {
+		t.Errorf("Percent of no statements = %v, want 0", got)
+	}
+
+	head := parse(t, "mode: set\na/x.go:1.1,2.1 3 1\na/x.go:3.1,4.1 1 1\nc/z.go:1.1,2.1 1 1\n")
+	diffs := Diff(p, head)
+	if len(diffs) != 3 || diffs[0].Delta() != 25 || diffs[1].Head.Statements != 0 || diffs[2].Base.Statements != 0 {
+		t.Errorf("Diff = %+v, want a +25%%, b removed, c added", diffs)
+	}
+}
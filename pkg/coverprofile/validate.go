@@ -0,0 +1,138 @@
+package coverprofile
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// maxExamples is how many malformed lines Problems keeps as examples
+const maxExamples = 3
+
+// Problems are the inconsistencies Validate finds in a profile. Blocks that
+// are simply listed more than once are not a problem: go test writes every
+// block once per test binary that covers it.
+type Problems struct {
+	// Modes lists the distinct modes of the mode lines, in order
+	Modes []string
+	// MissingMode is set if a block comes before the first mode line
+	MissingMode bool
+	// Malformed counts the lines that are neither a mode line nor a block;
+	// the first ones are kept in Examples
+	Malformed int
+	Examples  []string
+	// Conflicts counts blocks listed again with another number of
+	// statements
+	Conflicts int
+	// Overlaps counts blocks that overlap another block of their file, as
+	// when profiles of different versions of the source are combined
+	Overlaps int
+}
+
+// OK reports whether no problems were found
+func (p Problems) OK() bool {
+	return len(p.Modes) <= 1 && !p.MissingMode && p.Malformed == 0 && p.Conflicts == 0 && p.Overlaps == 0
+}
+
+// String summarizes the problems, e.g. "2 malformed line(s), 1 overlapping
+// block(s)"
+func (p Problems) String() string {
+	var parts []string
+	if p.MissingMode {
+		parts = append(parts, "missing mode line")
+	}
+	if len(p.Modes) > 1 {
+		parts = append(parts, "mixed modes "+strings.Join(p.Modes, ", "))
+	}
+	if p.Malformed > 0 {
+		parts = append(parts, fmt.Sprintf("%d malformed line(s)", p.Malformed))
+	}
+	if p.Conflicts > 0 {
+		parts = append(parts, fmt.Sprintf("%d block(s) with conflicting statement counts", p.Conflicts))
+	}
+	if p.Overlaps > 0 {
+		parts = append(parts, fmt.Sprintf("%d overlapping block(s)", p.Overlaps))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Validate checks every line of a profile, counting the problems that make
+// Parse fail or that it merges without a word
+func Validate(ctx context.Context, r io.Reader) (Problems, error) {
+	var p Problems
+	numStmts := make(map[blockRange]int)
+	files := make(map[string]string)
+	err := readLines(ctx, r, func(num int, text []byte) error {
+		if m, ok := bytes.CutPrefix(text, []byte("mode:")); ok {
+			mode := string(bytes.TrimSpace(m))
+			if !slices.Contains(p.Modes, mode) {
+				p.Modes = append(p.Modes, mode)
+			}
+			return nil
+		}
+		if len(p.Modes) == 0 {
+			p.MissingMode = true
+		}
+		b, err := parseBlock(text, files)
+		if err != nil {
+			p.Malformed++
+			if len(p.Examples) < maxExamples {
+				p.Examples = append(p.Examples, fmt.Sprintf("line %d: %v", num, err))
+			}
+			return nil
+		}
+		if n, seen := numStmts[b.rng()]; !seen {
+			numStmts[b.rng()] = b.NumStmt
+		} else if n != b.NumStmt {
+			p.Conflicts++
+		}
+		return nil
+	})
+	if err != nil {
+		return p, err
+	}
+	p.Overlaps = countOverlaps(numStmts)
+	return p, nil
+}
+
+// ValidateFile validates the profile at path
+func ValidateFile(ctx context.Context, path string) (Problems, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Problems{}, err
+	}
+	defer file.Close()
+	return Validate(ctx, file)
+}
+
+// countOverlaps counts the blocks that start inside the previous block of
+// their file, by start position
+func countOverlaps(blocks map[blockRange]int) int {
+	ranges := make([]blockRange, 0, len(blocks))
+	for r := range blocks {
+		ranges = append(ranges, r)
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		a, b := ranges[i], ranges[j]
+		if a.file != b.file {
+			return a.file < b.file
+		}
+		if a.startLine != b.startLine {
+			return a.startLine < b.startLine
+		}
+		return a.startCol < b.startCol
+	})
+	overlaps := 0
+	for i := 1; i < len(ranges); i++ {
+		prev, cur := ranges[i-1], ranges[i]
+		if prev.file == cur.file && (cur.startLine < prev.endLine || cur.startLine == prev.endLine && cur.startCol < prev.endCol) {
+			overlaps++
+		}
+	}
+	return overlaps
+}
@@ -0,0 +1,344 @@
+// Package discover finds the Go packages and nested modules below a
+// directory the way the gotest command does, honoring ignore patterns,
+// .gotestignore rules, build tags and, optionally, symlinked directories.
+package discover
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Options configures discovery
+type Options struct {
+	// Root is the directory to search; empty means the current directory
+	Root string
+	// Tags are build tags (comma-separated) applied when listing packages
+	Tags string
+	// Ignore excludes directories matching any pattern; Rules are
+	// gitignore-style rules as loaded from a .gotestignore file
+	Ignore []Pattern
+	Rules  IgnoreRules
+	// Submodules also discovers the packages of nested modules, which are
+	// otherwise skipped since they can't be tested from the root module
+	Submodules bool
+	// FollowSymlinks also finds packages reachable through symlinked
+	// directories
+	FollowSymlinks bool
+
+	// Go is the go command used for listing; defaults to "go"
+	Go string
+	// Env is the environment of go list; nil means the current environment
+	Env []string
+	// Warnings, if set, receives non-fatal problems such as go list
+	// failing before the directory walk fallback
+	Warnings io.Writer
+	// Debug, if set, receives the discovery decisions: the go list command,
+	// and every directory that is skipped and why
+	Debug io.Writer
+}
+
+// Package is a discovered package directory
+type Package struct {
+	// Path is the directory relative to Root in "./dir" form, as accepted
+	// by go test
+	Path string
+	// Dir is the absolute directory
+	Dir string
+	// HasTests reports whether the package has any _test.go files
+	HasTests bool
+	// Module is the directory of the package's module relative to Root:
+	// "." for the root module, "./dir" for a nested module
+	Module string
+}
+
+// Ignored reports whether a directory relative to the root is excluded by
+// the ignore patterns or rules
+func (opts *Options) Ignored(dir string) bool {
+	return opts.ignoreReason(dir) != ""
+}
+
+// ignoreReason describes the pattern or rule that excludes a directory, or
+// returns "" if it isn't excluded
+func (opts *Options) ignoreReason(dir string) string {
+	if rule, ok := opts.Rules.matchingRule(dir); ok {
+		return fmt.Sprintf("matches %s rule %q", IgnoreFileName, rule)
+	}
+	for _, pattern := range opts.Ignore {
+		if pattern.Match(dir) {
+			return fmt.Sprintf("matches ignore pattern %q", pattern)
+		}
+	}
+	return ""
+}
+
+// skipIgnored reports whether a directory is excluded, logging why
+func (opts *Options) skipIgnored(dir string) bool {
+	reason := opts.ignoreReason(dir)
+	if reason != "" {
+		opts.debugf("skipping %s: %s", packagePath(dir), reason)
+	}
+	return reason != ""
+}
+
+func (opts *Options) warnf(format string, args ...any) {
+	if opts.Warnings != nil {
+		fmt.Fprintf(opts.Warnings, "Warning: "+format+"\n", args...)
+	}
+}
+
+func (opts *Options) debugf(format string, args ...any) {
+	if opts.Debug != nil {
+		fmt.Fprintf(opts.Debug, "debug: "+format+"\n", args...)
+	}
+}
+
+// Packages finds all packages below the root using go list, which respects
+// build constraints and module boundaries. If go list fails (e.g. outside a
+// module), it falls back to walking the directory tree. Canceling ctx stops
+// both.
+func Packages(ctx context.Context, opts Options) ([]Package, error) {
+	if opts.Root == "" {
+		opts.Root = "."
+	}
+	if opts.Go == "" {
+		opts.Go = "go"
+	}
+
+	packages, err := modulePackages(ctx, &opts, opts.Root, ".")
+	if err != nil || !opts.Submodules {
+		return packages, err
+	}
+
+	modules, err := Modules(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, module := range modules {
+		sub := opts
+		sub.Root = filepath.Join(opts.Root, module)
+		found, err := modulePackages(ctx, &sub, sub.Root, module)
+		if err != nil {
+			return nil, err
+		}
+		for _, pkg := range found {
+			pkg.Path = module + strings.TrimPrefix(pkg.Path, ".")
+			packages = append(packages, pkg)
+		}
+	}
+	return packages, nil
+}
+
+// modulePackages finds the packages of the module rooted at root
+func modulePackages(ctx context.Context, opts *Options, root, module string) ([]Package, error) {
+	packages, err := listPackages(ctx, opts, root)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		opts.warnf("go list failed, falling back to directory walk: %v", err)
+		packages, err = walkPackages(ctx, opts, root)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Neither go list nor the walker descend into symlinked directories
+	if opts.FollowSymlinks {
+		linked, err := symlinkedPackages(ctx, opts, root)
+		if err != nil {
+			return nil, err
+		}
+		seen := make(map[string]bool)
+		for _, pkg := range packages {
+			seen[pkg.Path] = true
+		}
+		for _, pkg := range linked {
+			if !seen[pkg.Path] {
+				seen[pkg.Path] = true
+				packages = append(packages, pkg)
+			}
+		}
+	}
+
+	for i := range packages {
+		packages[i].Module = module
+	}
+	return packages, nil
+}
+
+// listPackages discovers packages with "go list ./..."
+func listPackages(ctx context.Context, opts *Options, root string) ([]Package, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"list", "-f", "{{.Dir}}\t{{if or .TestGoFiles .XTestGoFiles}}tests{{end}}"}
+	if opts.Tags != "" {
+		args = append(args, "-tags="+opts.Tags)
+	}
+	args = append(args, "./...")
+	opts.debugf("listing packages in %s: %s %s", root, opts.Go, strings.Join(args, " "))
+
+	cmd := exec.CommandContext(ctx, opts.Go, args...)
+	cmd.Dir = root
+	cmd.Env = opts.Env
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s", msg)
+		}
+		return nil, err
+	}
+
+	var packages []Package
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		dir, tests, _ := strings.Cut(line, "\t")
+		if dir == "" {
+			continue
+		}
+		rel, err := filepath.Rel(absRoot, dir)
+		if err != nil {
+			return nil, err
+		}
+		if opts.skipIgnored(rel) {
+			continue
+		}
+		if tests == "" {
+			opts.debugf("found %s (no test files)", packagePath(rel))
+		} else {
+			opts.debugf("found %s", packagePath(rel))
+		}
+		packages = append(packages, Package{Path: packagePath(rel), Dir: dir, HasTests: tests != ""})
+	}
+
+	return packages, nil
+}
+
+// walkPackages finds all directories containing .go files
+func walkPackages(ctx context.Context, opts *Options, root string) ([]Package, error) {
+	var packages []Package
+	index := make(map[string]int)
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		// Skip hidden directories and common non-source directories
+		if info.IsDir() {
+			name := info.Name()
+			// Skip hidden dirs (but not "." which is the root), vendor, and testdata
+			if (strings.HasPrefix(name, ".") && name != ".") || name == "vendor" || name == "testdata" {
+				opts.debugf("skipping %s: hidden, vendor or testdata directory", packagePath(rel))
+				return filepath.SkipDir
+			}
+
+			// Nested modules can't be tested from this module
+			if path != root && IsModuleRoot(path) {
+				opts.debugf("skipping %s: nested module", packagePath(rel))
+				return filepath.SkipDir
+			}
+
+			// Skip directories matching ignore patterns
+			if opts.skipIgnored(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Check for .go files (including test files)
+		if strings.HasSuffix(path, ".go") {
+			dir := filepath.Dir(rel)
+			i, seen := index[dir]
+			if !seen {
+				abs, err := filepath.Abs(filepath.Dir(path))
+				if err != nil {
+					return err
+				}
+				i = len(packages)
+				index[dir] = i
+				packages = append(packages, Package{Path: packagePath(dir), Dir: abs})
+			}
+			if strings.HasSuffix(path, "_test.go") {
+				packages[i].HasTests = true
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return packages, nil
+}
+
+// IsModuleRoot reports whether dir contains a go.mod file
+func IsModuleRoot(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, "go.mod"))
+	return err == nil
+}
+
+// Modules returns the directories below the root that contain their own
+// go.mod, in the same "./dir" form used for packages
+func Modules(ctx context.Context, opts Options) ([]string, error) {
+	root := opts.Root
+	if root == "" {
+		root = "."
+	}
+	var modules []string
+
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !info.IsDir() || p == root {
+			return nil
+		}
+
+		name := info.Name()
+		if strings.HasPrefix(name, ".") || name == "vendor" || name == "testdata" {
+			return filepath.SkipDir
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if opts.skipIgnored(rel) {
+			return filepath.SkipDir
+		}
+		if IsModuleRoot(p) {
+			opts.debugf("found nested module %s", packagePath(rel))
+			modules = append(modules, packagePath(rel))
+		}
+		return nil
+	})
+
+	return modules, err
+}
+
+// packagePath converts a directory relative to the root to "./dir" form
+func packagePath(rel string) string {
+	return "./" + filepath.ToSlash(rel)
+}
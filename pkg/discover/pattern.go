@@ -0,0 +1,193 @@
+package discover
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IgnoreFileName is the file listing directories to exclude from discovery
+const IgnoreFileName = ".gotestignore"
+
+// ignoreRule is a single gitignore-style pattern from the ignore file
+type ignoreRule struct {
+	pattern  string
+	negate   bool
+	anchored bool
+}
+
+// IgnoreRules are the rules loaded from an ignore file
+type IgnoreRules []ignoreRule
+
+// LoadIgnoreFile reads gitignore-style rules from path. A missing file is
+// not an error.
+func LoadIgnoreFile(path string) (IgnoreRules, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rules IgnoreRules
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		// Only directories are matched, so a trailing slash changes nothing
+		line = strings.TrimSuffix(line, "/")
+		// Like gitignore, a slash anywhere but the end anchors the pattern to the root
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		rule.pattern = line
+		rules = append(rules, rule)
+	}
+
+	return rules, scanner.Err()
+}
+
+// Ignored reports whether a directory (relative to the root) is excluded by
+// the rules. The last matching rule wins, and as in gitignore a directory
+// can't be re-included once a parent is excluded.
+func (rules IgnoreRules) Ignored(dir string) bool {
+	_, ok := rules.matchingRule(dir)
+	return ok
+}
+
+// matchingRule returns the rule that excludes dir
+func (rules IgnoreRules) matchingRule(dir string) (string, bool) {
+	if len(rules) == 0 {
+		return "", false
+	}
+
+	dir = filepath.ToSlash(filepath.Clean(dir))
+	if dir == "." {
+		return "", false
+	}
+
+	parts := strings.Split(dir, "/")
+	for i := range parts {
+		prefix := strings.Join(parts[:i+1], "/")
+		var excluding *ignoreRule
+		for j, rule := range rules {
+			var matched bool
+			if rule.anchored {
+				matched = globMatch(rule.pattern, prefix)
+			} else {
+				matched = globMatch(rule.pattern, parts[i])
+			}
+			if matched {
+				excluding = nil
+				if !rule.negate {
+					excluding = &rules[j]
+				}
+			}
+		}
+		if excluding != nil {
+			return excluding.String(), true
+		}
+	}
+	return "", false
+}
+
+// String returns the rule in gitignore form
+func (r ignoreRule) String() string {
+	s := r.pattern
+	if r.anchored {
+		s = "/" + s
+	}
+	return s
+}
+
+// Pattern is a pattern given with -i or --only. Patterns prefixed with "re:"
+// are regular expressions, patterns containing glob metacharacters are
+// globs matched against the whole path, and anything else is a substring.
+type Pattern struct {
+	raw  string
+	re   *regexp.Regexp
+	glob bool
+}
+
+// ParsePattern parses a single -i or --only pattern
+func ParsePattern(raw string) (Pattern, error) {
+	if expr, ok := strings.CutPrefix(raw, "re:"); ok {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return Pattern{}, fmt.Errorf("invalid regexp %q: %w", expr, err)
+		}
+		return Pattern{raw: raw, re: re}, nil
+	}
+	if strings.ContainsAny(raw, "*?[") {
+		if _, err := path.Match(raw, ""); err != nil {
+			return Pattern{}, fmt.Errorf("invalid glob %q: %w", raw, err)
+		}
+		return Pattern{raw: raw, glob: true}, nil
+	}
+	return Pattern{raw: raw}, nil
+}
+
+// Match reports whether the pattern matches a package directory
+func (p Pattern) Match(dir string) bool {
+	clean := filepath.ToSlash(filepath.Clean(dir))
+	switch {
+	case p.re != nil:
+		return p.re.MatchString(clean)
+	case p.glob:
+		return globMatch(strings.TrimPrefix(p.raw, "./"), clean)
+	default:
+		return strings.Contains(dir, p.raw)
+	}
+}
+
+// String returns the pattern as given
+func (p Pattern) String() string {
+	return p.raw
+}
+
+// globMatch matches a slash-separated path against a glob pattern where
+// "**" matches any number of path segments
+func globMatch(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(rest, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,107 @@
+package discover
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// symlinkedPackages finds package directories that are only reachable
+// through symlinked directories below root. A link pointing back to one of
+// its own ancestors is reported and skipped to avoid cycles.
+func symlinkedPackages(ctx context.Context, opts *Options, root string) ([]Package, error) {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var packages []Package
+	seen := make(map[string]bool)
+	ancestors := map[string]bool{realRoot: true}
+
+	var walk func(dir string, viaLink bool) error
+	walk = func(dir string, viaLink bool) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+
+		hasGoFiles, hasTests := false, false
+		for _, entry := range entries {
+			name := entry.Name()
+			full := filepath.Join(dir, name)
+
+			isLink := entry.Type()&os.ModeSymlink != 0
+			isDir := entry.IsDir()
+			if isLink {
+				info, err := os.Stat(full)
+				if err != nil {
+					// Dangling link
+					continue
+				}
+				isDir = info.IsDir()
+			}
+
+			if !isDir {
+				if strings.HasSuffix(name, ".go") {
+					hasGoFiles = true
+					hasTests = hasTests || strings.HasSuffix(name, "_test.go")
+				}
+				continue
+			}
+
+			if strings.HasPrefix(name, ".") || name == "vendor" || name == "testdata" || IsModuleRoot(full) {
+				continue
+			}
+			rel, err := filepath.Rel(root, full)
+			if err != nil {
+				return err
+			}
+			if opts.skipIgnored(rel) {
+				continue
+			}
+
+			real, err := filepath.EvalSymlinks(full)
+			if err != nil {
+				return err
+			}
+			if ancestors[real] {
+				opts.warnf("skipping symlink cycle at %s", full)
+				continue
+			}
+
+			ancestors[real] = true
+			err = walk(full, viaLink || isLink)
+			delete(ancestors, real)
+			if err != nil {
+				return err
+			}
+		}
+
+		if viaLink && hasGoFiles {
+			rel, err := filepath.Rel(root, dir)
+			if err != nil {
+				return err
+			}
+			pkg := packagePath(rel)
+			if !seen[pkg] {
+				seen[pkg] = true
+				abs, err := filepath.Abs(dir)
+				if err != nil {
+					return err
+				}
+				packages = append(packages, Package{Path: pkg, Dir: abs, HasTests: hasTests})
+			}
+		}
+		return nil
+	}
+
+	if err := walk(root, false); err != nil {
+		return nil, err
+	}
+	return packages, nil
+}
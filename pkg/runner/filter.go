@@ -0,0 +1,204 @@
+package runner
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// maxPendingLines caps the output kept for a single running test; when a
+// test logs more before failing, its last lines are kept
+const maxPendingLines = 1000
+
+// outputFilter processes go test output as it is written, without holding
+// all of it in memory: the output of a test is only kept until the test
+// passes or is skipped, so with -v a huge suite needs memory for the tests
+// running at once and the failures, not for everything they logged. Output
+// outside of tests (build errors, package results, panics) is kept. The
+// results are parsed on the way.
+type outputFilter struct {
+	mu      sync.Mutex
+	parser  outputParser
+	partial []byte
+	out     strings.Builder
+
+	running string // test the next line belongs to, "" outside of tests
+	pending map[string]*pendingTest
+	order   []*pendingTest
+}
+
+// pendingTest is the output of a test that hasn't finished yet
+type pendingTest struct {
+	name    string
+	lines   []string
+	dropped int
+	done    bool
+}
+
+func newOutputFilter() *outputFilter {
+	return &outputFilter{pending: make(map[string]*pendingTest)}
+}
+
+// Write takes output in any chunks; stdout and stderr may share a filter
+func (f *outputFilter) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data := append(f.partial, p...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		f.line(string(data[:i]))
+		data = data[i+1:]
+	}
+	f.partial = append(f.partial[:0], data...)
+	return len(p), nil
+}
+
+// finish processes an unterminated last line and keeps the output of tests
+// that never finished, such as the one that timed out
+func (f *outputFilter) finish() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.partial) > 0 {
+		f.line(string(f.partial))
+		f.partial = nil
+	}
+	f.flush(func(*pendingTest) bool { return true })
+}
+
+// output returns the kept output
+func (f *outputFilter) output() string {
+	return f.out.String()
+}
+
+// results returns the package results parsed from all output
+func (f *outputFilter) results() []PackageResult {
+	return f.parser.results
+}
+
+func (f *outputFilter) line(line string) {
+	f.parser.line(line)
+	trimmed := strings.TrimSpace(line)
+
+	if rest, ok := strings.CutPrefix(trimmed, "=== "); ok {
+		fields := strings.Fields(rest)
+		if len(fields) == 2 && (fields[0] == "RUN" || fields[0] == "CONT" || fields[0] == "NAME") {
+			f.running = fields[1]
+			if fields[0] == "RUN" {
+				f.add(fields[1], line)
+			}
+			return
+		}
+		if len(fields) == 2 && fields[0] == "PAUSE" {
+			return
+		}
+	}
+
+	if test, ok := parseTestLine(trimmed); ok {
+		f.running = ""
+		if _, ok := f.pending[parentTest(test.Name)]; ok {
+			f.running = parentTest(test.Name)
+		}
+		inSubtree := func(t *pendingTest) bool { return t.name == test.Name || strings.HasPrefix(t.name, test.Name+"/") }
+		if test.Status == TestFailed {
+			f.flush(inSubtree)
+			f.keep(line)
+			return
+		}
+		// A test that was kept with its failed parent is shown in full
+		if _, running := f.pending[test.Name]; !running {
+			f.keep(line)
+		}
+		f.drop(inSubtree)
+		return
+	}
+
+	if _, ok := parseResultLine(line); ok {
+		f.flush(func(*pendingTest) bool { return true })
+		f.running = ""
+		f.keep(line)
+		return
+	}
+
+	// Compiler output can arrive while tests of another package run
+	if f.running != "" && !isCompilerOutput(line) {
+		f.add(f.running, line)
+		return
+	}
+	f.keep(line)
+}
+
+func (f *outputFilter) keep(line string) {
+	f.out.WriteString(line)
+	f.out.WriteByte('\n')
+}
+
+// add holds a line of a running test until it finishes
+func (f *outputFilter) add(test, line string) {
+	t, ok := f.pending[test]
+	if !ok {
+		t = &pendingTest{name: test}
+		f.pending[test] = t
+		f.order = append(f.order, t)
+	}
+	t.lines = append(t.lines, line)
+	if len(t.lines) > 2*maxPendingLines {
+		t.dropped += len(t.lines) - maxPendingLines
+		t.lines = append([]string(nil), t.lines[len(t.lines)-maxPendingLines:]...)
+	}
+}
+
+// flush keeps the held output of the matching tests, in the order they
+// started
+func (f *outputFilter) flush(match func(*pendingTest) bool) {
+	for _, t := range f.order {
+		if t.done || !match(t) {
+			continue
+		}
+		if t.dropped > 0 {
+			f.keep(fmt.Sprintf("    ... (%d earlier lines of %s not kept)", t.dropped, t.name))
+		}
+		for _, line := range t.lines {
+			f.keep(line)
+		}
+	}
+	f.drop(match)
+}
+
+// drop discards the held output of the matching tests
+func (f *outputFilter) drop(match func(*pendingTest) bool) {
+	for _, t := range f.order {
+		if !t.done && match(t) {
+			t.done, t.lines = true, nil
+			delete(f.pending, t.name)
+		}
+	}
+	if len(f.order) > 2*len(f.pending)+16 {
+		order := f.order[:0]
+		for _, t := range f.order {
+			if !t.done {
+				order = append(order, t)
+			}
+		}
+		clear(f.order[len(order):])
+		f.order = order
+	}
+}
+
+// isCompilerOutput reports whether a line is a "# package" header or an
+// error of the compiler, which unlike test logs isn't indented
+func isCompilerOutput(line string) bool {
+	return strings.HasPrefix(line, "# ") || !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") && strings.Contains(line, ".go:")
+}
+
+// parentTest returns the test a subtest belongs to, or "" for a top-level
+// test
+func parentTest(name string) string {
+	if i := strings.LastIndexByte(name, '/'); i >= 0 {
+		return name[:i]
+	}
+	return ""
+}
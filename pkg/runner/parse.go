@@ -0,0 +1,197 @@
+package runner
+
+import (
+	"strings"
+	"time"
+)
+
+// Status is the outcome of a package's tests
+type Status string
+
+const (
+	StatusPassed      Status = "passed"
+	StatusFailed      Status = "failed"
+	StatusBuildFailed Status = "build failed"
+	StatusNoTests     Status = "no tests"
+)
+
+// Failure is a failed test and the output it logged
+type Failure struct {
+	Test   string
+	Output string
+}
+
+// TestStatus is the outcome of a single test
+type TestStatus string
+
+const (
+	TestPassed  TestStatus = "pass"
+	TestFailed  TestStatus = "fail"
+	TestSkipped TestStatus = "skip"
+)
+
+// TestResult is the outcome of a single test or subtest. Output is what it
+// logged, or for skipped tests the reason.
+type TestResult struct {
+	Name     string
+	Status   TestStatus
+	Duration time.Duration
+	Output   string
+}
+
+// testStatuses maps go test's result line prefixes to test statuses
+var testStatuses = map[string]TestStatus{
+	"--- PASS: ": TestPassed,
+	"--- FAIL: ": TestFailed,
+	"--- SKIP: ": TestSkipped,
+}
+
+// outputParser extracts the per-package results from go test output, one
+// line at a time. Each package's result line ("ok", "FAIL" or "?") ends its
+// block, so tests seen before it belong to that package. Passed and skipped
+// tests are only reported by go test -v, which prints what a test logged
+// before its result line rather than after it.
+type outputParser struct {
+	results []PackageResult
+	tests   []TestResult
+	current int // index in tests of the failure collecting output, or -1
+
+	running string              // test logging with -v, "" outside of tests
+	logs    map[string][]string // what running tests logged so far
+
+	progress func(Event) // Options.Progress
+}
+
+func (p *outputParser) line(line string) {
+	trimmed := strings.TrimSpace(line)
+
+	if rest, ok := strings.CutPrefix(trimmed, "=== "); ok {
+		fields := strings.Fields(rest)
+		if len(fields) == 2 && (fields[0] == "RUN" || fields[0] == "CONT" || fields[0] == "NAME") {
+			p.running, p.current = fields[1], -1
+			if fields[0] == "RUN" {
+				p.report(Event{Kind: EventTestStart, Test: TestResult{Name: fields[1]}})
+			}
+			return
+		}
+	}
+
+	if test, ok := parseTestLine(trimmed); ok {
+		if logs, ok := p.logs[test.Name]; ok {
+			test.Output = strings.Join(logs, "\n") + "\n"
+			delete(p.logs, test.Name)
+		}
+		p.running = ""
+		if _, ok := p.logs[parentTest(test.Name)]; ok {
+			p.running = parentTest(test.Name)
+		}
+		p.tests = append(p.tests, test)
+		p.current = len(p.tests) - 1
+		p.report(Event{Kind: EventTestFinish, Test: test})
+		return
+	}
+
+	if res, ok := parseResultLine(line); ok {
+		res.Tests = p.tests
+		for _, t := range p.tests {
+			if t.Status == TestFailed {
+				res.Failures = append(res.Failures, Failure{Test: t.Name, Output: t.Output})
+			}
+		}
+		p.results = append(p.results, res)
+		p.tests, p.current = nil, -1
+		p.running, p.logs = "", nil
+		p.report(Event{Kind: EventPackageFinish, Package: res.ImportPath, Result: res})
+		return
+	}
+
+	switch {
+	case p.running != "" && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")):
+		p.log(p.running, trimmed)
+	case p.current == -1 || len(p.tests) == 0:
+	case strings.HasPrefix(trimmed, "--- ") || strings.HasPrefix(trimmed, "=== ") || trimmed == "FAIL" || trimmed == "PASS":
+		p.current = -1
+	case strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") || strings.HasPrefix(trimmed, "panic:"):
+		p.tests[p.current].Output += trimmed + "\n"
+	}
+}
+
+func (p *outputParser) report(e Event) {
+	if p.progress != nil {
+		p.progress(e)
+	}
+}
+
+// parseTestLine parses a test result line such as
+// "--- FAIL: TestName/sub (0.01s)"
+func parseTestLine(line string) (TestResult, bool) {
+	for prefix, status := range testStatuses {
+		rest, ok := strings.CutPrefix(line, prefix)
+		if !ok {
+			continue
+		}
+		test := TestResult{Name: rest, Status: status}
+		if i := strings.LastIndex(rest, " ("); i > 0 {
+			test.Name = rest[:i]
+			test.Duration, _ = time.ParseDuration(strings.TrimSuffix(rest[i+2:], ")"))
+		}
+		return test, true
+	}
+	return TestResult{}, false
+}
+
+// parseResultLine parses a package result line such as
+// "ok  \texample.com/pkg\t0.012s\tcoverage: ..." or
+// "FAIL\texample.com/pkg [build failed]"
+func parseResultLine(line string) (PackageResult, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return PackageResult{}, false
+	}
+
+	// Packages without test files only report their coverage:
+	// "\texample.com/pkg\t\tcoverage: 0.0% of statements"
+	if strings.HasPrefix(line, "\t") && fields[1] == "coverage:" {
+		return PackageResult{ImportPath: fields[0], Status: StatusNoTests}, true
+	}
+
+	res := PackageResult{ImportPath: fields[1]}
+	switch fields[0] {
+	case "ok":
+		res.Status = StatusPassed
+	case "FAIL":
+		res.Status = StatusFailed
+		if strings.Contains(line, "[build failed]") || strings.Contains(line, "[setup failed]") {
+			res.Status = StatusBuildFailed
+		}
+	case "?":
+		if !strings.Contains(line, "[no test files]") {
+			return PackageResult{}, false
+		}
+		res.Status = StatusNoTests
+	default:
+		return PackageResult{}, false
+	}
+
+	if len(fields) >= 3 {
+		if fields[2] == "(cached)" {
+			res.Cached = true
+		} else if d, err := time.ParseDuration(fields[2]); err == nil {
+			res.Duration = d
+		}
+	}
+	return res, true
+}
+
+// log holds a line a running test logged until its result line, keeping
+// the last maxPendingLines
+func (p *outputParser) log(test, line string) {
+	if p.logs == nil {
+		p.logs = make(map[string][]string)
+	}
+	logs := append(p.logs[test], line)
+	if len(logs) > 2*maxPendingLines {
+		logs = append([]string(nil), logs[len(logs)-maxPendingLines:]...)
+	}
+	p.logs[test] = logs
+}
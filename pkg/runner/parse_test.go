@@ -0,0 +1,170 @@
+package runner
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTestLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want TestResult
+		ok   bool
+	}{
+		{"--- PASS: TestA (0.01s)", TestResult{Name: "TestA", Status: TestPassed, Duration: 10 * time.Millisecond}, true},
+		{"--- FAIL: TestA/sub_case (1.50s)", TestResult{Name: "TestA/sub_case", Status: TestFailed, Duration: 1500 * time.Millisecond}, true},
+		{"--- SKIP: TestB (0.00s)", TestResult{Name: "TestB", Status: TestSkipped}, true},
+		{"--- FAIL: TestC", TestResult{Name: "TestC", Status: TestFailed}, true},
+		{"=== RUN   TestA", TestResult{}, false},
+		{"FAIL", TestResult{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseTestLine(tt.line)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseTestLine(%q) = %+v, %v; want %+v, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseResultLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want PackageResult
+		ok   bool
+	}{
+		{"ok  \texample.com/a\t0.012s", PackageResult{ImportPath: "example.com/a", Status: StatusPassed, Duration: 12 * time.Millisecond}, true},
+		{"ok  \texample.com/a\t(cached)\tcoverage: 80.0% of statements", PackageResult{ImportPath: "example.com/a", Status: StatusPassed, Cached: true}, true},
+		{"FAIL\texample.com/b\t0.100s", PackageResult{ImportPath: "example.com/b", Status: StatusFailed, Duration: 100 * time.Millisecond}, true},
+		{"FAIL\texample.com/b [build failed]", PackageResult{ImportPath: "example.com/b", Status: StatusBuildFailed}, true},
+		{"FAIL\texample.com/b [setup failed]", PackageResult{ImportPath: "example.com/b", Status: StatusBuildFailed}, true},
+		{"?   \texample.com/c\t[no test files]", PackageResult{ImportPath: "example.com/c", Status: StatusNoTests}, true},
+		{"\texample.com/d\t\tcoverage: 0.0% of statements", PackageResult{ImportPath: "example.com/d", Status: StatusNoTests}, true},
+		{"?   \texample.com/c\tsomething else", PackageResult{}, false},
+		{"FAIL", PackageResult{}, false},
+		{"PASS", PackageResult{}, false},
+		{"okay then", PackageResult{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseResultLine(tt.line)
+		if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseResultLine(%q) = %+v, %v; want %+v, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// filter runs output through an outputFilter in small chunks, as go test
+// writes it
+func filter(output string) *outputFilter {
+	f := newOutputFilter()
+	for len(output) > 0 {
+		n := min(len(output), 7)
+		f.Write([]byte(output[:n]))
+		output = output[n:]
+	}
+	f.finish()
+	return f
+}
+
+func TestOutputFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []PackageResult
+		kept   string
+	}{
+		{
+			name: "failure without -v",
+			output: "--- FAIL: TestA (0.00s)\n" +
+				"    a_test.go:9: got 1, want 2\n" +
+				"FAIL\n" +
+				"FAIL\texample.com/a\t0.005s\n" +
+				"ok  \texample.com/b\t0.002s\n",
+			want: []PackageResult{
+				{
+					ImportPath: "example.com/a", Status: StatusFailed, Duration: 5 * time.Millisecond,
+					Failures: []Failure{{Test: "TestA", Output: "a_test.go:9: got 1, want 2\n"}},
+					Tests:    []TestResult{{Name: "TestA", Status: TestFailed, Output: "a_test.go:9: got 1, want 2\n"}},
+				},
+				{ImportPath: "example.com/b", Status: StatusPassed, Duration: 2 * time.Millisecond},
+			},
+			kept: "a_test.go:9: got 1, want 2",
+		},
+		{
+			name: "passed output dropped with -v",
+			output: "=== RUN   TestA\n" +
+				"    a_test.go:5: noisy log\n" +
+				"--- PASS: TestA (0.00s)\n" +
+				"=== RUN   TestB\n" +
+				"    b_test.go:7: why it failed\n" +
+				"--- FAIL: TestB (0.00s)\n" +
+				"=== RUN   TestC\n" +
+				"    c_test.go:3: not on this platform\n" +
+				"--- SKIP: TestC (0.00s)\n" +
+				"FAIL\n" +
+				"FAIL\texample.com/a\t0.010s\n",
+			want: []PackageResult{{
+				ImportPath: "example.com/a", Status: StatusFailed, Duration: 10 * time.Millisecond,
+				Failures: []Failure{{Test: "TestB", Output: "b_test.go:7: why it failed\n"}},
+				Tests: []TestResult{
+					{Name: "TestA", Status: TestPassed, Output: "a_test.go:5: noisy log\n"},
+					{Name: "TestB", Status: TestFailed, Output: "b_test.go:7: why it failed\n"},
+					{Name: "TestC", Status: TestSkipped, Output: "c_test.go:3: not on this platform\n"},
+				},
+			}},
+			kept: "why it failed",
+		},
+		{
+			name: "subtests",
+			output: "=== RUN   TestA\n" +
+				"=== RUN   TestA/ok\n" +
+				"=== RUN   TestA/bad\n" +
+				"    a_test.go:12: bad input\n" +
+				"--- FAIL: TestA (0.00s)\n" +
+				"    --- PASS: TestA/ok (0.00s)\n" +
+				"    --- FAIL: TestA/bad (0.00s)\n" +
+				"FAIL\n" +
+				"FAIL\texample.com/a\t0.001s\n",
+			want: []PackageResult{{
+				ImportPath: "example.com/a", Status: StatusFailed, Duration: time.Millisecond,
+				Failures: []Failure{{Test: "TestA"}, {Test: "TestA/bad", Output: "a_test.go:12: bad input\n"}},
+				Tests: []TestResult{
+					{Name: "TestA", Status: TestFailed},
+					{Name: "TestA/ok", Status: TestPassed},
+					{Name: "TestA/bad", Status: TestFailed, Output: "a_test.go:12: bad input\n"},
+				},
+			}},
+			kept: "bad input",
+		},
+		{
+			name: "build failure",
+			output: "# example.com/a\n" +
+				"./a.go:3:2: undefined: x\n" +
+				"FAIL\texample.com/a [build failed]\n",
+			want: []PackageResult{{ImportPath: "example.com/a", Status: StatusBuildFailed}},
+			kept: "./a.go:3:2: undefined: x",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := filter(tt.output)
+			if got := f.results(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("results =\n%+v\nwant\n%+v", got, tt.want)
+			}
+			if !strings.Contains(f.output(), tt.kept) {
+				t.Errorf("output %q doesn't keep %q", f.output(), tt.kept)
+			}
+		})
+	}
+}
+
+func TestOutputFilterDropsPassedOutput(t *testing.T) {
+	f := filter("=== RUN   TestA\n    a_test.go:5: noisy log\n--- PASS: TestA (0.00s)\nPASS\nok  \texample.com/a\t0.001s\n")
+	if strings.Contains(f.output(), "noisy log") {
+		t.Errorf("output %q keeps what a passed test logged", f.output())
+	}
+	if !strings.Contains(f.output(), "ok  \texample.com/a") {
+		t.Errorf("output %q drops the package result", f.output())
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package runner
+
+import "os/exec"
+
+// setProcessGroup leaves cmd to be killed on cancellation
+func setProcessGroup(cmd *exec.Cmd) {}
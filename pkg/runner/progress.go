@@ -0,0 +1,33 @@
+package runner
+
+// EventKind is the kind of a progress Event
+type EventKind string
+
+const (
+	// EventPackageStart is reported when a package tested individually
+	// starts; go test doesn't tell when a package of a single invocation
+	// starts
+	EventPackageStart EventKind = "package_start"
+	// EventTestStart and EventTestFinish are reported for every test and
+	// subtest; go test only announces tests and reports passed ones with -v
+	EventTestStart  EventKind = "test_start"
+	EventTestFinish EventKind = "test_finish"
+	// EventPackageFinish is reported with the result of a package
+	EventPackageFinish EventKind = "package_finish"
+)
+
+// Event reports the progress of a run to Options.Progress
+type Event struct {
+	Kind EventKind
+	// Package is the package as given in Options.Packages when tested
+	// individually or when only one package is tested. In a single go test
+	// invocation of several packages, tests are reported before the result
+	// line naming their package, so it is only set for EventPackageFinish,
+	// to the import path.
+	Package string
+	// Test is the test of EventTestStart and EventTestFinish; only its
+	// name is known when it starts
+	Test TestResult
+	// Result is the package result of EventPackageFinish
+	Result PackageResult
+}
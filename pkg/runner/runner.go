@@ -0,0 +1,343 @@
+// Package runner runs go test with coverage the way the gotest command does:
+// either all packages in one invocation, or each package in its own
+// invocation across a pool of workers, with the per-package coverage
+// profiles merged into one.
+package runner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Hoofffman/gotest/pkg/coverprofile"
+)
+
+// Options configures a test run
+type Options struct {
+	// Dir is the directory go test runs in; empty means the current directory
+	Dir string
+	// Packages are the packages to test, in any form go test accepts
+	Packages []string
+	// CoverPackages are measured for coverage (-coverpkg); defaults to Packages
+	CoverPackages []string
+	// CoverMode is set, count or atomic; defaults to atomic
+	CoverMode string
+	// CoverProfile is where the (merged) coverage profile is written
+	CoverProfile string
+	// Args are additional go test flags
+	Args []string
+
+	// Jobs is the number of parallel go test invocations. With more than one
+	// job, or with PerPackage, every package is tested in its own invocation.
+	Jobs       int
+	PerPackage bool
+	// PackageArgs optionally returns extra flags for one package; it is only
+	// used when packages are tested individually
+	PackageArgs func(pkg string) []string
+
+	// Go is the go command to run; defaults to "go"
+	Go string
+	// Env is the environment of go test; nil means the current environment
+	Env []string
+
+	// Stdout, if set, receives the test output as it is produced, together
+	// with progress information; go test's stderr goes to Stderr, or to
+	// Stdout if Stderr is nil. Nothing is written otherwise. Stdin is passed
+	// to a single go test; canceling the run then only stops go test, not
+	// the test binaries it started.
+	Stdout io.Writer
+	Stderr io.Writer
+	Stdin  io.Reader
+	// Debug, if set, receives a line when each go test process starts and
+	// when it exits
+	Debug io.Writer
+	// Progress, if set, is called with each Event as the run progresses.
+	// With parallel jobs it is called from several goroutines at once.
+	Progress func(Event)
+}
+
+// Result is the outcome of a test run
+type Result struct {
+	// Output is the combined go test output, without what passed and
+	// skipped tests logged: with -v, the output of a test is only kept if
+	// it fails or doesn't finish. Stdout receives all of it.
+	Output string
+	// Packages holds the result of every package go test reported on
+	Packages []PackageResult
+	// Durations is the wall time per package when tested individually
+	Durations map[string]time.Duration
+	// Coverage is the per-package coverage of the profile, and Total its
+	// overall coverage; both are empty if no profile was written
+	Coverage []coverprofile.PackageStats
+	Total    coverprofile.PackageStats
+}
+
+// PackageResult is the outcome of testing one package
+type PackageResult struct {
+	// Package is the package as given in Options.Packages when tested
+	// individually, otherwise its import path
+	Package    string
+	ImportPath string
+	Status     Status
+	Cached     bool
+	// Failures lists the failed tests, including subtests
+	Failures []Failure
+	// Tests lists the results of individual tests, including subtests.
+	// go test only reports passed and skipped tests with -v; without it,
+	// this only holds the failures.
+	Tests []TestResult
+	// Duration is the wall time of the package's go test invocation when
+	// tested individually, otherwise the time go test reported
+	Duration time.Duration
+	// Coverage is the package's own statement coverage, if it has any
+	Coverage *coverprofile.PackageStats
+	// Output and Err are the package's own go test output, kept as in
+	// Result.Output, and error; both are only set when packages are tested
+	// individually
+	Output string
+	Err    error
+}
+
+// Failed returns the packages whose tests or build failed
+func (r *Result) Failed() []PackageResult {
+	var failed []PackageResult
+	for _, res := range r.Packages {
+		if res.Err != nil || res.Status == StatusFailed || res.Status == StatusBuildFailed {
+			failed = append(failed, res)
+		}
+	}
+	return failed
+}
+
+// addCoverage fills in the coverage from the written profile
+func (r *Result) addCoverage(ctx context.Context, profile string) {
+	p, err := coverprofile.ParseFile(ctx, profile)
+	if err != nil {
+		return
+	}
+	r.Coverage = p.Packages()
+	r.Total = p.Total()
+	byPath := make(map[string]*coverprofile.PackageStats)
+	for i := range r.Coverage {
+		byPath[r.Coverage[i].Package] = &r.Coverage[i]
+	}
+	for i := range r.Packages {
+		r.Packages[i].Coverage = byPath[r.Packages[i].ImportPath]
+	}
+}
+
+// Run tests the packages and writes the coverage profile. The returned error
+// reports failing tests; the Result is never nil.
+func Run(ctx context.Context, opts Options) (*Result, error) {
+	if opts.CoverMode == "" {
+		opts.CoverMode = "atomic"
+	}
+	if opts.CoverPackages == nil {
+		opts.CoverPackages = opts.Packages
+	}
+	if opts.Go == "" {
+		opts.Go = "go"
+	}
+	if opts.Stderr == nil {
+		opts.Stderr = opts.Stdout
+	}
+
+	var result *Result
+	var err error
+	if opts.Jobs > 1 || opts.PerPackage {
+		result, err = runParallel(ctx, opts)
+	} else {
+		result, err = runSingle(ctx, opts)
+	}
+	result.addCoverage(ctx, opts.CoverProfile)
+	return result, err
+}
+
+func (opts *Options) command(ctx context.Context, args []string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, opts.Go, args...)
+	cmd.Dir = opts.Dir
+	cmd.Env = opts.Env
+	if opts.Stdin == nil {
+		setProcessGroup(cmd)
+	}
+	cmd.WaitDelay = 10 * time.Second
+	return cmd
+}
+
+// run runs a go test command, logging its lifecycle to Debug
+func (opts *Options) run(cmd *exec.Cmd) error {
+	if opts.Debug == nil {
+		return cmd.Run()
+	}
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(opts.Debug, "debug: starting %s failed: %v\n", strings.Join(cmd.Args, " "), err)
+		return err
+	}
+	fmt.Fprintf(opts.Debug, "debug: started pid %d: %s\n", cmd.Process.Pid, strings.Join(cmd.Args, " "))
+	err := cmd.Wait()
+	status := "ok"
+	if err != nil {
+		status = err.Error()
+	}
+	fmt.Fprintf(opts.Debug, "debug: pid %d exited (%s) after %s\n", cmd.Process.Pid, status, time.Since(start).Round(time.Millisecond))
+	return err
+}
+
+func (opts *Options) coverArgs(profile string) []string {
+	// -coverpkg with all packages ensures cross-package calls are counted
+	return []string{"test", "-coverprofile=" + profile, "-covermode=" + opts.CoverMode, "-coverpkg=" + strings.Join(opts.CoverPackages, ",")}
+}
+
+// runSingle tests all packages in one go test invocation
+func runSingle(ctx context.Context, opts Options) (*Result, error) {
+	args := opts.coverArgs(opts.CoverProfile)
+	args = append(args, opts.Args...)
+	args = append(args, opts.Packages...)
+
+	filter := newOutputFilter()
+	filter.parser.progress = opts.Progress
+	if opts.Progress != nil && len(opts.Packages) == 1 {
+		filter.parser.progress = func(e Event) {
+			if e.Kind != EventPackageFinish {
+				e.Package = opts.Packages[0]
+			}
+			opts.Progress(e)
+		}
+	}
+	cmd := opts.command(ctx, args)
+	if opts.Stdout != nil {
+		fmt.Fprintf(opts.Stdout, "Running: go %s\n\n", strings.Join(args, " "))
+		cmd.Stdout = io.MultiWriter(opts.Stdout, filter)
+		cmd.Stderr = io.MultiWriter(opts.Stderr, filter)
+		cmd.Stdin = opts.Stdin
+	} else {
+		cmd.Stdout = filter
+		cmd.Stderr = filter
+	}
+	err := opts.run(cmd)
+	filter.finish()
+
+	result := &Result{Output: filter.output()}
+	for _, res := range filter.results() {
+		res.Package = res.ImportPath
+		result.Packages = append(result.Packages, res)
+	}
+	return result, err
+}
+
+// runParallel tests each package in its own go test invocation across a pool
+// of workers, then merges the per-package profiles into the cover profile
+func runParallel(ctx context.Context, opts Options) (*Result, error) {
+	tmpDir, err := os.MkdirTemp("", "gotest-")
+	if err != nil {
+		return &Result{}, fmt.Errorf("creating profile directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	workers := max(opts.Jobs, 1)
+	if opts.Stdout != nil {
+		fmt.Fprintf(opts.Stdout, "Running %d package(s) with %d worker(s)\n\n", len(opts.Packages), workers)
+	}
+
+	results := make([]PackageResult, len(opts.Packages))
+	profiles := make([]string, len(opts.Packages))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	var printMu sync.Mutex
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range work {
+				pkg := opts.Packages[idx]
+				profiles[idx] = filepath.Join(tmpDir, fmt.Sprintf("cover-%d.out", idx))
+
+				args := opts.coverArgs(profiles[idx])
+				if opts.PackageArgs != nil {
+					args = append(args, opts.PackageArgs(pkg)...)
+				}
+				args = append(args, opts.Args...)
+				args = append(args, pkg)
+
+				// The full output is only held to print it as one block
+				var output bytes.Buffer
+				filter := newOutputFilter()
+				if opts.Progress != nil {
+					// The package result is reported once the wall time is known
+					filter.parser.progress = func(e Event) {
+						if e.Kind != EventPackageFinish {
+							e.Package = pkg
+							opts.Progress(e)
+						}
+					}
+					opts.Progress(Event{Kind: EventPackageStart, Package: pkg})
+				}
+				cmd := opts.command(ctx, args)
+				cmd.Stdout = filter
+				if opts.Stdout != nil {
+					cmd.Stdout = io.MultiWriter(&output, filter)
+				}
+				cmd.Stderr = cmd.Stdout
+				start := time.Now()
+				err := opts.run(cmd)
+				filter.finish()
+				res := PackageResult{Package: pkg, Status: StatusPassed, Output: filter.output(), Err: err}
+				if err != nil {
+					res.Status = StatusFailed
+				}
+				if parsed := filter.results(); len(parsed) > 0 {
+					res.ImportPath, res.Status, res.Cached = parsed[0].ImportPath, parsed[0].Status, parsed[0].Cached
+					res.Failures, res.Tests = parsed[0].Failures, parsed[0].Tests
+				}
+				res.Duration = time.Since(start)
+				results[idx] = res
+				if opts.Progress != nil {
+					opts.Progress(Event{Kind: EventPackageFinish, Package: pkg, Result: res})
+				}
+
+				// Print each package's output as one block so workers never interleave lines
+				if opts.Stdout != nil {
+					printMu.Lock()
+					fmt.Fprintf(opts.Stdout, "=== %s\n%s\n", pkg, output.String())
+					printMu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for idx := range opts.Packages {
+		work <- idx
+	}
+	close(work)
+	wg.Wait()
+
+	var testErr error
+	var existing []string
+	var output strings.Builder
+	result := &Result{Packages: results, Durations: make(map[string]time.Duration)}
+	for idx, res := range results {
+		output.WriteString(res.Output)
+		result.Durations[res.Package] = res.Duration
+		if res.Err != nil && testErr == nil {
+			testErr = fmt.Errorf("%s: %w", res.Package, res.Err)
+		}
+		if _, err := os.Stat(profiles[idx]); err == nil {
+			existing = append(existing, profiles[idx])
+		}
+	}
+	result.Output = output.String()
+
+	if err := coverprofile.MergeFiles(ctx, existing, opts.CoverProfile); err != nil {
+		return result, fmt.Errorf("merging coverage profiles: %w", err)
+	}
+	return result, testErr
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/Hoofffman/gotest/pkg/coverprofile"
+	"github.com/Hoofffman/gotest/pkg/runner"
+)
+
+// summaryVersion is the version of the run summary JSON; fields are only
+// ever added within a version
+const summaryVersion = 1
+
+// runSummary is the JSON document reporter plugins receive on stdin
+type runSummary struct {
+	Version         int              `json:"version"`
+	RunID           string           `json:"run_id"`
+	Passed          bool             `json:"passed"`
+	Started         time.Time        `json:"started"`
+	DurationSeconds float64          `json:"duration_seconds"`
+	Dir             string           `json:"dir"`
+	CoverProfile    string           `json:"coverage_profile"`
+	CoverHTML       string           `json:"coverage_html"`
+	ArtifactDir     string           `json:"artifact_dir,omitempty"`
+	Coverage        summaryCoverage  `json:"coverage"`
+	Packages        []summaryPackage `json:"packages"`
+}
+
+type summaryCoverage struct {
+	Statements int     `json:"statements"`
+	Covered    int     `json:"covered"`
+	Percent    float64 `json:"percent"`
+}
+
+type summaryPackage struct {
+	Package         string           `json:"package"`
+	Status          string           `json:"status"`
+	Cached          bool             `json:"cached"`
+	DurationSeconds float64          `json:"duration_seconds"`
+	Coverage        *summaryCoverage `json:"coverage,omitempty"`
+	Failures        []summaryFailure `json:"failures,omitempty"`
+	Tests           []summaryTest    `json:"tests,omitempty"`
+}
+
+// StatusClass returns the package status as a CSS class
+func (p summaryPackage) StatusClass() string {
+	return strings.ReplaceAll(p.Status, " ", "-")
+}
+
+type summaryTest struct {
+	Name            string  `json:"name"`
+	Status          string  `json:"status"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+type summaryFailure struct {
+	Test   string `json:"test"`
+	Output string `json:"output"`
+}
+
+// buildSummary describes a finished run for reporter plugins
+func buildSummary(ctx context.Context, result *runner.Result, passed bool, started time.Time, coverProfile, coverHTML string) runSummary {
+	dir, _ := os.Getwd()
+	s := runSummary{
+		Version:         summaryVersion,
+		RunID:           newRunID(started),
+		Passed:          passed,
+		Started:         started,
+		DurationSeconds: time.Since(started).Seconds(),
+		Dir:             dir,
+		CoverProfile:    coverProfile,
+		CoverHTML:       coverHTML,
+		Packages:        []summaryPackage{},
+	}
+	if profile, err := coverprofile.ParseFile(ctx, coverProfile); err == nil {
+		s.Coverage = newSummaryCoverage(profile.Total())
+	}
+
+	for _, res := range result.Packages {
+		pkg := summaryPackage{
+			Package:         res.ImportPath,
+			Status:          string(res.Status),
+			Cached:          res.Cached,
+			DurationSeconds: res.Duration.Seconds(),
+		}
+		if pkg.Package == "" {
+			pkg.Package = res.Package
+		}
+		if res.Coverage != nil {
+			c := newSummaryCoverage(*res.Coverage)
+			pkg.Coverage = &c
+		}
+		for _, f := range res.Failures {
+			pkg.Failures = append(pkg.Failures, summaryFailure{Test: f.Test, Output: f.Output})
+		}
+		for _, t := range res.Tests {
+			pkg.Tests = append(pkg.Tests, summaryTest{Name: t.Name, Status: string(t.Status), DurationSeconds: t.Duration.Seconds()})
+		}
+		s.Packages = append(s.Packages, pkg)
+	}
+	return s
+}
+
+func newSummaryCoverage(stats coverprofile.PackageStats) summaryCoverage {
+	return summaryCoverage{Statements: stats.Statements, Covered: stats.Covered, Percent: stats.Percent()}
+}
+
+// runPlugins runs each reporter plugin with the run summary on stdin. A
+// plugin is an executable with optional arguments; failing plugins are
+// reported but don't fail the run.
+func runPlugins(ctx context.Context, summary runSummary) {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		warnf("encoding run summary: %v", err)
+		return
+	}
+
+	for _, plugin := range plugins {
+		args := strings.Fields(os.ExpandEnv(plugin))
+		if len(args) == 0 {
+			continue
+		}
+		if verbose {
+			fmt.Printf("Running plugin: %s\n", plugin)
+		}
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.Stdin = bytes.NewReader(data)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		cmd.Env = append(os.Environ(), "GOTEST_SUMMARY_VERSION="+fmt.Sprint(summaryVersion))
+		if err := cmd.Run(); err != nil {
+			warnf("plugin %s failed: %v", args[0], err)
+		}
+	}
+}
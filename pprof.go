@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// pprofFlags maps the kinds accepted by --pprof to go test's profile flags
+var pprofFlags = map[string]string{
+	"cpu":   "-cpuprofile",
+	"mem":   "-memprofile",
+	"block": "-blockprofile",
+	"mutex": "-mutexprofile",
+}
+
+// parsePprofKinds validates a comma-separated --pprof value
+func parsePprofKinds(value string) ([]string, error) {
+	var kinds []string
+	for _, kind := range splitList(value) {
+		if _, ok := pprofFlags[kind]; !ok {
+			return nil, fmt.Errorf("invalid --pprof kind %q (expected cpu, mem, block or mutex)", kind)
+		}
+		kinds = append(kinds, kind)
+	}
+	return kinds, nil
+}
+
+// pprofName turns a package directory into a file name prefix
+func pprofName(pkg string) string {
+	name := strings.Trim(filepath.ToSlash(filepath.Clean(pkg)), "./")
+	if name == "" {
+		return "root"
+	}
+	return strings.ReplaceAll(name, "/", "_")
+}
+
+// preparePprofDir creates the profile directory and removes the profiles
+// and test binaries of earlier runs
+func preparePprofDir() error {
+	if err := os.MkdirAll(pprofDir, 0755); err != nil {
+		return err
+	}
+	for _, pattern := range []string{"*.pprof", "*.trace", "*.test"} {
+		old, _ := filepath.Glob(filepath.Join(pprofDir, pattern))
+		for _, file := range old {
+			os.Remove(file)
+		}
+	}
+	return nil
+}
+
+// pprofArgs returns the profiling and tracing flags for one package. go test
+// only accepts these flags for a single package, and keeps the test binary
+// (needed to symbolize the profiles) next to them.
+func pprofArgs(pkg string) []string {
+	if len(pprofKinds) == 0 && !traceMode {
+		return nil
+	}
+	name := pprofName(pkg)
+	args := []string{"-o", filepath.Join(pprofDir, name+".test")}
+	for _, kind := range pprofKinds {
+		args = append(args, pprofFlags[kind]+"="+filepath.Join(pprofDir, name+"."+kind+".pprof"))
+	}
+	if traceMode {
+		args = append(args, "-trace="+filepath.Join(pprofDir, name+".trace"))
+	}
+	return args
+}
+
+// largestFile returns the largest non-empty file matching pattern
+func largestFile(pattern string) string {
+	files, _ := filepath.Glob(pattern)
+	var largest string
+	var size int64
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil && info.Size() > size {
+			largest, size = file, info.Size()
+		}
+	}
+	return largest
+}
+
+// openTrace opens the largest execution trace in go tool trace, which
+// serves the viewer until interrupted
+func openTrace() {
+	trace := largestFile(filepath.Join(pprofDir, "*.trace"))
+	if trace == "" {
+		fmt.Println("\nNo execution traces were written (no tests ran?)")
+		return
+	}
+	binary := strings.TrimSuffix(trace, ".trace") + ".test"
+	args := []string{"tool", "trace", binary, trace}
+	if noBrowser {
+		fmt.Printf("\nExecution traces written to %s\nTo view the largest: go %s\n", pprofDir, strings.Join(args, " "))
+		return
+	}
+
+	fmt.Printf("\nOpening %s in go tool trace (Ctrl+C to stop)...\n", trace)
+	cmd := goCommand(args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		warnf("go tool trace failed: %v", err)
+	}
+}
+
+// reportPprofProfiles lists the collected profiles and offers to open the
+// largest one in the pprof web UI
+func reportPprofProfiles() {
+	files, _ := filepath.Glob(filepath.Join(pprofDir, "*.pprof"))
+	type profile struct {
+		path string
+		size int64
+	}
+	var profiles []profile
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil && info.Size() > 0 {
+			profiles = append(profiles, profile{file, info.Size()})
+		}
+	}
+	if len(profiles) == 0 {
+		fmt.Println("\nNo profiles were written (no tests ran?)")
+		return
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].size > profiles[j].size })
+
+	fmt.Printf("\nProfiles written to %s:\n", pprofDir)
+	for _, p := range profiles {
+		fmt.Printf("  %-50s %8d bytes\n", filepath.Base(p.path), p.size)
+	}
+
+	largest := profiles[0].path
+	binary := strings.TrimSuffix(largest, filepath.Ext(largest))
+	binary = strings.TrimSuffix(binary, filepath.Ext(binary)) + ".test"
+	args := []string{"tool", "pprof", "-http=localhost:0", binary, largest}
+	fmt.Printf("\nTo explore the largest profile: go %s\n", strings.Join(args, " "))
+
+	if noBrowser || !isTerminal(os.Stdin) {
+		return
+	}
+	fmt.Print("Open it now? [y/N] ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+		return
+	}
+	cmd := goCommand(args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		warnf("go tool pprof failed: %v", err)
+	}
+}
+
+// isTerminal reports whether f is an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// raceTimeoutFactor is how much longer tests may run under the race
+// detector, which typically slows execution down 2-20x
+const raceTimeoutFactor = 5
+
+// defaultTestTimeout is go test's own default -timeout
+const defaultTestTimeout = 10 * time.Minute
+
+// scaleTimeout multiplies the -timeout in the go test arguments by factor,
+// adding a scaled default timeout if none was given
+func scaleTimeout(args []string, factor int) []string {
+	scaled := make([]string, 0, len(args)+1)
+	found := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name := strings.TrimLeft(arg, "-")
+		if name != "timeout" && name != "test.timeout" && !strings.HasPrefix(name, "timeout=") && !strings.HasPrefix(name, "test.timeout=") {
+			scaled = append(scaled, arg)
+			continue
+		}
+
+		var value string
+		if _, v, ok := strings.Cut(arg, "="); ok {
+			value = v
+		} else if i+1 < len(args) {
+			i++
+			value = args[i]
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d == 0 {
+			// Invalid timeouts are left for go test to report; 0 disables the timeout
+			scaled = append(scaled, "-timeout="+value)
+		} else {
+			scaled = append(scaled, "-timeout="+(d*time.Duration(factor)).String())
+		}
+		found = true
+	}
+
+	if !found {
+		scaled = append(scaled, "-timeout="+(defaultTestTimeout*time.Duration(factor)).String())
+	}
+	return scaled
+}
+
+// raceDelimiter surrounds each report printed by the race detector
+const raceDelimiter = "=================="
+
+// parseRaceReports extracts the "WARNING: DATA RACE" reports from test
+// output. Identical reports (the same race hit repeatedly) are reported once.
+func parseRaceReports(output string) []string {
+	var reports []string
+	seen := make(map[string]bool)
+	var current []string
+	inReport := false
+
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		if !inReport {
+			if line == raceDelimiter && i+1 < len(lines) && lines[i+1] == "WARNING: DATA RACE" {
+				inReport = true
+				current = nil
+			}
+			continue
+		}
+		if line == raceDelimiter {
+			report := strings.Join(current, "\n")
+			if !seen[report] {
+				seen[report] = true
+				reports = append(reports, report)
+			}
+			inReport = false
+			continue
+		}
+		current = append(current, line)
+	}
+	return reports
+}
+
+// printRaceReports prints detected data races in their own section
+func printRaceReports(reports []string) {
+	if len(reports) == 0 {
+		fmt.Println("\nRace detector: no data races found")
+		return
+	}
+	fmt.Printf("\n--- DATA RACES (%d) ---\n", len(reports))
+	for i, report := range reports {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Println(report)
+	}
+	fmt.Println("----------------------")
+}
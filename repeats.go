@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Hoofffman/gotest/pkg/runner"
+)
+
+// testRepeats returns how often go test runs each test, from -count, or 1
+func testRepeats(args []string) int {
+	value, _ := goTestFlag(args, "count")
+	if n, err := strconv.Atoi(value); err == nil && n > 0 {
+		return n
+	}
+	return 1
+}
+
+// repeatedTest is a top-level test's outcome over all repetitions
+type repeatedTest struct {
+	pkg   string
+	name  string
+	fails int
+}
+
+// printRepeatedTests classifies the failing tests of a run with -count=n as
+// flaky (failed in some runs) or always failing, instead of making the user
+// count the copies in the output. Tests that never failed are stable.
+func printRepeatedTests(result *runner.Result, n int) {
+	var tests []*repeatedTest
+	for _, res := range result.Packages {
+		byName := make(map[string]*repeatedTest)
+		for _, t := range res.Tests {
+			if t.Status != runner.TestFailed || strings.Contains(t.Name, "/") {
+				continue
+			}
+			rt, ok := byName[t.Name]
+			if !ok {
+				rt = &repeatedTest{pkg: localPath(res.ImportPath), name: t.Name}
+				byName[t.Name] = rt
+				tests = append(tests, rt)
+			}
+			rt.fails++
+		}
+	}
+	if len(tests) == 0 {
+		return
+	}
+	sort.SliceStable(tests, func(i, j int) bool { return tests[i].fails > tests[j].fails })
+
+	fmt.Printf("\n--- REPEATED TESTS (-count=%d) ---\n", n)
+	for _, t := range tests {
+		class := "flaky"
+		if t.fails >= n {
+			class = "always fails"
+		}
+		fmt.Printf("%-13s %s %s: failed %d of %d runs\n", class, t.pkg, t.name, min(t.fails, n), n)
+	}
+	fmt.Println("All other tests passed every run")
+	fmt.Println("------------------------------")
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Hoofffman/gotest/pkg/coverprofile"
+)
+
+// Line coverage states in the unified report
+const (
+	lineCovered   = "cov"
+	lineUncovered = "unc"
+	linePartial   = "part"
+)
+
+type reportLine struct {
+	Num   int
+	Text  template.HTML // highlighted source
+	State string
+}
+
+type reportFile struct {
+	ID      string
+	Name    string
+	Package string
+	Stats   coverprofile.PackageStats
+	Lines   []reportLine
+	Missing bool
+}
+
+type reportData struct {
+	Summary   runSummary
+	Generated time.Time
+	Tests     struct{ Passed, Failed, Skipped int }
+	Verbose   bool
+	Files     []reportFile
+}
+
+// writeUnifiedReport writes a single HTML document with the test results
+// of the run and the line coverage of every file in the profile
+func writeUnifiedReport(ctx context.Context, path string, summary runSummary) error {
+	data := reportData{Summary: summary, Generated: time.Now()}
+	for _, pkg := range summary.Packages {
+		for _, t := range pkg.Tests {
+			switch t.Status {
+			case "pass":
+				data.Tests.Passed++
+				data.Verbose = true
+			case "fail":
+				data.Tests.Failed++
+			case "skip":
+				data.Tests.Skipped++
+				data.Verbose = true
+			}
+		}
+	}
+
+	profile, err := coverprofile.ParseFile(ctx, summary.CoverProfile)
+	if err != nil {
+		return err
+	}
+	if data.Files, err = reportFiles(ctx, profile); err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := reportTemplate.Execute(file, data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// reportFiles annotates the source of every file in the profile with its
+// line coverage. A line is partially covered if only some of the blocks on
+// it were executed.
+func reportFiles(ctx context.Context, profile *coverprofile.Profile) ([]reportFile, error) {
+	dirs, err := packageDirs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byFile := make(map[string][]coverprofile.Block)
+	var names []string
+	for _, b := range profile.Blocks {
+		if _, ok := byFile[b.File]; !ok {
+			names = append(names, b.File)
+		}
+		byFile[b.File] = append(byFile[b.File], b)
+	}
+	sort.Strings(names)
+
+	files := make([]reportFile, 0, len(names))
+	for i, name := range names {
+		f := reportFile{ID: fmt.Sprintf("file-%d", i), Name: name, Package: path.Dir(name)}
+		var states map[int]string
+		states, f.Stats = lineStates(byFile[name])
+
+		source, err := os.ReadFile(sourcePath(name, dirs))
+		if err != nil {
+			f.Missing = true
+			files = append(files, f)
+			continue
+		}
+		for i, text := range highlightGo(source) {
+			f.Lines = append(f.Lines, reportLine{Num: i + 1, Text: text, State: states[i+1]})
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// lineStates returns the coverage state of every line the blocks of a file
+// span, and the file's statement counts
+func lineStates(blocks []coverprofile.Block) (map[int]string, coverprofile.PackageStats) {
+	var stats coverprofile.PackageStats
+	states := make(map[int]string)
+	for _, b := range blocks {
+		stats.Statements += b.NumStmt
+		state := lineUncovered
+		if b.Count > 0 {
+			stats.Covered += b.NumStmt
+			state = lineCovered
+		}
+		for l := b.StartLine; l <= b.EndLine; l++ {
+			if prev, ok := states[l]; ok && prev != state {
+				states[l] = linePartial
+			} else {
+				states[l] = state
+			}
+		}
+	}
+	return states, stats
+}
+
+// packageDirs maps the import paths of the module's packages to their
+// directories
+func packageDirs(ctx context.Context) (map[string]string, error) {
+	out, err := goCommandContext(ctx, "list", "-e", "-f", "{{.ImportPath}}\t{{.Dir}}", "./...").Output()
+	if err != nil {
+		return nil, fmt.Errorf("listing packages: %w", commandError(err))
+	}
+	dirs := make(map[string]string)
+	for _, line := range strings.Split(string(out), "\n") {
+		if importPath, dir, ok := strings.Cut(line, "\t"); ok {
+			dirs[importPath] = dir
+		}
+	}
+	return dirs, nil
+}
+
+// sourcePath returns where the source of a profile file name is: file names
+// are import paths, except for nested modules, which are relative paths
+func sourcePath(name string, dirs map[string]string) string {
+	if strings.HasPrefix(name, "./") || filepath.IsAbs(name) {
+		return filepath.FromSlash(name)
+	}
+	if dir, ok := dirs[path.Dir(name)]; ok {
+		return filepath.Join(dir, path.Base(name))
+	}
+	return filepath.FromSlash(name)
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"percent": func(s coverprofile.PackageStats) string { return fmt.Sprintf("%.1f%%", s.Percent()) },
+	"seconds": func(s float64) string {
+		return (time.Duration(s * float64(time.Second))).Round(time.Millisecond).String()
+	},
+	"pct": func(p float64) string { return fmt.Sprintf("%.1f%%", p) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>gotest report</title>
+<style>
+body { margin: 0; font: 14px -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; color: #222; display: flex; }
+nav { width: 280px; height: 100vh; overflow-y: auto; position: sticky; top: 0; background: #f6f8fa; border-right: 1px solid #ddd; padding: 12px; box-sizing: border-box; flex-shrink: 0; }
+nav a { display: block; color: #0366d6; text-decoration: none; padding: 2px 0; white-space: nowrap; overflow: hidden; text-overflow: ellipsis; }
+nav h3 { margin: 16px 0 4px; font-size: 12px; text-transform: uppercase; color: #666; }
+main { flex: 1; padding: 16px 24px; min-width: 0; }
+table { border-collapse: collapse; margin-bottom: 24px; }
+th, td { text-align: left; padding: 4px 12px 4px 0; border-bottom: 1px solid #eee; }
+td.num { text-align: right; }
+.passed, .pass { color: #22863a; } .failed, .fail, .build-failed { color: #cb2431; font-weight: bold; } .skip, .no-tests { color: #6a737d; }
+pre { background: #f6f8fa; padding: 8px; overflow-x: auto; }
+.source { font: 12px monospace; border-collapse: collapse; width: 100%; }
+.source td { padding: 0 8px; border: 0; white-space: pre; }
+.source td.ln { color: #999; text-align: right; user-select: none; width: 1%; }
+tr.cov { background: #e6ffed; } tr.unc { background: #ffeef0; } tr.part { background: #fff5b1; }
+.source .kw { color: #d73a49; } .source .str { color: #032f62; } .source .num, .source .bi { color: #005cc5; }
+.source .fn { color: #6f42c1; } .source .com { color: #6a737d; font-style: italic; }
+details { margin-bottom: 8px; } summary { cursor: pointer; }
+</style>
+</head>
+<body>
+<nav>
+<a href="#summary"><b>Summary</b></a>
+{{if .Tests.Failed}}<a href="#failures">Failures ({{.Tests.Failed}})</a>{{end}}
+<a href="#packages">Packages</a>
+<h3>Files</h3>
+{{range .Files}}<a href="#{{.ID}}" title="{{.Name}}">{{percent .Stats}} {{.Name}}</a>
+{{end}}
+</nav>
+<main>
+<h1 id="summary">{{if .Summary.Passed}}<span class="passed">All tests passed</span>{{else}}<span class="failed">Tests failed</span>{{end}}</h1>
+<p>{{.Summary.Dir}} &middot; started {{.Summary.Started.Format "2006-01-02 15:04:05"}} &middot; took {{seconds .Summary.DurationSeconds}}</p>
+<table>
+<tr><th>Coverage</th><td>{{pct .Summary.Coverage.Percent}} ({{.Summary.Coverage.Covered}}/{{.Summary.Coverage.Statements}} statements)</td></tr>
+<tr><th>Packages</th><td>{{len .Summary.Packages}}</td></tr>
+<tr><th>Tests</th><td>{{if .Verbose}}<span class="pass">{{.Tests.Passed}} passed</span>, {{end}}<span class="fail">{{.Tests.Failed}} failed</span>{{if .Verbose}}, <span class="skip">{{.Tests.Skipped}} skipped</span>{{end}}</td></tr>
+</table>
+{{if not .Verbose}}<p class="skip">Passed and skipped tests are only listed when go test runs with -v.</p>{{end}}
+
+{{if .Tests.Failed}}
+<h2 id="failures">Failures</h2>
+{{range .Summary.Packages}}{{$pkg := .Package}}{{range .Failures}}
+<h3 class="fail">{{.Test}} <small>{{$pkg}}</small></h3>
+<pre>{{.Output}}</pre>
+{{end}}{{end}}
+{{end}}
+
+<h2 id="packages">Packages</h2>
+<table>
+<tr><th>Package</th><th>Status</th><th>Duration</th><th>Coverage</th></tr>
+{{range .Summary.Packages}}
+<tr><td>{{.Package}}</td><td class="{{.StatusClass}}">{{.Status}}{{if .Cached}} (cached){{end}}</td><td class="num">{{seconds .DurationSeconds}}</td><td class="num">{{with .Coverage}}{{pct .Percent}}{{else}}-{{end}}</td></tr>
+{{if .Tests}}<tr><td colspan="4"><details><summary>{{len .Tests}} test(s)</summary><table>
+{{range .Tests}}<tr><td>{{.Name}}</td><td class="{{.Status}}">{{.Status}}</td><td class="num">{{seconds .DurationSeconds}}</td></tr>
+{{end}}</table></details></td></tr>{{end}}
+{{end}}
+</table>
+
+<h2>Files</h2>
+{{range .Files}}
+<details id="{{.ID}}"><summary><b>{{.Name}}</b> &middot; {{percent .Stats}} ({{.Stats.Covered}}/{{.Stats.Statements}} statements)</summary>
+{{if .Missing}}<p class="skip">Source not found.</p>{{else}}
+<table class="source">
+{{range .Lines}}<tr{{if .State}} class="{{.State}}"{{end}}><td class="ln">{{.Num}}</td><td>{{.Text}}</td></tr>
+{{end}}</table>{{end}}
+</details>
+{{end}}
+</main>
+</body>
+</html>
+`))
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+
+	"github.com/Hoofffman/gotest/pkg/coverprofile"
+)
+
+// Coverage changes of a line in the diff report
+const (
+	lineGained = "up"
+	lineLost   = "down"
+)
+
+// maxAlignCells bounds the table used to align the changed part of two
+// versions of a file; beyond it the part is shown as removed and added
+const maxAlignCells = 4 << 20
+
+// diffLine is a row of the diff report: a line of the base version, of the
+// head version, or of both. A side without the line has Num 0.
+type diffLine struct {
+	Base, Head reportLine
+	Change     string
+}
+
+type diffFile struct {
+	ID         string
+	Name       string
+	Base, Head coverprofile.PackageStats
+	Lines      []diffLine
+	Gained     int
+	Lost       int
+	Missing    bool
+}
+
+func (f diffFile) Changed() bool { return f.Gained > 0 || f.Lost > 0 }
+
+type diffData struct {
+	BaseProfile, HeadProfile string
+	BaseRef                  string
+	Base, Head               coverprofile.PackageStats
+	Gained, Lost             int
+	Packages                 []coverprofile.PackageDiff
+	Files                    []diffFile
+}
+
+// writeCoverageDiff writes an HTML page that shows the coverage of every
+// file in two profiles side by side. The head profile belongs to the
+// source in the working tree; the base one to baseRef, or to the same
+// source if baseRef is empty.
+func writeCoverageDiff(ctx context.Context, path, baseProfile, headProfile, baseRef string) (diffData, error) {
+	data := diffData{BaseProfile: baseProfile, HeadProfile: headProfile, BaseRef: baseRef}
+	base, err := coverprofile.ParseFile(ctx, baseProfile)
+	if err != nil {
+		return data, err
+	}
+	head, err := coverprofile.ParseFile(ctx, headProfile)
+	if err != nil {
+		return data, err
+	}
+	data.Base, data.Head = base.Total(), head.Total()
+	for _, d := range coverprofile.Diff(base, head) {
+		if d.Base != d.Head {
+			data.Packages = append(data.Packages, d)
+		}
+	}
+	if data.Files, err = diffFiles(ctx, base, head, baseRef); err != nil {
+		return data, err
+	}
+	for _, f := range data.Files {
+		data.Gained += f.Gained
+		data.Lost += f.Lost
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return data, err
+	}
+	if err := diffTemplate.Execute(file, data); err != nil {
+		file.Close()
+		return data, err
+	}
+	return data, file.Close()
+}
+
+// diffFiles pairs the lines of every file in either profile. Files whose
+// coverage changed come first.
+func diffFiles(ctx context.Context, base, head *coverprofile.Profile, baseRef string) ([]diffFile, error) {
+	dirs, err := packageDirs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	top := ""
+	if baseRef != "" {
+		if top, err = gitOutput("rev-parse", "--show-toplevel"); err != nil {
+			return nil, err
+		}
+	}
+
+	baseBlocks, headBlocks := blocksByFile(base), blocksByFile(head)
+	names := sortedKeys(mergeMaps(baseBlocks, headBlocks))
+	files := make([]diffFile, 0, len(names))
+	for i, name := range names {
+		f := diffFile{ID: fmt.Sprintf("file-%d", i), Name: name}
+		baseStates, baseStats := lineStates(baseBlocks[name])
+		headStates, headStats := lineStates(headBlocks[name])
+		f.Base, f.Head = baseStats, headStats
+
+		headSource, headErr := os.ReadFile(sourcePath(name, dirs))
+		baseSource, baseErr := headSource, headErr
+		if baseRef != "" {
+			baseSource, baseErr = sourceAt(top, baseRef, sourcePath(name, dirs))
+		}
+		if headErr != nil && baseErr != nil {
+			f.Missing = true
+			files = append(files, f)
+			continue
+		}
+
+		baseLines, headLines := highlightGo(baseSource), highlightGo(headSource)
+		for _, pair := range alignLines(baseLines, headLines) {
+			var line diffLine
+			if i := pair[0]; i >= 0 {
+				line.Base = reportLine{Num: i + 1, Text: baseLines[i], State: baseStates[i+1]}
+			}
+			if i := pair[1]; i >= 0 {
+				line.Head = reportLine{Num: i + 1, Text: headLines[i], State: headStates[i+1]}
+			}
+			line.Change = lineChange(line)
+			switch line.Change {
+			case lineGained:
+				f.Gained++
+			case lineLost:
+				f.Lost++
+			}
+			f.Lines = append(f.Lines, line)
+		}
+		files = append(files, f)
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].Changed() && !files[j].Changed() })
+	return files, nil
+}
+
+func blocksByFile(p *coverprofile.Profile) map[string][]coverprofile.Block {
+	byFile := make(map[string][]coverprofile.Block)
+	for _, b := range p.Blocks {
+		byFile[b.File] = append(byFile[b.File], b)
+	}
+	return byFile
+}
+
+// sourceAt returns the content of a working tree file at rev
+func sourceAt(top, rev, file string) ([]byte, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
+	if resolved, err := filepath.EvalSymlinks(filepath.Dir(abs)); err == nil {
+		abs = filepath.Join(resolved, filepath.Base(abs))
+	}
+	if resolved, err := filepath.EvalSymlinks(top); err == nil {
+		top = resolved
+	}
+	rel, err := filepath.Rel(top, abs)
+	if err != nil {
+		return nil, err
+	}
+	out, err := exec.Command("git", "show", rev+":"+filepath.ToSlash(rel)).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git show: %w", commandError(err))
+	}
+	return out, nil
+}
+
+// lineChange tells whether a line gained or lost coverage. Lines that
+// aren't statements count as covered, so a new line that isn't covered
+// lost coverage; lines only the base has didn't change.
+func lineChange(line diffLine) string {
+	if line.Head.Num == 0 {
+		return ""
+	}
+	rank := map[string]int{lineUncovered: 0, linePartial: 1, lineCovered: 2, "": 2}
+	switch base, head := rank[line.Base.State], rank[line.Head.State]; {
+	case head > base:
+		return lineGained
+	case head < base:
+		return lineLost
+	}
+	return ""
+}
+
+// alignLines pairs the equal lines of two versions of a file, as the
+// indexes in a and b; a line only one version has is paired with -1
+func alignLines(a, b []template.HTML) [][2]int {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	pairs := make([][2]int, 0, max(len(a), len(b)))
+	for i := 0; i < prefix; i++ {
+		pairs = append(pairs, [2]int{i, i})
+	}
+	ma, mb := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(ma)*len(mb) <= maxAlignCells {
+		// Longest common subsequence of the changed part
+		lcs := make([][]int32, len(ma)+1)
+		for i := range lcs {
+			lcs[i] = make([]int32, len(mb)+1)
+		}
+		for i := len(ma) - 1; i >= 0; i-- {
+			for j := len(mb) - 1; j >= 0; j-- {
+				if ma[i] == mb[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(ma) && j < len(mb) {
+			switch {
+			case ma[i] == mb[j]:
+				pairs = append(pairs, [2]int{prefix + i, prefix + j})
+				i++
+				j++
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				pairs = append(pairs, [2]int{prefix + i, -1})
+				i++
+			default:
+				pairs = append(pairs, [2]int{-1, prefix + j})
+				j++
+			}
+		}
+		ma, mb = ma[i:], mb[j:]
+	}
+	for i := range ma {
+		pairs = append(pairs, [2]int{len(a) - suffix - len(ma) + i, -1})
+	}
+	for j := range mb {
+		pairs = append(pairs, [2]int{-1, len(b) - suffix - len(mb) + j})
+	}
+	for i := 0; i < suffix; i++ {
+		pairs = append(pairs, [2]int{len(a) - suffix + i, len(b) - suffix + i})
+	}
+	return pairs
+}
+
+var diffTemplate = template.Must(template.New("diff").Funcs(template.FuncMap{
+	"percent": func(s coverprofile.PackageStats) string { return fmt.Sprintf("%.1f%%", s.Percent()) },
+	"delta": func(base, head coverprofile.PackageStats) string {
+		return fmt.Sprintf("%+.1f%%", head.Percent()-base.Percent())
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>gotest coverage diff</title>
+<style>
+body { margin: 0; font: 14px -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; color: #222; display: flex; }
+nav { width: 280px; height: 100vh; overflow-y: auto; position: sticky; top: 0; background: #f6f8fa; border-right: 1px solid #ddd; padding: 12px; box-sizing: border-box; flex-shrink: 0; }
+nav a { display: block; color: #0366d6; text-decoration: none; padding: 2px 0; white-space: nowrap; overflow: hidden; text-overflow: ellipsis; }
+nav h3 { margin: 16px 0 4px; font-size: 12px; text-transform: uppercase; color: #666; }
+main { flex: 1; padding: 16px 24px; min-width: 0; }
+table { border-collapse: collapse; margin-bottom: 24px; }
+th, td { text-align: left; padding: 4px 12px 4px 0; border-bottom: 1px solid #eee; }
+td.num { text-align: right; }
+.up { color: #22863a; } .down { color: #cb2431; font-weight: bold; } .skip { color: #6a737d; }
+.source { font: 12px monospace; border-collapse: collapse; width: 100%; table-layout: fixed; }
+.source td { padding: 0 8px; border: 0; white-space: pre-wrap; word-break: break-all; }
+.source td.ln { color: #999; text-align: right; user-select: none; width: 4em; }
+.source td.mark { width: 1.5em; text-align: center; user-select: none; }
+.source td.gone { background: #f6f8fa; }
+td.cov { background: #e6ffed; } td.unc { background: #ffeef0; } td.part { background: #fff5b1; }
+tr.up td.mark { background: #acf2bd; } tr.down td.mark { background: #fdb8c0; }
+.source .kw { color: #d73a49; } .source .str { color: #032f62; } .source .num, .source .bi { color: #005cc5; }
+.source .fn { color: #6f42c1; } .source .com { color: #6a737d; font-style: italic; }
+details { margin-bottom: 8px; } summary { cursor: pointer; }
+</style>
+</head>
+<body>
+<nav>
+<a href="#summary"><b>Summary</b></a>
+{{if .Packages}}<a href="#packages">Packages</a>{{end}}
+<h3>Files</h3>
+{{range .Files}}<a href="#{{.ID}}" title="{{.Name}}">{{if .Gained}}<span class="up">+{{.Gained}}</span> {{end}}{{if .Lost}}<span class="down">-{{.Lost}}</span> {{end}}{{.Name}}</a>
+{{end}}
+</nav>
+<main>
+<h1 id="summary">Coverage {{percent .Base}} &rarr; {{percent .Head}} <small class="{{if lt .Head.Percent .Base.Percent}}down{{else}}up{{end}}">{{delta .Base .Head}}</small></h1>
+<table>
+<tr><th>Base</th><td>{{.BaseProfile}}{{if .BaseRef}} at {{.BaseRef}}{{end}}</td><td class="num">{{percent .Base}} ({{.Base.Covered}}/{{.Base.Statements}} statements)</td></tr>
+<tr><th>Head</th><td>{{.HeadProfile}}</td><td class="num">{{percent .Head}} ({{.Head.Covered}}/{{.Head.Statements}} statements)</td></tr>
+<tr><th>Lines</th><td colspan="2"><span class="up">{{.Gained}} gained coverage</span>, <span class="down">{{.Lost}} lost coverage</span></td></tr>
+</table>
+{{if not .BaseRef}}<p class="skip">Both profiles are shown against the source in the working tree; pass --base-ref when the base profile was written for other source.</p>{{end}}
+
+{{if .Packages}}
+<h2 id="packages">Packages</h2>
+<table>
+<tr><th>Package</th><th>Base</th><th>Head</th><th>Delta</th></tr>
+{{range .Packages}}<tr><td>{{.Package}}</td><td class="num">{{if .Base.Statements}}{{percent .Base}}{{else}}-{{end}}</td><td class="num">{{if .Head.Statements}}{{percent .Head}}{{else}}-{{end}}</td><td class="num">{{delta .Base .Head}}</td></tr>
+{{end}}
+</table>
+{{end}}
+
+<h2>Files</h2>
+{{range .Files}}
+<details id="{{.ID}}"{{if .Changed}} open{{end}}><summary><b>{{.Name}}</b> &middot; {{percent .Base}} &rarr; {{percent .Head}}{{if .Gained}} &middot; <span class="up">{{.Gained}} line(s) gained</span>{{end}}{{if .Lost}} &middot; <span class="down">{{.Lost}} line(s) lost</span>{{end}}</summary>
+{{if .Missing}}<p class="skip">Source not found.</p>{{else}}
+<table class="source">
+{{range .Lines}}<tr{{if .Change}} class="{{.Change}}"{{end}}>{{template "side" .Base}}<td class="mark">{{if eq .Change "up"}}&#9650;{{else if eq .Change "down"}}&#9660;{{end}}</td>{{template "side" .Head}}</tr>
+{{end}}</table>{{end}}
+</details>
+{{end}}
+</main>
+</body>
+</html>
+{{define "side"}}{{if .Num}}<td class="ln">{{.Num}}</td><td{{if .State}} class="{{.State}}"{{end}}>{{.Text}}</td>{{else}}<td class="ln gone"></td><td class="gone"></td>{{end}}{{end}}`))
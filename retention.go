@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// History retention from the config file or "gotest history prune"; zero
+// keeps everything
+var (
+	historyKeep     time.Duration
+	historyKeepRuns int
+)
+
+// parseRetention parses a retention age: a Go duration, or a number of
+// days or weeks such as "90d" or "12w"
+func parseRetention(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(value, suffix); ok {
+			if days, err := strconv.Atoi(n); err == nil && days > 0 {
+				return time.Duration(days) * unit, nil
+			}
+		}
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid retention %q (expected e.g. 90d, 12w or 720h)", value)
+	}
+	return d, nil
+}
+
+// parseKeepRuns parses a number of runs to keep
+func parseKeepRuns(value string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid number of runs %q", value)
+	}
+	return n, nil
+}
+
+// pruneHistory drops the runs older than keep and all but the last
+// keepRuns runs from the history, together with their artifact
+// directories. It returns the number of runs dropped.
+func pruneHistory(keep time.Duration, keepRuns int) (int, error) {
+	if keep <= 0 && keepRuns <= 0 {
+		return 0, nil
+	}
+	runs, err := loadHistory()
+	if err != nil {
+		return 0, err
+	}
+
+	var kept, dropped []historyRun
+	cutoff := time.Now().Add(-keep)
+	for i, run := range runs {
+		tooOld := keep > 0 && run.Started.Before(cutoff)
+		tooMany := keepRuns > 0 && i < len(runs)-keepRuns
+		if tooOld || tooMany {
+			dropped = append(dropped, run)
+		} else {
+			kept = append(kept, run)
+		}
+	}
+	if len(dropped) == 0 {
+		return 0, nil
+	}
+
+	if err := writeHistory(kept); err != nil {
+		return 0, err
+	}
+	for _, run := range dropped {
+		removeArtifacts(run.ArtifactDir)
+	}
+	return len(dropped), nil
+}
+
+// writeHistory replaces the history with runs, through a temporary file so
+// an interrupted write never loses it
+func writeHistory(runs []historyRun) error {
+	path, err := historyPath()
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".history-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	enc := json.NewEncoder(tmp)
+	for _, run := range runs {
+		if err := enc.Encode(run); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// removeArtifacts deletes the artifact directory of a run. Only
+// directories that look like gotest made them are removed, as the history
+// may be edited by hand.
+func removeArtifacts(dir string) {
+	if dir == "" {
+		return
+	}
+	if _, err := os.Stat(filepath.Join(dir, "summary.json")); err != nil {
+		return
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		warnf("could not remove artifacts %s: %v", dir, err)
+	} else {
+		debugf("removed artifacts %s", dir)
+	}
+}
+
+// runHistory implements "gotest history prune [--keep age] [--keep-runs n]":
+// without flags, the retention from the config file applies
+func runHistory(args []string) error {
+	const usageText = "usage: gotest history prune [--keep <age>] [--keep-runs <n>] [options]"
+	if len(args) == 0 || args[0] != "prune" {
+		return withExitCode(exitToolError, fmt.Errorf(usageText))
+	}
+
+	var keep time.Duration
+	var keepRuns int
+	var rest []string
+	args = args[1:]
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case isFlag(arg, "--keep", "-keep"):
+			value, _ := flagValue(args, &i, "--keep", "-keep")
+			d, err := parseRetention(value)
+			if err != nil {
+				return withExitCode(exitToolError, err)
+			}
+			keep = d
+		case isFlag(arg, "--keep-runs", "-keep-runs"):
+			value, _ := flagValue(args, &i, "--keep-runs", "-keep-runs")
+			n, err := parseKeepRuns(value)
+			if err != nil {
+				return withExitCode(exitToolError, err)
+			}
+			keepRuns = n
+		default:
+			rest = append(rest, arg)
+		}
+	}
+
+	// Other options select the config file and profile
+	parseFlags(rest)
+	if chdir != "" {
+		if err := os.Chdir(chdir); err != nil {
+			return withExitCode(exitToolError, fmt.Errorf("changing directory: %w", err))
+		}
+	}
+	if keep == 0 && keepRuns == 0 {
+		if err := applyConfig(); err != nil {
+			return withExitCode(exitToolError, err)
+		}
+		keep, keepRuns = historyKeep, historyKeepRuns
+	}
+	if keep == 0 && keepRuns == 0 {
+		return withExitCode(exitToolError, fmt.Errorf("no retention configured; give --keep or --keep-runs, or set history.keep or history.keep_runs in %s", configFileName))
+	}
+
+	n, err := pruneHistory(keep, keepRuns)
+	if err != nil {
+		return fmt.Errorf("pruning run history: %w", err)
+	}
+	fmt.Printf("Pruned %d run(s) from the history\n", n)
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// sanitizerPlatforms lists the GOOS/GOARCH pairs supporting each sanitizer
+var sanitizerPlatforms = map[string][]string{
+	"msan": {"linux/amd64", "linux/arm64", "linux/loong64", "freebsd/amd64"},
+	"asan": {"linux/amd64", "linux/arm64", "linux/loong64", "linux/ppc64le", "linux/riscv64"},
+}
+
+// sanitizerNames are the runtime names used in sanitizer reports
+var sanitizerNames = map[string]string{
+	"msan": "MemorySanitizer",
+	"asan": "AddressSanitizer",
+}
+
+// setupSanitizer verifies that the target platform and C toolchain support
+// the sanitizer and sets the environment it needs: cgo must be enabled, and
+// msan only works with clang.
+func setupSanitizer(name string) error {
+	out, err := goCommand("env", "GOOS", "GOARCH").Output()
+	if err != nil {
+		return fmt.Errorf("reading go env: %w", err)
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		return fmt.Errorf("unexpected go env output %q", out)
+	}
+	platform := fields[0] + "/" + fields[1]
+
+	supported := false
+	for _, p := range sanitizerPlatforms[name] {
+		if p == platform {
+			supported = true
+		}
+	}
+	if !supported {
+		return fmt.Errorf("-%s is not supported on %s (supported: %s)", name, platform, strings.Join(sanitizerPlatforms[name], ", "))
+	}
+
+	if goEnv["CGO_ENABLED"] == "0" {
+		return fmt.Errorf("-%s requires cgo, but CGO_ENABLED=0", name)
+	}
+	goEnv["CGO_ENABLED"] = "1"
+
+	cc := goEnv["CC"]
+	if cc == "" {
+		cc = os.Getenv("CC")
+	}
+	if cc == "" {
+		candidates := []string{"clang", "gcc"}
+		if name == "msan" {
+			candidates = []string{"clang"}
+		}
+		for _, candidate := range candidates {
+			if _, err := exec.LookPath(candidate); err == nil {
+				cc = candidate
+				break
+			}
+		}
+		if cc == "" {
+			return fmt.Errorf("-%s requires a C compiler (%s) in PATH", name, strings.Join(candidates, " or "))
+		}
+		goEnv["CC"] = cc
+	}
+	if name == "msan" && !strings.Contains(cc, "clang") {
+		warnf("-msan requires clang, but CC=%s", cc)
+	}
+
+	if verbose {
+		fmt.Printf("Sanitizer: -%s on %s with CC=%s\n", name, platform, cc)
+	}
+	return nil
+}
+
+// parseSanitizerReports extracts the sanitizer reports from test output. A
+// report starts at the "==pid==ERROR: <Sanitizer>:" (or WARNING) line and
+// ends at its SUMMARY line.
+func parseSanitizerReports(output string) []string {
+	var reports []string
+	var current []string
+	inReport := false
+
+	for _, line := range strings.Split(output, "\n") {
+		if !inReport {
+			if strings.HasPrefix(line, "==") && strings.Contains(line, "Sanitizer:") &&
+				(strings.Contains(line, "ERROR:") || strings.Contains(line, "WARNING:")) {
+				inReport = true
+				current = []string{line}
+			}
+			continue
+		}
+		current = append(current, line)
+		if strings.HasPrefix(line, "SUMMARY:") {
+			reports = append(reports, strings.Join(current, "\n"))
+			inReport = false
+		}
+	}
+	if inReport {
+		reports = append(reports, strings.Join(current, "\n"))
+	}
+	return reports
+}
+
+// printSanitizerReports prints sanitizer findings in their own section
+func printSanitizerReports(name string, reports []string) {
+	if len(reports) == 0 {
+		return
+	}
+	title := strings.ToUpper(sanitizerNames[name])
+	fmt.Printf("\n--- %s FINDINGS (%d) ---\n", title, len(reports))
+	for i, report := range reports {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Println(report)
+	}
+	fmt.Println(strings.Repeat("-", len(title)+19))
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Hoofffman/gotest/pkg/coverprofile"
+)
+
+// runScaffold implements "gotest scaffold [-w] <package> [profile]": table
+// driven test skeletons for the exported functions and methods of a
+// package that the coverage profile shows never ran, printed or, with -w,
+// added to the test file next to each source file
+func runScaffold(args []string) error {
+	const usageText = "usage: gotest scaffold [-w] <package> [profile]"
+	profile := "/tmp/cover.out"
+	var pkg string
+	var write, haveProfile bool
+	for _, arg := range args {
+		switch {
+		case arg == "-w" || arg == "--write" || arg == "-write":
+			write = true
+		case strings.HasPrefix(arg, "-"):
+			return withExitCode(exitToolError, fmt.Errorf("unknown flag %s\n%s", arg, usageText))
+		case pkg == "":
+			pkg = arg
+		case !haveProfile:
+			profile, haveProfile = arg, true
+		default:
+			return withExitCode(exitToolError, fmt.Errorf("unexpected argument %s\n%s", arg, usageText))
+		}
+	}
+	if pkg == "" {
+		return withExitCode(exitToolError, fmt.Errorf(usageText))
+	}
+	dir, err := filepath.Abs(pkg)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return withExitCode(exitToolError, fmt.Errorf("%s is not a package directory", pkg))
+	}
+
+	ctx := context.Background()
+	p, err := coverprofile.ParseFile(ctx, profile)
+	if err != nil {
+		return fmt.Errorf("reading coverage profile: %w", err)
+	}
+	dirs, err := packageDirs(ctx)
+	if err != nil {
+		return err
+	}
+	blocks := make(map[string][]coverprofile.Block)
+	for _, b := range p.Blocks {
+		if abs, err := filepath.Abs(sourcePath(b.File, dirs)); err == nil && filepath.Dir(abs) == dir {
+			blocks[abs] = append(blocks[abs], b)
+		}
+	}
+	if len(blocks) == 0 {
+		return fmt.Errorf("%s has no coverage data in %s; run gotest on it first", pkg, profile)
+	}
+
+	existing := testFunctionNames(dir)
+	files, err := scaffoldTests(dir, blocks, existing)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		fmt.Fprintf(os.Stderr, "No uncovered exported functions without a test in %s\n", pkg)
+		return nil
+	}
+
+	for _, f := range files {
+		rel := filepath.Join(pkg, filepath.Base(f.path))
+		if !write {
+			fmt.Printf("// %s\n%s\n", rel, f.source())
+			continue
+		}
+		if err := f.write(); errors.Is(err, errExternalTests) {
+			warnf("%s: skipped, %v", rel, err)
+			continue
+		} else if err != nil {
+			return fmt.Errorf("%s: %w", rel, err)
+		}
+		fmt.Printf("Added %d test(s) to %s\n", len(f.tests), rel)
+	}
+	return nil
+}
+
+// errExternalTests means a test file is an external _test package, where
+// skeletons calling the package's functions unqualified wouldn't compile
+var errExternalTests = errors.New("the tests are in package")
+
+// scaffoldFile holds the generated tests for one test file
+type scaffoldFile struct {
+	path    string
+	pkgName string
+	// imports are import specs as written in the source, e.g. `"io"` or
+	// `pb "example.com/proto"`
+	imports []string
+	tests   []string
+}
+
+// scaffoldTests generates the skeletons for the uncovered exported
+// functions of each source file in dir whose test is not in existing
+func scaffoldTests(dir string, blocks map[string][]coverprofile.Block, existing map[string]bool) ([]*scaffoldFile, error) {
+	names, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	fset := token.NewFileSet()
+	var files []*scaffoldFile
+	for _, name := range names {
+		base := filepath.Base(name)
+		if strings.HasSuffix(base, "_test.go") {
+			continue
+		}
+		if ok, err := build.Default.MatchFile(dir, base); err != nil || !ok {
+			continue
+		}
+		file, err := parser.ParseFile(fset, name, nil, parser.ParseComments|parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		if ast.IsGenerated(file) {
+			continue
+		}
+		out := &scaffoldFile{path: filepath.Join(dir, strings.TrimSuffix(base, ".go")+"_test.go"), pkgName: file.Name.Name}
+		imports := make(map[string]bool)
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil || !fn.Name.IsExported() {
+				continue
+			}
+			if fn.Recv != nil && !ast.IsExported(receiverName(fn.Recv.List[0].Type)) {
+				continue
+			}
+			testName := "Test" + strings.ReplaceAll(funcName(fn), ".", "_")
+			if existing[testName] || !uncovered(fset, fn, blocks[name]) {
+				continue
+			}
+			if fn.Type.TypeParams != nil || fn.Recv != nil && genericReceiver(fn.Recv.List[0].Type) {
+				warnf("%s: skipped generic %s", localPath(name), funcName(fn))
+				continue
+			}
+			out.tests = append(out.tests, tableTest(fset, fn, testName))
+			for _, spec := range usedImports(file, fn) {
+				imports[spec] = true
+			}
+		}
+		if len(out.tests) == 0 {
+			continue
+		}
+		imports[`"testing"`] = true
+		if strings.Contains(strings.Join(out.tests, ""), "reflect.DeepEqual") {
+			imports[`"reflect"`] = true
+		}
+		out.imports = sortedKeys(imports)
+		files = append(files, out)
+	}
+	return files, nil
+}
+
+// uncovered reports whether fn has statements and none of them ran
+func uncovered(fset *token.FileSet, fn *ast.FuncDecl, blocks []coverprofile.Block) bool {
+	start, end := fset.Position(fn.Pos()), fset.Position(fn.End())
+	statements := 0
+	for _, b := range blocks {
+		if before(b.StartLine, b.StartCol, start) || !before(b.StartLine, b.StartCol, end) {
+			continue
+		}
+		if b.Count > 0 {
+			return false
+		}
+		statements += b.NumStmt
+	}
+	return statements > 0
+}
+
+// tableTest writes the skeleton of a table driven test of fn in the style
+// of gotests: a case struct with the arguments and wanted results, and a
+// subtest per case comparing them
+func tableTest(fset *token.FileSet, fn *ast.FuncDecl, testName string) string {
+	var args, params []string
+	if fn.Type.Params != nil {
+		for _, field := range fn.Type.Params.List {
+			typ := typeString(fset, field.Type, true)
+			names := field.Names
+			if len(names) == 0 {
+				names = []*ast.Ident{{Name: "_"}}
+			}
+			for _, n := range names {
+				name := n.Name
+				if name == "_" {
+					name = fmt.Sprintf("arg%d", len(args))
+				}
+				args = append(args, name+" "+typ)
+				param := "tt.args." + name
+				if _, ok := field.Type.(*ast.Ellipsis); ok {
+					param += "..."
+				}
+				params = append(params, param)
+			}
+		}
+	}
+
+	var gots, wants []string
+	var wantTypes []string
+	wantErr := false
+	if fn.Type.Results != nil {
+		for _, field := range fn.Type.Results.List {
+			n := max(len(field.Names), 1)
+			for j := 0; j < n; j++ {
+				if ident, ok := field.Type.(*ast.Ident); ok && ident.Name == "error" {
+					wantErr = true
+					continue
+				}
+				suffix := ""
+				if len(wants) > 0 {
+					suffix = strconv.Itoa(len(wants))
+				}
+				gots, wants = append(gots, "got"+suffix), append(wants, "want"+suffix)
+				wantTypes = append(wantTypes, typeString(fset, field.Type, false))
+			}
+		}
+	}
+
+	call := fn.Name.Name + "(" + strings.Join(params, ", ") + ")"
+	display := fn.Name.Name
+	if fn.Recv != nil {
+		call = "tt.receiver." + call
+		display = funcName(fn)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "func %s(t *testing.T) {\n", testName)
+	if len(args) > 0 {
+		fmt.Fprintf(&b, "type args struct {\n%s\n}\n", strings.Join(args, "\n"))
+	}
+	b.WriteString("tests := []struct {\nname string\n")
+	if fn.Recv != nil {
+		fmt.Fprintf(&b, "receiver %s\n", typeString(fset, fn.Recv.List[0].Type, false))
+	}
+	if len(args) > 0 {
+		b.WriteString("args args\n")
+	}
+	for i, want := range wants {
+		fmt.Fprintf(&b, "%s %s\n", want, wantTypes[i])
+	}
+	if wantErr {
+		b.WriteString("wantErr bool\n")
+	}
+	b.WriteString("}{\n// TODO: add test cases.\n}\n")
+	b.WriteString("for _, tt := range tests {\nt.Run(tt.name, func(t *testing.T) {\n")
+
+	results := append([]string(nil), gots...)
+	if wantErr {
+		results = append(results, "err")
+	}
+	if len(results) > 0 {
+		fmt.Fprintf(&b, "%s := %s\n", strings.Join(results, ", "), call)
+	} else {
+		fmt.Fprintf(&b, "%s\n", call)
+	}
+	if wantErr {
+		fmt.Fprintf(&b, "if (err != nil) != tt.wantErr {\nt.Fatalf(\"%s() error = %%v, wantErr %%v\", err, tt.wantErr)\n}\n", display)
+	}
+	for i, got := range gots {
+		fmt.Fprintf(&b, "if !reflect.DeepEqual(%s, tt.%s) {\nt.Errorf(\"%s() %s = %%v, want %%v\", %s, tt.%s)\n}\n", got, wants[i], display, got, got, wants[i])
+	}
+	b.WriteString("})\n}\n}\n")
+	return b.String()
+}
+
+// genericReceiver reports whether a method receiver has type parameters,
+// such as *T[K]
+func genericReceiver(expr ast.Expr) bool {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	switch expr.(type) {
+	case *ast.IndexExpr, *ast.IndexListExpr:
+		return true
+	}
+	return false
+}
+
+// typeString prints a type expression; variadic parameters become slices
+// when asField is set
+func typeString(fset *token.FileSet, expr ast.Expr, asField bool) string {
+	if ellipsis, ok := expr.(*ast.Ellipsis); ok && asField {
+		return "[]" + typeString(fset, ellipsis.Elt, false)
+	}
+	var buf bytes.Buffer
+	printer.Fprint(&buf, fset, expr)
+	return buf.String()
+}
+
+// usedImports returns the import specs of file that the signature of fn
+// refers to
+func usedImports(file *ast.File, fn *ast.FuncDecl) []string {
+	used := make(map[string]bool)
+	ast.Inspect(fn.Type, func(node ast.Node) bool {
+		if sel, ok := node.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok {
+				used[ident.Name] = true
+			}
+		}
+		return true
+	})
+	if fn.Recv != nil {
+		ast.Inspect(fn.Recv, func(node ast.Node) bool {
+			if sel, ok := node.(*ast.SelectorExpr); ok {
+				if ident, ok := sel.X.(*ast.Ident); ok {
+					used[ident.Name] = true
+				}
+			}
+			return true
+		})
+	}
+
+	var specs []string
+	for _, spec := range file.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		name := path[strings.LastIndex(path, "/")+1:]
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		if used[name] {
+			text := spec.Path.Value
+			if spec.Name != nil {
+				text = spec.Name.Name + " " + text
+			}
+			specs = append(specs, text)
+		}
+	}
+	return specs
+}
+
+// testFunctionNames returns the names of the functions declared in the
+// test files of dir
+func testFunctionNames(dir string) map[string]bool {
+	names := make(map[string]bool)
+	locations, _ := testFunctions(dir)
+	for name := range locations {
+		names[name] = true
+	}
+	return names
+}
+
+// source returns the tests as a complete test file
+func (f *scaffoldFile) source() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "package %s\n\nimport (\n%s\n)\n", f.pkgName, strings.Join(f.imports, "\n"))
+	for _, test := range f.tests {
+		b.WriteString("\n" + test)
+	}
+	return formatSource(b.String())
+}
+
+// write creates the test file, or appends the tests to it, importing what
+// it doesn't import yet
+func (f *scaffoldFile) write() error {
+	src, err := os.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return os.WriteFile(f.path, []byte(f.source()), 0644)
+	}
+	if err != nil {
+		return err
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), f.path, src, parser.ImportsOnly)
+	if err != nil {
+		return err
+	}
+	if file.Name.Name != f.pkgName {
+		return fmt.Errorf("%w %s", errExternalTests, file.Name.Name)
+	}
+
+	have := make(map[string]bool)
+	for _, spec := range file.Imports {
+		have[spec.Path.Value] = true
+	}
+	var missing []string
+	for _, spec := range f.imports {
+		if !have[spec[strings.Index(spec, `"`):]] {
+			missing = append(missing, spec)
+		}
+	}
+
+	// New imports go after the last import declaration
+	offset := int(file.Name.End()) - 1
+	if len(file.Decls) > 0 {
+		offset = int(file.Decls[len(file.Decls)-1].End()) - 1
+	}
+	var b strings.Builder
+	b.Write(src[:offset])
+	if len(missing) > 0 {
+		fmt.Fprintf(&b, "\n\nimport (\n%s\n)\n", strings.Join(missing, "\n"))
+	}
+	b.Write(src[offset:])
+	for _, test := range f.tests {
+		b.WriteString("\n" + test)
+	}
+	return os.WriteFile(f.path, []byte(formatSource(b.String())), 0644)
+}
+
+// formatSource gofmts generated source, leaving it as is if it doesn't
+// parse
+func formatSource(src string) string {
+	out, err := format.Source([]byte(src))
+	if err != nil {
+		return src
+	}
+	return string(out)
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// releaseRepo is the GitHub repository releases are published to. Release
+// archives are named gotest_<version>_<os>_<arch>.tar.gz (.zip on Windows)
+// and listed with their SHA-256 in a *checksums.txt asset.
+const releaseRepo = "Hoofffman/gotest"
+
+// maxReleaseAsset bounds downloads so a bad response can't fill memory
+const maxReleaseAsset = 100 << 20
+
+type githubRelease struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// runSelfUpdate implements "gotest self-update [--check] [--force]"
+func runSelfUpdate(args []string) error {
+	var check, force bool
+	for _, arg := range args {
+		switch arg {
+		case "--check", "-check":
+			check = true
+		case "--force", "-force":
+			force = true
+		default:
+			return fmt.Errorf("usage: gotest self-update [--check] [--force]")
+		}
+	}
+
+	current, _, _ := buildVersion()
+	release, err := latestRelease()
+	if err != nil {
+		return fmt.Errorf("checking for updates: %w", err)
+	}
+	latest := release.TagName
+
+	switch cmp := compareVersions(current, latest); {
+	case cmp == 0 && !force:
+		fmt.Printf("gotest %s is up to date\n", current)
+		return nil
+	case cmp > 0 && !force:
+		fmt.Printf("gotest %s is newer than the latest release %s\n", current, latest)
+		return nil
+	}
+	if check {
+		fmt.Printf("gotest %s is available (installed: %s)\n", latest, current)
+		return nil
+	}
+
+	archive, checksums := releaseAssets(release)
+	if archive == "" {
+		return fmt.Errorf("release %s has no archive for %s/%s", latest, runtime.GOOS, runtime.GOARCH)
+	}
+	if checksums == "" {
+		return fmt.Errorf("release %s has no checksums; refusing to install it", latest)
+	}
+
+	fmt.Printf("Downloading gotest %s...\n", latest)
+	data, err := download(release.assetURL(archive))
+	if err != nil {
+		return fmt.Errorf("downloading %s: %w", archive, err)
+	}
+	sums, err := download(release.assetURL(checksums))
+	if err != nil {
+		return fmt.Errorf("downloading %s: %w", checksums, err)
+	}
+	if err := verifyChecksum(data, archive, sums); err != nil {
+		return err
+	}
+
+	binary, err := extractBinary(archive, data)
+	if err != nil {
+		return fmt.Errorf("extracting %s: %w", archive, err)
+	}
+
+	path, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("locating gotest executable: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	if err := replaceExecutable(path, binary); err != nil {
+		return fmt.Errorf("replacing %s: %w", path, err)
+	}
+	fmt.Printf("Updated %s from %s to %s\n", path, current, latest)
+	return nil
+}
+
+// latestRelease asks the GitHub API for the latest release. GITHUB_TOKEN is
+// used if set, to avoid the anonymous rate limit.
+func latestRelease() (*githubRelease, error) {
+	req, err := http.NewRequest("GET", "https://api.github.com/repos/"+releaseRepo+"/releases/latest", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GitHub API: %s", resp.Status)
+	}
+
+	var release githubRelease
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return nil, fmt.Errorf("decoding release: %w", err)
+	}
+	if release.TagName == "" {
+		return nil, fmt.Errorf("no release found")
+	}
+	return &release, nil
+}
+
+// releaseAssets returns the names of the archive for this platform and of
+// the checksum file
+func releaseAssets(release *githubRelease) (archive, checksums string) {
+	suffix := ".tar.gz"
+	if runtime.GOOS == "windows" {
+		suffix = ".zip"
+	}
+	platform := "_" + runtime.GOOS + "_" + runtime.GOARCH + suffix
+	for _, a := range release.Assets {
+		switch {
+		case strings.HasPrefix(a.Name, "gotest_") && strings.HasSuffix(a.Name, platform):
+			archive = a.Name
+		case strings.HasSuffix(a.Name, "checksums.txt"):
+			checksums = a.Name
+		}
+	}
+	return archive, checksums
+}
+
+func (r *githubRelease) assetURL(name string) string {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.URL
+		}
+	}
+	return ""
+}
+
+func download(url string) ([]byte, error) {
+	client := http.Client{Timeout: 5 * time.Minute}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxReleaseAsset+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxReleaseAsset {
+		return nil, fmt.Errorf("larger than %d MB", maxReleaseAsset>>20)
+	}
+	return data, nil
+}
+
+// verifyChecksum checks data against its entry in a sha256sum-style
+// checksum file
+func verifyChecksum(data []byte, name string, checksums []byte) error {
+	sum := sha256.Sum256(data)
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || strings.TrimPrefix(fields[1], "*") != name {
+			continue
+		}
+		if !strings.EqualFold(fields[0], hex.EncodeToString(sum[:])) {
+			return fmt.Errorf("checksum mismatch for %s; not installing it", name)
+		}
+		return nil
+	}
+	return fmt.Errorf("no checksum listed for %s; not installing it", name)
+}
+
+// extractBinary returns the gotest executable from a release archive
+func extractBinary(name string, data []byte) ([]byte, error) {
+	want := "gotest"
+	if runtime.GOOS == "windows" {
+		want = "gotest.exe"
+	}
+
+	if strings.HasSuffix(name, ".zip") {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range zr.File {
+			if filepath.Base(f.Name) != want {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer rc.Close()
+			return io.ReadAll(io.LimitReader(rc, maxReleaseAsset))
+		}
+		return nil, fmt.Errorf("%s not found in archive", want)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s not found in archive", want)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag == tar.TypeReg && filepath.Base(hdr.Name) == want {
+			return io.ReadAll(io.LimitReader(tr, maxReleaseAsset))
+		}
+	}
+}
+
+// replaceExecutable atomically replaces the binary at path: the new binary
+// is written next to it and renamed over it. Windows can't replace a running
+// executable, so there the old one is moved aside first.
+func replaceExecutable(path string, binary []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".gotest-update-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return err
+	}
+
+	if runtime.GOOS == "windows" {
+		old := path + ".old"
+		os.Remove(old)
+		if err := os.Rename(path, old); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// compareVersions compares two vMAJOR.MINOR.PATCH versions. Development
+// builds, which aren't releases, always compare older.
+func compareVersions(a, b string) int {
+	pa, okA := parseVersion(a)
+	pb, okB := parseVersion(b)
+	switch {
+	case !okA && !okB:
+		return 0
+	case !okA:
+		return -1
+	case !okB:
+		return 1
+	}
+	for i := range pa {
+		if pa[i] != pb[i] {
+			if pa[i] < pb[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// parseVersion parses a release version; pre-release and pseudo-versions
+// are not releases
+func parseVersion(v string) ([3]int, bool) {
+	var parts [3]int
+	fields := strings.Split(strings.TrimPrefix(v, "v"), ".")
+	if len(fields) != 3 {
+		return parts, false
+	}
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			return parts, false
+		}
+		parts[i] = n
+	}
+	return parts, true
+}
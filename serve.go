@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiRun is a run in the /api/runs listing
+type apiRun struct {
+	RunID           string          `json:"run_id"`
+	Passed          bool            `json:"passed"`
+	Started         time.Time       `json:"started"`
+	DurationSeconds float64         `json:"duration_seconds"`
+	Coverage        summaryCoverage `json:"coverage"`
+	Failures        int             `json:"failures"`
+}
+
+// apiCoveragePoint is one run in /api/coverage/trend
+type apiCoveragePoint struct {
+	RunID   string    `json:"run_id"`
+	Started time.Time `json:"started"`
+	Percent float64   `json:"percent"`
+}
+
+// runServe implements "gotest serve [--addr host:port]": a read-only HTTP
+// API over the run history, plus the history dashboard at /. The history
+// is read again for every request, so new runs show up right away.
+func runServe(args []string) error {
+	addr := "localhost:8080"
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case isFlag(arg, "--addr", "-addr"):
+			addr, _ = flagValue(args, &i, "--addr", "-addr")
+		default:
+			return withExitCode(exitToolError, fmt.Errorf("unknown argument %s\nusage: gotest serve [--addr host:port]", arg))
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/runs", apiHandler(serveRuns))
+	mux.HandleFunc("/api/runs/", apiHandler(serveRun))
+	mux.HandleFunc("/api/coverage/trend", apiHandler(serveCoverageTrend))
+	mux.HandleFunc("/", serveDashboard)
+
+	fmt.Printf("Serving the run history on http://%s/ (API under /api/)\n", addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+// apiHandler wraps a handler returning a JSON value or an HTTP error
+func apiHandler(handler func(*http.Request, []historyRun) (any, int, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("the API is read-only"))
+			return
+		}
+		runs, err := loadHistory()
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+		value, status, err := handler(r, runs)
+		if err != nil {
+			writeJSONError(w, status, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(value)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// apiLimit returns the runs limited by the "limit" query parameter
+func apiLimit(r *http.Request, runs []historyRun) ([]historyRun, error) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return runs, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid limit %q", value)
+	}
+	return recentRuns(runs, n), nil
+}
+
+// serveRuns lists the runs with an ID, newest first
+func serveRuns(r *http.Request, runs []historyRun) (any, int, error) {
+	runs, err := apiLimit(r, runs)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	list := []apiRun{}
+	for i := len(runs) - 1; i >= 0; i-- {
+		run := runs[i]
+		if run.RunID == "" {
+			continue
+		}
+		item := apiRun{
+			RunID:           run.RunID,
+			Passed:          run.Passed,
+			Started:         run.Started,
+			DurationSeconds: run.DurationSeconds,
+			Coverage:        run.Coverage,
+		}
+		for _, pkg := range run.Packages {
+			item.Failures += len(pkg.Failures)
+		}
+		list = append(list, item)
+	}
+	return list, http.StatusOK, nil
+}
+
+// serveRun returns the full history entry of one run, by ID or unique
+// prefix
+func serveRun(r *http.Request, runs []historyRun) (any, int, error) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/runs/")
+	if id == "" || strings.Contains(id, "/") {
+		return nil, http.StatusNotFound, fmt.Errorf("not found")
+	}
+	run, err := findRun(runs, id)
+	if err != nil {
+		return nil, http.StatusNotFound, err
+	}
+	return run, http.StatusOK, nil
+}
+
+// serveCoverageTrend returns the total coverage of every run, oldest
+// first, or with ?package= the coverage of one package in the runs that
+// included it
+func serveCoverageTrend(r *http.Request, runs []historyRun) (any, int, error) {
+	runs, err := apiLimit(r, runs)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	pkg := r.URL.Query().Get("package")
+	points := []apiCoveragePoint{}
+	for _, run := range runs {
+		point := apiCoveragePoint{RunID: run.RunID, Started: run.Started, Percent: run.Coverage.Percent}
+		if pkg != "" {
+			pct, ok := run.PackageCoverage[pkg]
+			if !ok {
+				continue
+			}
+			point.Percent = pct
+		}
+		points = append(points, point)
+	}
+	return points, http.StatusOK, nil
+}
+
+// serveDashboard renders the history dashboard
+func serveDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	runs, err := loadHistory()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(runs) == 0 {
+		http.Error(w, "no runs recorded", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	dashboardTemplate.Execute(w, buildDashboard(recentRuns(runs, dashboardRuns)))
+}
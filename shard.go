@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Hoofffman/gotest/pkg/coverprofile"
+)
+
+// parseShard parses a shard specification of the form "i/n" where 1 <= i <= n
+func parseShard(value string) (int, int, error) {
+	parts := strings.Split(value, "/")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid --shard value %q (expected i/n)", value)
+	}
+	index, err1 := strconv.Atoi(parts[0])
+	count, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil || count < 1 || index < 1 || index > count {
+		return 0, 0, fmt.Errorf("invalid --shard value %q (expected i/n with 1 <= i <= n)", value)
+	}
+	return index, count, nil
+}
+
+// shardPackages returns the packages belonging to shard index (1-based) of
+// count. Packages are sorted first so every CI job computes the same split.
+func shardPackages(packages []string, index, count int) []string {
+	sorted := append([]string(nil), packages...)
+	sort.Strings(sorted)
+
+	var shard []string
+	for i, pkg := range sorted {
+		if i%count == index-1 {
+			shard = append(shard, pkg)
+		}
+	}
+	return shard
+}
+
+// runMerge implements "gotest merge", combining coverage profiles (typically
+// one per shard) into a single profile and printing its summary
+func runMerge(args []string) error {
+	out := "/tmp/cover.out"
+	var profiles []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case isFlag(arg, "-o", "--output", "-output"):
+			if value, ok := flagValue(args, &i, "-o", "--output", "-output"); ok {
+				out = value
+			}
+		default:
+			profiles = append(profiles, arg)
+		}
+	}
+
+	if len(profiles) == 0 {
+		return fmt.Errorf("usage: gotest merge [-o output] <profiles...>")
+	}
+
+	validateProfiles(context.Background(), profiles)
+	if err := coverprofile.MergeFiles(context.Background(), profiles, out); err != nil {
+		return fmt.Errorf("merging coverage profiles: %w", err)
+	}
+
+	fmt.Printf("Merged %d profile(s) into %s\n", len(profiles), out)
+	loadModulePaths(context.Background())
+	return displayCoverageStats(context.Background(), out, nil, nil)
+}
+
+// validateProfiles warns about problems in the profiles to merge: lines
+// that aren't blocks, blocks that don't fit together and mixed modes,
+// within or across the profiles. Profiles that can't be read are left to
+// the merge to report.
+func validateProfiles(ctx context.Context, paths []string) {
+	var modes []string
+	for _, path := range paths {
+		problems, err := coverprofile.ValidateFile(ctx, path)
+		if err != nil {
+			continue
+		}
+		if !problems.OK() {
+			warnf("%s: %s", path, problems)
+			for _, example := range problems.Examples {
+				warnf("  %s", example)
+			}
+		}
+		for _, mode := range problems.Modes {
+			if !slices.Contains(modes, mode) {
+				modes = append(modes, mode)
+			}
+		}
+	}
+	if len(modes) > 1 {
+		warnf("the profiles have mixed coverage modes (%s); merging in %s mode", strings.Join(modes, ", "), coverprofile.MergedMode(modes...))
+	}
+}
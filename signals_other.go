@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// forwardedSignals are passed on to the process running the test binary
+var forwardedSignals = []os.Signal{os.Interrupt}
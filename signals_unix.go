@@ -0,0 +1,13 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// forwardedSignals are passed on to the process running the test binary:
+// go test sends SIGQUIT to a binary that times out, for its goroutine
+// dump, and Ctrl+C reaches the whole process group
+var forwardedSignals = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/Hoofffman/gotest/pkg/runner"
+)
+
+// Output styles: --icons lists every package with a status icon after the
+// tests, --plain keeps all output pure ASCII without colors
+var (
+	iconOutput  bool
+	plainOutput bool
+)
+
+// statusIcon returns the icon of a package status, or an ASCII word in
+// plain mode
+func statusIcon(status runner.Status) string {
+	switch status {
+	case runner.StatusPassed:
+		if plainOutput {
+			return "ok  "
+		}
+		return colorize("✔", colorGreen)
+	case runner.StatusFailed, runner.StatusBuildFailed:
+		if plainOutput {
+			return "FAIL"
+		}
+		return colorize("✖", colorRed)
+	}
+	if plainOutput {
+		return "--  "
+	}
+	return "⊘"
+}
+
+// printPackageStatuses lists the packages of the run with an icon, their
+// status, duration and coverage in aligned columns
+func printPackageStatuses(result *runner.Result) {
+	if len(result.Packages) == 0 {
+		return
+	}
+	names := make([]string, len(result.Packages))
+	pkgCol := len("PACKAGE")
+	for i, res := range result.Packages {
+		names[i] = res.Package
+		if res.ImportPath != "" {
+			names[i] = localPath(res.ImportPath)
+		}
+		pkgCol = max(pkgCol, len(names[i]))
+	}
+	pkgCol = max(min(pkgCol, terminalWidth()-40), 20)
+
+	fmt.Println()
+	for i, res := range result.Packages {
+		duration := "-"
+		switch {
+		case res.Cached:
+			duration = "(cached)"
+		case res.Duration > 0:
+			duration = res.Duration.Round(res.Duration / 100).String()
+		}
+		coverage := "-"
+		if res.Coverage != nil {
+			coverage = fmt.Sprintf("%.1f%%", res.Coverage.Percent())
+		}
+		row := fmt.Sprintf("%s %-*s %-12s %10s %8s", statusIcon(res.Status), pkgCol, middleEllipsis(names[i], pkgCol), res.Status, duration, coverage)
+		fmt.Println(strings.TrimRight(row, " "))
+	}
+}
+
+// asciiOnly replaces every non-ASCII character with "?"
+func asciiOnly(s string) string {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return strings.Map(func(r rune) rune {
+				if r >= utf8.RuneSelf {
+					return '?'
+				}
+				return r
+			}, s)
+		}
+	}
+	return s
+}
+
+// asciiWriter passes output on with non-ASCII characters replaced, for
+// test output streamed in plain mode. A character split across writes is
+// held back until it is complete.
+type asciiWriter struct {
+	w       io.Writer
+	mu      sync.Mutex // go test's stdout and stderr are copied concurrently
+	partial []byte
+}
+
+func (a *asciiWriter) Write(p []byte) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	data := append(a.partial, p...)
+	// Hold back an incomplete character at the end
+	end := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				end = i
+			}
+			break
+		}
+	}
+	// data may share its array with a.partial, so it's written out first
+	_, err := io.WriteString(a.w, asciiOnly(string(data[:end])))
+	a.partial = append(a.partial[:0], data[end:]...)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAsciiOnly(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"plain text\n", "plain text\n"},
+		{"✓ ok", "? ok"},
+		{"naïve €", "na?ve ?"},
+		{"bad \xff byte", "bad ? byte"},
+	}
+	for _, tt := range tests {
+		if got := asciiOnly(tt.in); got != tt.want {
+			t.Errorf("asciiOnly(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAsciiWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{"whole characters", []string{"xé", "ab€\n"}, "x?ab?\n"},
+		// "é" is c3 a9 and "€" is e2 82 ac
+		{"characters split across writes", []string{"x\xc3", "\xa9ab\xe2\x82", "\xac\n"}, "x?ab?\n"},
+		{"one byte at a time", []string{"x", "\xc3", "\xa9", "a", "b", "\xe2", "\x82", "\xac", "\n"}, "x?ab?\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			w := &asciiWriter{w: &out}
+			for _, s := range tt.writes {
+				if n, err := w.Write([]byte(s)); n != len(s) || err != nil {
+					t.Fatalf("Write(%q) = %d, %v", s, n, err)
+				}
+			}
+			if out.String() != tt.want {
+				t.Errorf("wrote %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
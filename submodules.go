@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/Hoofffman/gotest/pkg/coverprofile"
+	"github.com/Hoofffman/gotest/pkg/discover"
+	"github.com/Hoofffman/gotest/pkg/runner"
+)
+
+// findSubmodules returns the directories below root that contain their own
+// go.mod, in the same "./dir" form used for packages
+func findSubmodules(ctx context.Context, root string) ([]string, error) {
+	return discover.Modules(ctx, discoverOptions(root))
+}
+
+// rootPath converts a directory given on the command line to the "./dir"
+// form used for packages
+func rootPath(dir string) string {
+	dir = filepath.Clean(dir)
+	if filepath.IsAbs(dir) || strings.HasPrefix(dir, "..") {
+		return dir
+	}
+	return "./" + filepath.ToSlash(dir)
+}
+
+// testSubmodules runs the tests of each nested module (or --root tree) in
+// its own go test invocation rooted in that directory. File names in the
+// module profiles are rewritten to paths relative to the current directory,
+// since the module's import paths can't be resolved from here, and merged
+// with rootProfile (if any) into coverProfile. The returned result combines
+// the output and package results of all modules.
+func testSubmodules(ctx context.Context, modules, userArgs []string, rootProfile, coverProfile string) (*runner.Result, error) {
+	combined := &runner.Result{}
+	tmpDir, err := os.MkdirTemp("", "gotest-modules-")
+	if err != nil {
+		return combined, fmt.Errorf("creating profile directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var profiles []string
+	if rootProfile != "" {
+		profiles = append(profiles, rootProfile)
+	}
+
+	var output strings.Builder
+	var testErr error
+	defer func() { combined.Output = output.String() }()
+
+	for i, mod := range modules {
+		packages, err := findGoPackages(ctx, mod)
+		if err != nil {
+			return combined, fmt.Errorf("finding go packages in %s: %w", mod, err)
+		}
+		packages = filterPatterns(packages, mod)
+		if len(packages) == 0 {
+			continue
+		}
+
+		if verbose {
+			fmt.Printf("\nModule %s: %d package(s)\n", mod, len(packages))
+		} else {
+			fmt.Printf("Testing module %s (%d package(s))...\n", mod, len(packages))
+		}
+
+		profile := filepath.Join(tmpDir, fmt.Sprintf("module-%d.out", i))
+		result, err := runTests(ctx, mod, packages, packages, userArgs, profile)
+		output.WriteString(result.Output)
+		combined.Packages = append(combined.Packages, result.Packages...)
+		if err != nil && testErr == nil {
+			testErr = fmt.Errorf("module %s: %w", mod, err)
+		}
+
+		if _, err := os.Stat(profile); err != nil {
+			continue
+		}
+		if err := relocateProfile(ctx, profile, mod); err != nil {
+			return combined, fmt.Errorf("rewriting profile for %s: %w", mod, err)
+		}
+		profiles = append(profiles, profile)
+	}
+
+	if err := coverprofile.MergeFiles(ctx, profiles, coverProfile); err != nil {
+		return combined, fmt.Errorf("merging coverage profiles: %w", err)
+	}
+
+	return combined, testErr
+}
+
+// relocateProfile rewrites the import-path file names in a profile produced
+// inside module dir to "./"-relative file paths
+func relocateProfile(ctx context.Context, profile, dir string) error {
+	cmd := goCommandContext(ctx, "list", "-e", "-f", "{{.ImportPath}}\t{{.Dir}}", "./...")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return err
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	dirs := make(map[string]string)
+	for _, line := range strings.Split(string(out), "\n") {
+		importPath, pkgDir, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		if rel, err := filepath.Rel(cwd, pkgDir); err == nil {
+			dirs[importPath] = "./" + filepath.ToSlash(rel)
+		}
+	}
+
+	p, err := coverprofile.ParseFile(ctx, profile)
+	if err != nil {
+		return err
+	}
+	for i, b := range p.Blocks {
+		if rel, ok := dirs[path.Dir(b.File)]; ok {
+			p.Blocks[i].File = rel + "/" + path.Base(b.File)
+		}
+	}
+	return p.WriteFile(profile)
+}
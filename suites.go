@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/Hoofffman/gotest/pkg/coverprofile"
+)
+
+// suiteConfig is a named test suite from the config file: a set of packages
+// with its own tags, environment, timeout and commands run around it
+type suiteConfig struct {
+	Packages []string
+	Tags     string
+	Env      map[string]string
+	Timeout  string
+	// Before runs before the tests, After always runs after them
+	Before []string
+	After  []string
+	// WaitFor must pass after Before and before the tests, within
+	// WaitTimeout
+	WaitFor     []readinessCheck
+	WaitTimeout time.Duration
+}
+
+// decodeSuite converts the YAML body of a suite into a suiteConfig
+func decodeSuite(value any, prefix string) (*suiteConfig, error) {
+	fields, err := yamlMap(value, prefix)
+	if err != nil {
+		return nil, err
+	}
+	s := &suiteConfig{WaitTimeout: defaultWaitTimeout}
+	for key, value := range fields {
+		name := prefix + "." + key
+		switch key {
+		case "packages":
+			s.Packages, err = yamlStringList(value, name)
+		case "tags":
+			s.Tags, err = yamlString(value, name)
+		case "env":
+			s.Env, err = yamlStringMap(value, name)
+		case "timeout":
+			if s.Timeout, err = yamlString(value, name); err == nil {
+				if _, parseErr := time.ParseDuration(s.Timeout); parseErr != nil {
+					err = fmt.Errorf("%s: invalid duration %q", name, s.Timeout)
+				}
+			}
+		case "before":
+			s.Before, err = yamlStringList(value, name)
+		case "after":
+			s.After, err = yamlStringList(value, name)
+		case "wait_for":
+			s.WaitFor, err = decodeReadinessChecks(value, name)
+		case "wait_timeout":
+			var timeout string
+			if timeout, err = yamlString(value, name); err == nil {
+				if s.WaitTimeout, err = time.ParseDuration(timeout); err != nil || s.WaitTimeout <= 0 {
+					err = fmt.Errorf("%s: invalid duration %q", name, timeout)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("unknown setting %q", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// suiteResult holds the outcome of one suite
+type suiteResult struct {
+	Name     string
+	Passed   bool
+	Coverage string
+	Profile  string
+	Duration time.Duration
+	Err      error
+}
+
+// runSuites implements "gotest suite <names...>|--all": each suite is run by
+// invoking gotest itself with the suite's packages and settings, between its
+// before and after commands, followed by a table of all suites and their
+// combined coverage. All other arguments are passed through to each run.
+func runSuites(args []string) error {
+	var names, passthrough []string
+	all := false
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--all" || args[i] == "-all":
+			all = true
+		case !strings.HasPrefix(args[i], "-") && len(passthrough) == 0:
+			names = append(names, args[i])
+		default:
+			passthrough = append(passthrough, args[i:]...)
+			i = len(args)
+		}
+	}
+	if len(names) == 0 && !all {
+		return fmt.Errorf("usage: gotest suite <names...>|--all [options] [go test flags...]")
+	}
+
+	// The options given for the runs also select the config file
+	parseFlags(passthrough)
+	path := configFile
+	if path == "" {
+		path = configFileName
+	}
+	if chdir != "" && !filepath.IsAbs(path) {
+		path = filepath.Join(chdir, path)
+	}
+	cfg, err := loadConfig(path, configFile != "")
+	if err != nil {
+		return withExitCode(exitToolError, fmt.Errorf("reading config %s: %w", path, err))
+	}
+	if all {
+		names = sortedKeys(cfg.Suites)
+		if len(names) == 0 {
+			return withExitCode(exitToolError, fmt.Errorf("config %s defines no suites", path))
+		}
+	}
+	for _, name := range names {
+		if cfg.Suites[name] == nil {
+			return withExitCode(exitToolError, fmt.Errorf("config %s: unknown suite %q", path, name))
+		}
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("locating gotest executable: %w", err)
+	}
+
+	var results []suiteResult
+	for _, name := range names {
+		fmt.Printf("\n=== Suite %s\n", name)
+		results = append(results, runSuite(self, name, cfg.Suites[name], passthrough))
+	}
+
+	fmt.Println()
+	fmt.Println(strings.Repeat("=", 60))
+	fmt.Println("TEST SUITES")
+	fmt.Println(strings.Repeat("=", 60))
+	fmt.Printf("%-20s %-8s %10s %12s\n", "SUITE", "RESULT", "COVERAGE", "DURATION")
+	fmt.Println(strings.Repeat("-", 60))
+
+	var failed int
+	var profiles []string
+	for _, res := range results {
+		result := "PASS"
+		if !res.Passed || res.Err != nil {
+			result = "FAIL"
+			failed++
+		}
+		fmt.Printf("%-20s %-8s %10s %12s\n", res.Name, result, res.Coverage, res.Duration.Round(time.Second))
+		if _, err := os.Stat(res.Profile); err == nil {
+			profiles = append(profiles, res.Profile)
+		}
+	}
+	if len(results) > 1 && len(profiles) > 0 {
+		// Suites sharing code cover it together
+		combined := "/tmp/cover-suites.out"
+		if err := coverprofile.MergeFiles(context.Background(), profiles, combined); err != nil {
+			warnf("could not merge suite coverage: %v", err)
+		} else if p, err := coverprofile.ParseFile(context.Background(), combined); err == nil {
+			fmt.Println(strings.Repeat("-", 60))
+			fmt.Printf("%-20s %-8s %9.1f%%\n", "ALL", "", p.Total().Percent())
+			fmt.Printf("Combined profile: %s\n", combined)
+		}
+	}
+	fmt.Println(strings.Repeat("=", 60))
+
+	for _, res := range results {
+		if res.Err != nil {
+			fmt.Fprintf(os.Stderr, "Suite %s: %v\n", res.Name, res.Err)
+		}
+	}
+	if failed > 0 {
+		return withExitCode(exitTestsFailed, fmt.Errorf("%d of %d suite(s) failed", failed, len(results)))
+	}
+	return nil
+}
+
+// runSuite runs one suite: its before commands, then, once its services
+// are ready, gotest with the suite's settings, then its after commands,
+// even if the tests failed
+func runSuite(self, name string, suite *suiteConfig, passthrough []string) (res suiteResult) {
+	start := time.Now()
+	res = suiteResult{
+		Name:     name,
+		Coverage: "-",
+		Profile:  fmt.Sprintf("/tmp/cover-suite-%s.out", name),
+	}
+	defer func() { res.Duration = time.Since(start) }()
+	// A profile left by an earlier run must not count if this one fails early
+	os.Remove(res.Profile)
+
+	env := os.Environ()
+	for k, v := range suite.Env {
+		env = append(env, k+"="+os.ExpandEnv(v))
+	}
+
+	defer func() {
+		for _, command := range suite.After {
+			if err := runSuiteCommand(command, env); err != nil && res.Err == nil {
+				res.Err = fmt.Errorf("after: %w", err)
+			}
+		}
+	}()
+	for _, command := range suite.Before {
+		if err := runSuiteCommand(command, env); err != nil {
+			res.Err = fmt.Errorf("before: %w", err)
+			return res
+		}
+	}
+	if len(suite.WaitFor) > 0 {
+		if err := waitForServices(suite.WaitFor, suite.WaitTimeout, env); err != nil {
+			res.Err = fmt.Errorf("wait_for: %w", err)
+			return res
+		}
+	}
+
+	childArgs := []string{"--no-browser"}
+	if suite.Tags != "" {
+		childArgs = append(childArgs, "--tags", suite.Tags)
+	}
+	for _, k := range sortedKeys(suite.Env) {
+		childArgs = append(childArgs, "--env", k+"="+suite.Env[k])
+	}
+	childArgs = append(childArgs, passthrough...)
+	childArgs = append(childArgs, "-coverprofile="+res.Profile)
+	if suite.Timeout != "" {
+		childArgs = append(childArgs, "-timeout="+suite.Timeout)
+	}
+	childArgs = append(childArgs, suite.Packages...)
+
+	var output bytes.Buffer
+	cmd := exec.Command(self, childArgs...)
+	cmd.Env = append(os.Environ(), "GOTEST_SUITE="+name)
+	cmd.Stdout = io.MultiWriter(os.Stdout, &output)
+	cmd.Stderr = io.MultiWriter(os.Stderr, &output)
+	runErr := cmd.Run()
+
+	for _, line := range strings.Split(output.String(), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "TOTAL" {
+			res.Coverage = fields[1]
+		}
+		if strings.HasPrefix(line, "All tests passed") {
+			res.Passed = true
+		}
+	}
+	if runErr != nil && !res.Passed {
+		// Failing tests show in the table; only report other errors
+		if _, ok := runErr.(*exec.ExitError); !ok {
+			res.Err = runErr
+		}
+	}
+	return res
+}
+
+// runSuiteCommand runs a before or after command of a suite with the shell
+func runSuiteCommand(command string, env []string) error {
+	fmt.Printf("Running: %s\n", command)
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Dir = chdir
+	cmd.Env = env
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w", command, err)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Hoofffman/gotest/pkg/coverprofile"
+	"github.com/Hoofffman/gotest/pkg/runner"
+)
+
+// tagVariants maps the name of each build tag variant from the config file
+// to its comma-separated tags ("" for none)
+var tagVariants map[string]string
+
+// testTagVariants tests the packages once per build tag variant, in the
+// order of their names, and merges the variants' profiles into coverProfile,
+// so code only built under some tags counts toward coverage. Each variant
+// discovers packages with its own tags: packages that only exist under them
+// are added to the selected ones, packages its tags exclude are left out.
+func testTagVariants(ctx context.Context, packages, coverPkgs, userArgs []string, coverProfile string) (*runner.Result, error) {
+	combined := &runner.Result{}
+	tmpDir, err := os.MkdirTemp("", "gotest-tags-")
+	if err != nil {
+		return combined, fmt.Errorf("creating profile directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	selected := make(map[string]bool)
+	for _, pkg := range packages {
+		selected[pkg] = true
+	}
+	known := make(map[string]bool)
+	for _, pkg := range coverPkgs {
+		known[pkg] = true
+	}
+
+	var output strings.Builder
+	var profiles []string
+	var testErr error
+	defer func() { combined.Output = output.String() }()
+
+	for i, name := range sortedKeys(tagVariants) {
+		tags := strings.Join(splitList(tagVariants[name]), ",")
+		variantPkgs, err := variantPackages(ctx, tags)
+		if err != nil {
+			return combined, fmt.Errorf("tag variant %s: finding go packages: %w", name, err)
+		}
+		var pkgs []string
+		for _, pkg := range variantPkgs {
+			if selected[pkg] || !known[pkg] {
+				pkgs = append(pkgs, pkg)
+			}
+		}
+		if len(pkgs) == 0 {
+			continue
+		}
+
+		label := tags
+		if label == "" {
+			label = "no tags"
+		}
+		fmt.Printf("Testing tag variant %s (%s, %d package(s))...\n", name, label, len(pkgs))
+
+		args := userArgs
+		if tags != "" {
+			args = insertGoTestFlags(userArgs, "-tags="+tags)
+		}
+		profile := filepath.Join(tmpDir, fmt.Sprintf("tags-%d.out", i))
+		result, err := runTests(ctx, ".", pkgs, variantPkgs, args, profile)
+		output.WriteString(result.Output)
+		combined.Packages = append(combined.Packages, result.Packages...)
+		if err != nil && testErr == nil {
+			testErr = fmt.Errorf("tag variant %s: %w", name, err)
+		}
+		if ctx.Err() != nil {
+			return combined, testErr
+		}
+		if _, err := os.Stat(profile); err == nil {
+			profiles = append(profiles, profile)
+		}
+	}
+
+	if err := coverprofile.MergeFiles(ctx, profiles, coverProfile); err != nil {
+		return combined, fmt.Errorf("merging coverage profiles: %w", err)
+	}
+	return combined, testErr
+}
+
+// variantPackages discovers the packages selected on the command line as
+// they are built with tags
+func variantPackages(ctx context.Context, tags string) ([]string, error) {
+	saved := buildTags
+	buildTags = tags
+	defer func() { buildTags = saved }()
+
+	packages, err := findGoPackages(ctx, ".")
+	if err != nil {
+		return nil, err
+	}
+	return filterPatterns(packages, ""), nil
+}
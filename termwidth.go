@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"strconv"
+)
+
+// defaultWidth is assumed when the output isn't a terminal, e.g. in CI logs
+const defaultWidth = 80
+
+// terminalWidth returns the width of the terminal stdout is connected to.
+// $COLUMNS takes precedence, so the layout can be forced for logs.
+func terminalWidth() int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	if isTerminal(os.Stdout) {
+		if n, ok := termWidth(os.Stdout); ok && n > 0 {
+			return n
+		}
+	}
+	return defaultWidth
+}
+
+// middleEllipsis shortens s to at most n characters by replacing its middle
+// with "...", keeping more of the end: for package paths the last elements
+// are the most telling
+func middleEllipsis(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	if n <= 3 {
+		return string(r[len(r)-n:])
+	}
+	keep := n - 3
+	head := keep / 3
+	return string(r[:head]) + "..." + string(r[len(r)-(keep-head):])
+}
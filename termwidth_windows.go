@@ -0,0 +1,21 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var procGetConsoleScreenBufferInfo = syscall.NewLazyDLL("kernel32.dll").NewProc("GetConsoleScreenBufferInfo")
+
+// termWidth asks the console for the size of its window
+func termWidth(f *os.File) (int, bool) {
+	var info struct {
+		Size, CursorPosition     struct{ X, Y int16 }
+		Attributes               uint16
+		Left, Top, Right, Bottom int16
+		MaximumWindowSize        struct{ X, Y int16 }
+	}
+	ok, _, _ := procGetConsoleScreenBufferInfo.Call(f.Fd(), uintptr(unsafe.Pointer(&info)))
+	return int(info.Right-info.Left) + 1, ok != 0
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// templateFuncs are available to --template files in addition to the
+// text/template built-ins
+var templateFuncs = template.FuncMap{
+	"pct":     func(p float64) string { return fmt.Sprintf("%.1f%%", p) },
+	"seconds": func(s float64) string { return seconds(s).Round(time.Millisecond).String() },
+	"join":    strings.Join,
+	"repeat":  strings.Repeat,
+	"upper":   strings.ToUpper,
+	"lower":   strings.ToLower,
+	"trim":    strings.TrimSpace,
+	"lines":   func(s string) []string { return strings.Split(strings.TrimRight(s, "\n"), "\n") },
+}
+
+// loadReportTemplate parses the --template file, so mistakes show before
+// the tests run rather than after
+func loadReportTemplate(path string) (*template.Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(filepath.Base(path)).Funcs(templateFuncs).Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("parsing template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// renderReportTemplate renders the run summary with the template, to
+// --template-out or else stdout
+func renderReportTemplate(tmpl *template.Template, summary runSummary) error {
+	if templateOut == "" {
+		fmt.Println()
+		return tmpl.Execute(os.Stdout, summary)
+	}
+	file, err := os.Create(templateOut)
+	if err != nil {
+		return err
+	}
+	if err := tmpl.Execute(file, summary); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
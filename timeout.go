@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Hoofffman/gotest/pkg/runner"
+)
+
+// defaultTimeout is the -timeout given to go test when none is
+// (--default-timeout): go test's own 10m hides pathologically slow tests.
+// Zero leaves go test's default.
+var defaultTimeout = 2 * time.Minute
+
+// nearTimeout is the share of the timeout a package must have taken to be
+// listed as close to timing out
+const nearTimeout = 0.75
+
+// withDefaultTimeout adds the default -timeout to the go test arguments,
+// unless they have one. Fuzzing and benchmarks are meant to run long.
+func withDefaultTimeout(args []string) []string {
+	if defaultTimeout <= 0 || benchMode {
+		return args
+	}
+	for _, flag := range []string{"timeout", "fuzz", "bench"} {
+		if _, ok := goTestFlag(args, flag); ok {
+			return args
+		}
+	}
+	return append(args, "-timeout="+defaultTimeout.String())
+}
+
+// testTimeout returns the -timeout go test runs with
+func testTimeout(args []string) time.Duration {
+	if value, ok := goTestFlag(args, "timeout"); ok {
+		d, _ := time.ParseDuration(value)
+		return d
+	}
+	return defaultTestTimeout
+}
+
+// printNearTimeouts lists the packages whose tests took at least
+// nearTimeout of the timeout, as the next slowdown will make them fail
+func printNearTimeouts(result *runner.Result, timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+	var slow []runner.PackageResult
+	for _, res := range result.Packages {
+		if !res.Cached && res.Duration >= time.Duration(nearTimeout*float64(timeout)) {
+			slow = append(slow, res)
+		}
+	}
+	if len(slow) == 0 {
+		return
+	}
+
+	fmt.Printf("\n--- CLOSE TO TIMEOUT (%d, -timeout %s) ---\n", len(slow), timeout)
+	for _, res := range slow {
+		name := res.Package
+		if res.ImportPath != "" {
+			name = localPath(res.ImportPath)
+		}
+		fmt.Printf("%-40s %10s  %3.0f%%\n", name, res.Duration.Round(time.Millisecond), 100*res.Duration.Seconds()/timeout.Seconds())
+	}
+	fmt.Println(strings.Repeat("-", 30))
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// loadTimings reads per-package durations (in seconds) recorded by previous runs
+func loadTimings(path string) (map[string]float64, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	timings := make(map[string]float64)
+	if err := json.Unmarshal(data, &timings); err != nil {
+		return nil, err
+	}
+	return timings, nil
+}
+
+// saveTimings updates the timings file with the durations measured in this
+// run. Packages not measured keep their previous value, so shards running
+// in separate CI jobs can share one file.
+func saveTimings(path string, durations map[string]time.Duration) error {
+	if len(durations) == 0 {
+		return nil
+	}
+
+	timings, err := loadTimings(path)
+	if err != nil || timings == nil {
+		timings = make(map[string]float64)
+	}
+	for pkg, d := range durations {
+		timings[pkg] = d.Seconds()
+	}
+
+	data, err := json.MarshalIndent(timings, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// balancedShard partitions packages by expected runtime and returns those
+// assigned to shard index (1-based) of count. Packages are placed longest
+// first onto the least loaded shard; packages without a recorded duration
+// are assumed to take the average of the known ones.
+func balancedShard(packages []string, timings map[string]float64, index, count int) []string {
+	var known float64
+	var numKnown int
+	for _, pkg := range packages {
+		if t, ok := timings[pkg]; ok {
+			known += t
+			numKnown++
+		}
+	}
+	fallback := 1.0
+	if numKnown > 0 {
+		fallback = known / float64(numKnown)
+	}
+
+	expected := func(pkg string) float64 {
+		if t, ok := timings[pkg]; ok {
+			return t
+		}
+		return fallback
+	}
+
+	sorted := append([]string(nil), packages...)
+	sort.Slice(sorted, func(i, j int) bool {
+		ti, tj := expected(sorted[i]), expected(sorted[j])
+		if ti != tj {
+			return ti > tj
+		}
+		return sorted[i] < sorted[j]
+	})
+
+	loads := make([]float64, count)
+	var shard []string
+	for _, pkg := range sorted {
+		// Lowest index wins ties so the assignment is deterministic
+		target := 0
+		for s := 1; s < count; s++ {
+			if loads[s] < loads[target] {
+				target = s
+			}
+		}
+		loads[target] += expected(pkg)
+		if target == index-1 {
+			shard = append(shard, pkg)
+		}
+	}
+
+	sort.Strings(shard)
+	return shard
+}
+
+// parseTestDurations extracts per-package durations from go test output,
+// keyed by the package directories passed to go test. Cached results carry
+// no duration and are skipped.
+func parseTestDurations(output string, packages []string) map[string]time.Duration {
+	dirs := packageImportPaths(packages)
+	durations := make(map[string]time.Duration)
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || (fields[0] != "ok" && fields[0] != "FAIL") {
+			continue
+		}
+		pkg, ok := dirs[fields[1]]
+		if !ok {
+			continue
+		}
+		d, err := time.ParseDuration(fields[2])
+		if err != nil {
+			continue
+		}
+		durations[pkg] = d
+	}
+
+	return durations
+}
+
+// packageImportPaths maps the import path of each package directory back to
+// the directory form used on the go test command line
+func packageImportPaths(packages []string) map[string]string {
+	byDir := make(map[string]string)
+	for _, pkg := range packages {
+		if abs, err := filepath.Abs(pkg); err == nil {
+			byDir[abs] = pkg
+		}
+	}
+
+	args := []string{"list", "-e", "-f", "{{.Dir}}\t{{.ImportPath}}"}
+	if buildTags != "" {
+		args = append(args, "-tags="+buildTags)
+	}
+	args = append(args, packages...)
+	out, err := goCommand(args...).Output()
+	if err != nil {
+		return nil
+	}
+
+	paths := make(map[string]string)
+	for _, line := range strings.Split(string(out), "\n") {
+		dir, importPath, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		if pkg, ok := byDir[dir]; ok {
+			paths[importPath] = pkg
+		}
+	}
+	return paths
+}
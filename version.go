@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Set at release build time with
+// -ldflags "-X main.version=v1.2.3 -X main.commit=abc1234 -X main.buildDate=2024-05-01T12:00:00Z".
+// Otherwise they are filled in from the build info the go command embeds.
+var (
+	version   = ""
+	commit    = ""
+	buildDate = ""
+)
+
+// buildVersion returns the version, commit and build date of this binary
+func buildVersion() (string, string, string) {
+	v, c, d := version, commit, buildDate
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return orUnknown(v), orUnknown(c), orUnknown(d)
+	}
+	// go install module@version records the module version
+	if v == "" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		v = info.Main.Version
+	}
+	// Builds from a checkout record the VCS state
+	var modified bool
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if c == "" {
+				c = s.Value
+				if len(c) > 12 {
+					c = c[:12]
+				}
+			}
+		case "vcs.time":
+			if d == "" {
+				d = s.Value
+			}
+		case "vcs.modified":
+			modified = s.Value == "true"
+		}
+	}
+	if modified && c != "" && commit == "" {
+		c += "-dirty"
+	}
+	if v == "" {
+		v = "devel"
+	}
+	return v, orUnknown(c), orUnknown(d)
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
+
+// runVersion implements "gotest version": the build information of gotest
+// and the go toolchain it will invoke
+func runVersion(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: gotest version")
+	}
+
+	v, c, d := buildVersion()
+	fmt.Printf("gotest %s\n", v)
+	fmt.Printf("  commit:     %s\n", c)
+	fmt.Printf("  built:      %s\n", d)
+	fmt.Printf("  built with: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+
+	path, err := exec.LookPath(goBinary)
+	if err != nil {
+		fmt.Printf("  go:         not found in PATH\n")
+		return nil
+	}
+	fmt.Printf("  go:         %s\n", path)
+	out, err := goCommand("version").Output()
+	if err != nil {
+		fmt.Printf("  go version: unknown (%v)\n", commandError(err))
+		return nil
+	}
+	fmt.Printf("  go version: %s\n", strings.TrimPrefix(strings.TrimSpace(string(out)), "go version "))
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// runVet runs go vet on the packages and prints its findings in a dedicated
+// section. It reports whether vet passed.
+func runVet(packages []string) bool {
+	args := []string{"vet"}
+	if buildTags != "" {
+		args = append(args, "-tags="+buildTags)
+	}
+	args = append(args, packages...)
+
+	if verbose {
+		fmt.Printf("Running: go %s\n", strings.Join(args, " "))
+	}
+
+	var output bytes.Buffer
+	cmd := goCommand(args...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err := cmd.Run()
+
+	if err == nil {
+		fmt.Println("go vet: no problems found")
+		return true
+	}
+
+	fmt.Println("\n--- VET FINDINGS ---")
+	for _, line := range strings.Split(strings.TrimRight(output.String(), "\n"), "\n") {
+		fmt.Println(line)
+	}
+	fmt.Println("--------------------")
+	return false
+}
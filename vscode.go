@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// vscodeItem is a test item in the shape of the VS Code testing API's
+// TestItem: packages hold their test functions as children. IDs are the
+// same as the "id" of --ide-protocol test events.
+type vscodeItem struct {
+	ID       string        `json:"id"`
+	Label    string        `json:"label"`
+	URI      string        `json:"uri,omitempty"`
+	Range    *vscodeRange  `json:"range,omitempty"`
+	Tags     []string      `json:"tags,omitempty"`
+	Children []*vscodeItem `json:"children,omitempty"`
+}
+
+// vscodeRange is a range of zero-based lines and characters, as in VS Code
+type vscodeRange struct {
+	Start vscodePosition `json:"start"`
+	End   vscodePosition `json:"end"`
+}
+
+type vscodePosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// testID identifies a test or subtest of a package, in the form the run
+// history uses
+func testID(pkg, test string) string {
+	return pkg + " " + test
+}
+
+// printVSCodeItems prints the listed tests as a tree of VS Code test items,
+// with the location of each function so the editor can show it inline
+func printVSCodeItems(entries []listEntry) error {
+	items := []*vscodeItem{}
+	var locations map[string]vscodeRange
+	var files map[string]string
+	for _, e := range entries {
+		if len(items) == 0 || items[len(items)-1].ID != e.Package {
+			dir, _ := filepath.Abs(e.Package)
+			items = append(items, &vscodeItem{ID: e.Package, Label: localPath(e.Package), URI: fileURI(dir), Tags: []string{"package"}})
+			locations, files = testFunctions(e.Package)
+		}
+		pkg := items[len(items)-1]
+		item := &vscodeItem{ID: testID(e.Package, e.Name), Label: e.Name, Tags: []string{e.Kind}}
+		if r, ok := locations[e.Name]; ok {
+			item.URI, item.Range = fileURI(files[e.Name]), &r
+		}
+		pkg.Children = append(pkg.Children, item)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(items)
+}
+
+// testFunctions finds the functions in the test files of a package
+// directory, returning their ranges and absolute file names by name
+func testFunctions(dir string) (map[string]vscodeRange, map[string]string) {
+	locations := make(map[string]vscodeRange)
+	files := make(map[string]string)
+	names, _ := filepath.Glob(filepath.Join(dir, "*_test.go"))
+	fset := token.NewFileSet()
+	for _, name := range names {
+		file, err := parser.ParseFile(fset, name, nil, parser.SkipObjectResolution)
+		if err != nil {
+			continue
+		}
+		abs, _ := filepath.Abs(name)
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv != nil {
+				continue
+			}
+			start, end := fset.Position(fn.Pos()), fset.Position(fn.End())
+			locations[fn.Name.Name] = vscodeRange{
+				Start: vscodePosition{Line: start.Line - 1, Character: start.Column - 1},
+				End:   vscodePosition{Line: end.Line - 1, Character: end.Column - 1},
+			}
+			files[fn.Name.Name] = abs
+		}
+	}
+	return locations, files
+}
+
+// fileURI returns the file:// URI of an absolute path
+func fileURI(path string) string {
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		// Windows drive letters: file:///C:/...
+		path = "/" + path
+	}
+	return "file://" + path
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// defaultWaitTimeout bounds how long a suite waits for its services
+const defaultWaitTimeout = time.Minute
+
+// waitInterval is the pause between readiness checks
+const waitInterval = 500 * time.Millisecond
+
+// readinessCheck is one entry of a suite's wait_for: a TCP address that
+// must accept connections, an HTTP URL that must answer with a 2xx or 3xx
+// status, or a command that must succeed
+type readinessCheck struct {
+	Kind   string // tcp, http or command
+	Target string
+}
+
+func (c readinessCheck) String() string {
+	return c.Kind + " " + c.Target
+}
+
+// decodeReadinessChecks converts the wait_for list of a suite
+func decodeReadinessChecks(value any, name string) ([]readinessCheck, error) {
+	items, ok := value.([]any)
+	if !ok && value != nil {
+		return nil, fmt.Errorf("%s: expected a list", name)
+	}
+	var checks []readinessCheck
+	for i, item := range items {
+		itemName := fmt.Sprintf("%s[%d]", name, i)
+		fields, err := yamlStringMap(item, itemName)
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) != 1 {
+			return nil, fmt.Errorf("%s: expected exactly one of tcp, http or command", itemName)
+		}
+		for kind, target := range fields {
+			switch kind {
+			case "tcp", "http", "command":
+			default:
+				return nil, fmt.Errorf("unknown setting %q", itemName+"."+kind)
+			}
+			if target == "" {
+				return nil, fmt.Errorf("%s.%s: expected a value", itemName, kind)
+			}
+			checks = append(checks, readinessCheck{Kind: kind, Target: target})
+		}
+	}
+	return checks, nil
+}
+
+// waitForServices blocks until every check passes, polling each in turn,
+// or fails with the last error of the check that didn't pass in time
+func waitForServices(checks []readinessCheck, timeout time.Duration, env []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for _, check := range checks {
+		fmt.Printf("Waiting for %s\n", check)
+		start := time.Now()
+		for {
+			err := check.probe(ctx, env)
+			if err == nil {
+				debugf("%s ready after %s", check, time.Since(start).Round(time.Millisecond))
+				break
+			}
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("%s not ready after %s: %w", check, timeout, err)
+			case <-time.After(waitInterval):
+			}
+		}
+	}
+	return nil
+}
+
+// probe runs the check once
+func (c readinessCheck) probe(ctx context.Context, env []string) error {
+	switch c.Kind {
+	case "tcp":
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", c.Target)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case "http":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.Target, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 400 {
+			return fmt.Errorf("status %s", resp.Status)
+		}
+		return nil
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", c.Target)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", c.Target)
+	}
+	cmd.Dir = chdir
+	cmd.Env = env
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
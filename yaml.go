@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The config file uses a small subset of YAML: nested block mappings and
+// sequences, plain and quoted scalars, inline [a, b] sequences and comments.
+// Scalars are returned as strings, mappings as map[string]any and sequences
+// as []any; anchors, multi-line strings and flow mappings are not supported.
+
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// parseYAML parses a YAML document into maps, slices and strings
+func parseYAML(data []byte) (any, error) {
+	p := &yamlParser{}
+	for i, raw := range strings.Split(string(data), "\n") {
+		raw = strings.TrimRight(raw, " \t\r")
+		text := strings.TrimLeft(raw, " ")
+		if strings.HasPrefix(text, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", i+1)
+		}
+		text = stripComment(text)
+		if text == "" || text == "---" {
+			continue
+		}
+		p.lines = append(p.lines, yamlLine{num: i + 1, indent: len(raw) - len(strings.TrimLeft(raw, " ")), text: text})
+	}
+
+	if len(p.lines) == 0 {
+		return map[string]any{}, nil
+	}
+	value, err := p.parseBlock(p.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].num)
+	}
+	return value, nil
+}
+
+func (p *yamlParser) parseBlock(indent int) (any, error) {
+	if isListItem(p.lines[p.pos].text) {
+		return p.parseList(indent)
+	}
+	return p.parseMap(indent)
+}
+
+func (p *yamlParser) parseMap(indent int) (map[string]any, error) {
+	m := make(map[string]any)
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent < indent {
+			break
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", line.num)
+		}
+		if isListItem(line.text) {
+			return nil, fmt.Errorf("line %d: unexpected list item", line.num)
+		}
+
+		key, rest, ok := splitKey(line.text)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", line.num)
+		}
+		if _, dup := m[key]; dup {
+			return nil, fmt.Errorf("line %d: duplicate key %q", line.num, key)
+		}
+		p.pos++
+
+		if rest != "" {
+			value, err := parseScalar(rest)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line.num, err)
+			}
+			m[key] = value
+			continue
+		}
+
+		// A nested block is either more indented, or a sequence at the same indentation
+		if p.pos < len(p.lines) {
+			next := p.lines[p.pos]
+			if next.indent > indent || (next.indent == indent && isListItem(next.text)) {
+				value, err := p.parseBlock(next.indent)
+				if err != nil {
+					return nil, err
+				}
+				m[key] = value
+				continue
+			}
+		}
+		m[key] = nil
+	}
+	return m, nil
+}
+
+func (p *yamlParser) parseList(indent int) ([]any, error) {
+	var list []any
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent < indent || (line.indent == indent && !isListItem(line.text)) {
+			break
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", line.num)
+		}
+
+		item := strings.TrimSpace(strings.TrimPrefix(line.text, "-"))
+		switch {
+		case item == "":
+			p.pos++
+			if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+				value, err := p.parseBlock(p.lines[p.pos].indent)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, value)
+			} else {
+				list = append(list, nil)
+			}
+		case isMappingEntry(item):
+			// "- key: value" starts a mapping indented past the dash
+			itemIndent := line.indent + len(line.text) - len(item)
+			p.lines[p.pos] = yamlLine{num: line.num, indent: itemIndent, text: item}
+			value, err := p.parseMap(itemIndent)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		default:
+			value, err := parseScalar(item)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line.num, err)
+			}
+			list = append(list, value)
+			p.pos++
+		}
+	}
+	return list, nil
+}
+
+func isListItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func isMappingEntry(text string) bool {
+	if strings.HasPrefix(text, "[") {
+		return false
+	}
+	_, _, ok := splitKey(text)
+	return ok
+}
+
+// splitKey splits "key: value" outside of quotes
+func splitKey(text string) (string, string, bool) {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ':' && (i+1 == len(text) || text[i+1] == ' '):
+			key, err := parseScalar(strings.TrimSpace(text[:i]))
+			if err != nil {
+				return "", "", false
+			}
+			k, _ := key.(string)
+			return k, strings.TrimSpace(text[i+1:]), k != ""
+		}
+	}
+	return "", "", false
+}
+
+// stripComment removes a trailing "# comment" outside of quotes
+func stripComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || text[i-1] == ' '):
+			return strings.TrimRight(text[:i], " ")
+		}
+	}
+	return text
+}
+
+// parseScalar parses a plain, quoted or inline-sequence value
+func parseScalar(text string) (any, error) {
+	switch {
+	case strings.HasPrefix(text, `"`):
+		s, err := strconv.Unquote(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quoted string %s", text)
+		}
+		return s, nil
+	case strings.HasPrefix(text, "'"):
+		if len(text) < 2 || !strings.HasSuffix(text, "'") {
+			return nil, fmt.Errorf("invalid quoted string %s", text)
+		}
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	case strings.HasPrefix(text, "["):
+		if !strings.HasSuffix(text, "]") {
+			return nil, fmt.Errorf("unterminated list %s", text)
+		}
+		var list []any
+		inner := strings.TrimSpace(text[1 : len(text)-1])
+		if inner == "" {
+			return list, nil
+		}
+		for _, item := range strings.Split(inner, ",") {
+			value, err := parseScalar(strings.TrimSpace(item))
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return list, nil
+	case text == "~" || text == "null":
+		return nil, nil
+	}
+	return text, nil
+}
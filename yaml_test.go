@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want any
+	}{
+		{"empty", "", map[string]any{}},
+		{"comments only", "# nothing\n---\n", map[string]any{}},
+		{"scalars", "a: 1\nb: two\nc: ~\nd:\n", map[string]any{"a": "1", "b": "two", "c": nil, "d": nil}},
+		{"quoted", `a: "x: # y"` + "\nb: 'it''s'\n", map[string]any{"a": "x: # y", "b": "it's"}},
+		{"escapes", `a: "tab\there"`, map[string]any{"a": "tab\there"}},
+		{"comment after value", "a: b # note\nc: d#e\n", map[string]any{"a": "b", "c": "d#e"}},
+		{"inline list", "a: [x, 'y', \"z\"]\nb: []\n", map[string]any{"a": []any{"x", "y", "z"}, "b": []any(nil)}},
+		{"nested map", "a:\n  b:\n    c: d\n  e: f\n", map[string]any{"a": map[string]any{"b": map[string]any{"c": "d"}, "e": "f"}}},
+		{"indented list", "a:\n  - x\n  - y\n", map[string]any{"a": []any{"x", "y"}}},
+		{"list at key indentation", "a:\n- x\n- y\nb: z\n", map[string]any{"a": []any{"x", "y"}, "b": "z"}},
+		{"list of maps", "a:\n  - name: x\n    go: 1.21\n  - name: y\n", map[string]any{"a": []any{
+			map[string]any{"name": "x", "go": "1.21"},
+			map[string]any{"name": "y"},
+		}}},
+		{"empty list item", "a:\n  -\n  - x\n", map[string]any{"a": []any{nil, "x"}}},
+		{"top-level list", "- a\n- b\n", []any{"a", "b"}},
+		{"windows line endings", "a: b\r\nc: d\r\n", map[string]any{"a": "b", "c": "d"}},
+		{"url value", "a: http://example.com\n", map[string]any{"a": "http://example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseYAML([]byte(tt.in))
+			if err != nil {
+				t.Fatalf("parseYAML: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseYAML = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"tab indentation", "a:\n\tb: c\n", "line 2: tabs are not allowed"},
+		{"duplicate key", "a: 1\na: 2\n", `line 2: duplicate key "a"`},
+		{"not a mapping", "a: 1\njust text\n", `line 2: expected "key: value"`},
+		{"over-indented", "a: 1\n  b: 2\n", "line 2: unexpected indentation"},
+		{"list in map", "a:\n  b: 1\n  - c\n", "line 3: unexpected list item"},
+		{"bad quote", `a: "open`, "line 1: invalid quoted string"},
+		{"unterminated list", "a: [x, y\n", "line 1: unterminated list"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseYAML([]byte(tt.in))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseYAML error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}